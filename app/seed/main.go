@@ -0,0 +1,60 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/log"
+	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/resource"
+	"github.com/gkkkb/pokedex/pkg/seed"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+)
+
+func main() {
+	var cfg seed.Config
+	branch := flag.Uint("branch", 1, "church branch of generated data")
+	flag.IntVar(&cfg.Profiles, "profiles", 1000, "number of member profiles")
+	flag.IntVar(&cfg.HouseholdSize, "household-size", 3, "average members per household")
+	flag.IntVar(&cfg.Groups, "groups", 20, "number of groups")
+	flag.IntVar(&cfg.GroupsPerMember, "groups-per-member", 2, "most groups a member joins")
+	flag.IntVar(&cfg.AttendanceWeeks, "attendance-weeks", 12, "past weeks of attendance")
+	flag.Float64Var(&cfg.PhotoRatio, "photo-ratio", 0.3, "share of members given a photo")
+	flag.Int64Var(&cfg.Seed, "seed", time.Now().UnixNano(), "random seed, reuse it to generate the same data")
+	migrate := flag.Bool("migrate", false, "apply db/migrations first")
+	migrationsDir := flag.String("migrations", "db/migrations", "migrations directory")
+	force := flag.Bool("force", false, "allow seeding when ENV is production")
+	flag.Parse()
+	cfg.BranchID = *branch
+
+	instance, err := pokedex.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if os.Getenv("ENV") == "production" && !*force {
+		log.Fatal("refusing to seed a production database, pass -force to do it anyway")
+	}
+
+	ctx := tenant.Unscoped(resource.NewJobContext(context.Background(), "seed"))
+	if *migrate {
+		applied, err := mysql.Migrate(ctx, instance.DB, *migrationsDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Fprintf(os.Stderr, "applied migrations %v\n", applied)
+	}
+
+	fmt.Fprintf(os.Stderr, "seeding with -seed %d\n", cfg.Seed)
+	report, err := seed.Run(ctx, instance.DB, instance.Storage, cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	json.NewEncoder(os.Stdout).Encode(report)
+}
@@ -8,7 +8,10 @@ import (
 	"github.com/gkkkb/pokedex"
 	"github.com/gkkkb/pokedex/pkg/api"
 	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
 	"github.com/gkkkb/pokedex/pkg/log"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/upload"
 	"github.com/gkkkb/pokedex/route"
 
 	"github.com/gkkkb/piston/metric"
@@ -18,13 +21,22 @@ import (
 )
 
 func main() {
-	instance := pokedex.GetInstance() 
+	instance, err := pokedex.Init()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := currentuser.CheckKeys(); err != nil {
+		log.Fatal(err)
+	}
 	
 	router := httprouter.New()
 	router.HandlerFunc("GET", "/metrics", metric.Handler)
 	router.GET("/healthz", func(w http.ResponseWriter, _ *http.Request, _ httprouter.Params) {
 		resp := response.ResponseBody{
-			Data:    instance.DB.Stats(),
+			Data: map[string]interface{}{
+				"primary":  instance.DB.Stats(),
+				"replicas": instance.Replicas.Stats(),
+			},
 			Message: "OK",
 			Meta: response.MetaInfo{
 				HTTPStatus: http.StatusOK},
@@ -32,6 +44,11 @@ func main() {
 		response.Write(w, resp, http.StatusOK)
 	})
 
+	// presigned PUT URLs are only handed out for profile photos
+	signed := storage.SignedHandler(instance.Storage, storage.NewURLSigner(os.Getenv("HOST")), upload.Purposes[upload.PurposePhoto].Limit())
+	router.Handler("GET", storage.SignedPathPrefix+"*name", signed)
+	router.Handler("PUT", storage.SignedPathPrefix+"*name", signed)
+
 	apis := route.Route()
 
 	api.StartAPIs(router, apis)
@@ -40,6 +57,7 @@ func main() {
 		AllowedOrigins: []string{"*"},
 		AllowedMethods: []string{"GET", "POST", "PATCH", "DELETE", "PUT", "HEAD", "OPTIONS"},
 		AllowedHeaders: []string{"*"},
+		ExposedHeaders: []string{"Location", "Tus-Resumable", "Tus-Version", "Tus-Extension", "Tus-Max-Size", "Tus-Max-Chunk-Size", "Upload-Offset", "Upload-Length", "Upload-Expires"},
 		MaxAge:         86400,
 	})
 
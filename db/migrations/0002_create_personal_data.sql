@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS profile_histories (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  profile_id INT UNSIGNED NOT NULL,
+  field VARCHAR(64) NOT NULL,
+  old_value TEXT NULL,
+  new_value TEXT NULL,
+  changed_by INT UNSIGNED NOT NULL DEFAULT 0,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY index_profile_histories_on_profile_id (profile_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS attendances (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  profile_id INT UNSIGNED NOT NULL,
+  event VARCHAR(255) NOT NULL,
+  attended_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY index_attendances_on_profile_id (profile_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS erasure_requests (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  profile_id INT UNSIGNED NOT NULL,
+  requested_by INT UNSIGNED NOT NULL,
+  reviewed_by INT UNSIGNED NULL,
+  status VARCHAR(16) NOT NULL DEFAULT 'requested',
+  reason TEXT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY index_erasure_requests_on_profile_id (profile_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS audit_logs (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  actor_id INT UNSIGNED NOT NULL DEFAULT 0,
+  action VARCHAR(64) NOT NULL,
+  subject_type VARCHAR(64) NOT NULL,
+  subject_id INT UNSIGNED NOT NULL,
+  detail TEXT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY index_audit_logs_on_subject (subject_type, subject_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
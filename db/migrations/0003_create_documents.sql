@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS documents (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  profile_id INT UNSIGNED NOT NULL,
+  type VARCHAR(32) NOT NULL,
+  title VARCHAR(255) NOT NULL,
+  created_by INT UNSIGNED NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  deleted_at DATETIME NULL,
+  PRIMARY KEY (id),
+  KEY index_documents_on_profile_id (profile_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS document_versions (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  document_id INT UNSIGNED NOT NULL,
+  version INT UNSIGNED NOT NULL,
+  filename VARCHAR(255) NOT NULL,
+  original_name VARCHAR(255) NOT NULL DEFAULT '',
+  content_type VARCHAR(255) NOT NULL DEFAULT '',
+  size BIGINT NOT NULL DEFAULT 0,
+  uploaded_by INT UNSIGNED NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY index_document_versions_on_document_id_and_version (document_id, version)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
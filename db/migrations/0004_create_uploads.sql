@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS uploads (
+  id VARCHAR(36) NOT NULL,
+  purpose VARCHAR(32) NOT NULL,
+  profile_id INT UNSIGNED NOT NULL DEFAULT 0,
+  filename VARCHAR(255) NOT NULL,
+  length BIGINT NOT NULL,
+  upload_offset BIGINT NOT NULL DEFAULT 0,
+  chunks INT UNSIGNED NOT NULL DEFAULT 0,
+  metadata TEXT NULL,
+  created_by INT UNSIGNED NOT NULL,
+  expires_at DATETIME NOT NULL,
+  completed_at DATETIME NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY index_uploads_on_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
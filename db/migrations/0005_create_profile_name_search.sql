@@ -0,0 +1,8 @@
+ALTER TABLE profiles ADD FULLTEXT INDEX fulltext_profiles_on_name (name);
+
+CREATE TABLE IF NOT EXISTS profile_name_trigrams (
+  trigram CHAR(3) NOT NULL,
+  profile_id INT UNSIGNED NOT NULL,
+  PRIMARY KEY (trigram, profile_id),
+  KEY index_profile_name_trigrams_on_profile_id (profile_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_bin;
@@ -0,0 +1,3 @@
+ALTER TABLE profiles ADD COLUMN version INT UNSIGNED NOT NULL DEFAULT 1 AFTER visibility;
+
+ALTER TABLE households ADD COLUMN version INT UNSIGNED NOT NULL DEFAULT 1 AFTER address;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS branches (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  name VARCHAR(255) NOT NULL,
+  city VARCHAR(255) NOT NULL DEFAULT '',
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+INSERT INTO branches (id, name) VALUES (1, 'Main') ON DUPLICATE KEY UPDATE id = id;
+
+ALTER TABLE profiles ADD COLUMN branch_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id, ADD KEY index_profiles_on_branch_id (branch_id);
+ALTER TABLE households ADD COLUMN branch_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id, ADD KEY index_households_on_branch_id (branch_id);
+ALTER TABLE `groups` ADD COLUMN branch_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id, ADD KEY index_groups_on_branch_id (branch_id);
+ALTER TABLE documents ADD COLUMN branch_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id, ADD KEY index_documents_on_branch_id (branch_id);
+ALTER TABLE uploads ADD COLUMN branch_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id, ADD KEY index_uploads_on_branch_id (branch_id);
+ALTER TABLE erasure_requests ADD COLUMN branch_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id, ADD KEY index_erasure_requests_on_branch_id (branch_id);
+ALTER TABLE audit_logs ADD COLUMN branch_id INT UNSIGNED NOT NULL DEFAULT 1 AFTER id, ADD KEY index_audit_logs_on_branch_id (branch_id);
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS transfers (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  branch_id INT UNSIGNED NOT NULL,
+  profile_id INT UNSIGNED NOT NULL,
+  to_branch_id INT UNSIGNED NULL,
+  destination_church VARCHAR(255) NOT NULL DEFAULT '',
+  status VARCHAR(16) NOT NULL DEFAULT 'requested',
+  reason TEXT NULL,
+  requested_by INT UNSIGNED NOT NULL,
+  source_approved_by INT UNSIGNED NULL,
+  destination_approved_by INT UNSIGNED NULL,
+  rejected_by INT UNSIGNED NULL,
+  package VARCHAR(255) NOT NULL DEFAULT '',
+  completed_at DATETIME NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  KEY index_transfers_on_profile_id (profile_id),
+  KEY index_transfers_on_branch_id (branch_id),
+  KEY index_transfers_on_to_branch_id (to_branch_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
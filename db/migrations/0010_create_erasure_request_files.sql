@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS erasure_request_files (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  erasure_request_id INT UNSIGNED NOT NULL,
+  store VARCHAR(16) NOT NULL,
+  file_prefix VARCHAR(255) NOT NULL,
+  filename VARCHAR(255) NOT NULL,
+  PRIMARY KEY (id),
+  KEY index_erasure_request_files_on_erasure_request_id (erasure_request_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
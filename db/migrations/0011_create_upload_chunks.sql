@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS upload_chunks (
+  upload_id VARCHAR(36) NOT NULL,
+  upload_offset BIGINT NOT NULL,
+  filename VARCHAR(255) NOT NULL,
+  size BIGINT NOT NULL,
+  PRIMARY KEY (upload_id, upload_offset)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- chunks of uploads in progress were not recorded, let cleanup remove them
+UPDATE uploads SET expires_at = UTC_TIMESTAMP() WHERE completed_at IS NULL;
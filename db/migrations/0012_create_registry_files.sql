@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS registry_files (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  branch_id INT UNSIGNED NOT NULL,
+  upload_id VARCHAR(36) NOT NULL,
+  filename VARCHAR(255) NOT NULL,
+  original_name VARCHAR(255) NOT NULL DEFAULT '',
+  size BIGINT NOT NULL,
+  created_by INT UNSIGNED NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY index_registry_files_on_upload_id (upload_id),
+  KEY index_registry_files_on_branch_id (branch_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS transfer_imports (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  branch_id INT UNSIGNED NOT NULL,
+  issuer_key VARCHAR(64) NOT NULL,
+  issuer_church VARCHAR(255) NOT NULL,
+  transfer_id INT UNSIGNED NOT NULL,
+  profile_id INT UNSIGNED NOT NULL,
+  imported_by INT UNSIGNED NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY index_transfer_imports_on_issuer_key_and_transfer_id (issuer_key, transfer_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,21 @@
+CREATE TABLE IF NOT EXISTS private_documents (
+  id INT UNSIGNED NOT NULL AUTO_INCREMENT,
+  branch_id INT UNSIGNED NOT NULL,
+  profile_id INT UNSIGNED NOT NULL,
+  filename VARCHAR(255) NOT NULL,
+  original_name VARCHAR(255) NOT NULL DEFAULT '',
+  content_type VARCHAR(255) NOT NULL DEFAULT '',
+  size BIGINT NOT NULL,
+  uploaded_by INT UNSIGNED NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  PRIMARY KEY (id),
+  UNIQUE KEY index_private_documents_on_profile_id_and_filename (profile_id, filename),
+  KEY index_private_documents_on_branch_id (branch_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+-- documents uploaded before this table were only recorded in audit_logs
+INSERT INTO private_documents (branch_id, profile_id, filename, size, uploaded_by, created_at)
+SELECT p.branch_id, a.subject_id, a.detail, 0, a.actor_id, a.created_at
+FROM audit_logs a JOIN profiles p ON p.id = a.subject_id
+WHERE a.action = 'private-document-uploaded' AND a.subject_type = 'profile'
+ON DUPLICATE KEY UPDATE id = id;
@@ -0,0 +1,3 @@
+ALTER TABLE registry_files ADD COLUMN profile_id INT UNSIGNED NOT NULL DEFAULT 0 AFTER branch_id, ADD KEY index_registry_files_on_profile_id (profile_id);
+
+UPDATE registry_files r JOIN uploads u ON u.id = r.upload_id SET r.profile_id = u.profile_id;
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS file_orphans (
+  store VARCHAR(16) NOT NULL,
+  name VARCHAR(512) NOT NULL,
+  first_seen_at DATETIME NOT NULL,
+  sweep_id VARCHAR(36) NOT NULL,
+  PRIMARY KEY (store, name)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -4,17 +4,18 @@ import (
 	"strings"
 
 	"github.com/gkkkb/piston/middleware"
-	
+
 	"github.com/julienschmidt/httprouter"
 )
 
 // API contains informations needed for an API
 type API struct {
-	Endpoint  string
-	Action    string
-	Method    string
-	Authority Authority
-	Handle    HandleWithError
+	Endpoint   string
+	Action     string
+	Method     string
+	Authority  Authority
+	Constraint Constraint
+	Handle     HandleWithError
 }
 
 // Authority represents authority of users
@@ -40,7 +41,7 @@ func StartAPIs(router *httprouter.Router, apis []API) {
 		if strings.HasPrefix(api.Endpoint, "/_internal") {
 			action, handle = newInternalHandle(api.Action, api.Authority, api.Handle)
 		} else {
-			action, handle = newHandle(api.Action, api.Authority, api.Handle)
+			action, handle = newHandle(api.Action, api.Authority, api.Constraint, api.Handle)
 		}
 
 		router.Handle(api.Method, api.Endpoint, middleware.MonitorHTTP(action, handle))
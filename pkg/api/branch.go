@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/constants"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+)
+
+// activeBranch returns branch a request is scoped to. Users are bound to the
+// branch of their token, the branch header may only repeat it. Super admins
+// may pick any branch through the header and see every branch without it.
+func activeBranch(r *http.Request, currentUser *currentuser.CurrentUser) (uint, error) {
+	header := r.Header.Get(tenant.Header)
+
+	var requested uint
+	if header != "" {
+		id, err := strconv.Atoi(header)
+		if err != nil || id < 0 {
+			ce := response.InvalidParameterError
+			ce.Field = tenant.Header
+			return 0, ce
+		}
+		requested = uint(id)
+	}
+
+	if currentUser.Role == constants.ROLE_SUPER_ADM {
+		return requested, nil
+	}
+
+	if header != "" && requested != currentUser.BranchID {
+		return 0, response.BranchNotAllowedError
+	}
+	return currentUser.BranchID, nil
+}
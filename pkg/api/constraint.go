@@ -0,0 +1,152 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+)
+
+// Constraint restricts which client applications may call an API.
+// Every value can be overridden per action through environment variables,
+// so a minimum version can be raised without redeploying:
+//
+//	APP_PLATFORMS_<ACTION>            comma separated allowed platforms
+//	APP_MIN_ANDROID_VERSION_<ACTION>  minimum Android app version
+//	APP_MIN_IOS_VERSION_<ACTION>      minimum iOS app version
+//
+// The same names without the action suffix apply to every action without
+// its own override. Web clients send no platform; they are rejected by any
+// platform list unless it contains PlatformWeb.
+//
+// Versions are dot separated numbers compared segment by segment, so
+// 1.10.0 is newer than 1.9.9. Apps sending no or a malformed
+// GKKKB-App-Version are asked to update.
+type Constraint struct {
+	Platforms         []string
+	MinAndroidVersion string
+	MinIOSVersion     string
+}
+
+var errInvalidVersion = errors.New("invalid app version")
+
+// PlatformWeb allows clients without a platform, such as web, in Constraint.Platforms
+const PlatformWeb = "web"
+
+// check returns a CustomError when currentUser does not satisfy the constraint
+func (c Constraint) check(action string, currentUser *currentuser.CurrentUser) error {
+	platform := currentUser.Platform()
+
+	platforms := c.Platforms
+	if v, ok := actionEnv("APP_PLATFORMS", action); ok {
+		platforms = splitPlatforms(v)
+	}
+	if len(platforms) > 0 && !isPlatformAllowed(platform, platforms) {
+		return response.PlatformNotAllowedError
+	}
+
+	var minVersion string
+	switch platform {
+	case currentuser.PlatformAndroid:
+		minVersion = actionEnvVersion("APP_MIN_ANDROID_VERSION", action, c.MinAndroidVersion)
+	case currentuser.PlatformIOS:
+		minVersion = actionEnvVersion("APP_MIN_IOS_VERSION", action, c.MinIOSVersion)
+	default:
+		return nil
+	}
+
+	min, err := parseVersion(minVersion)
+	if err != nil {
+		return nil
+	}
+	version, err := parseVersion(currentUser.AppVersionName())
+	if err != nil || compareVersions(version, min) < 0 {
+		return response.AppUpdateRequiredError
+	}
+	return nil
+}
+
+// parseVersion returns numbers of a dot separated version such as 1.10.0
+func parseVersion(v string) ([]int, error) {
+	if v == "" {
+		return nil, errInvalidVersion
+	}
+
+	parts := strings.Split(v, ".")
+	version := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return nil, errInvalidVersion
+		}
+		version[i] = n
+	}
+	return version, nil
+}
+
+// compareVersions returns -1, 0 or 1 when a is older than, the same as or
+// newer than b. Missing trailing numbers count as 0, so 1.2 equals 1.2.0.
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+	}
+	return 0
+}
+
+func isPlatformAllowed(platform string, platforms []string) bool {
+	if platform == "" {
+		platform = PlatformWeb
+	}
+	return isInSliceString(platform, platforms)
+}
+
+func splitPlatforms(v string) []string {
+	platforms := []string{}
+	for _, p := range strings.Split(v, ",") {
+		if p = strings.TrimSpace(p); p != "" {
+			platforms = append(platforms, p)
+		}
+	}
+	return platforms
+}
+
+// actionEnv looks up name_ACTION first, then name
+func actionEnv(name, action string) (string, bool) {
+	key := fmt.Sprintf("%s_%s", name, strings.ToUpper(strings.Replace(action, "-", "_", -1)))
+	if v := os.Getenv(key); v != "" {
+		return v, true
+	}
+	if v := os.Getenv(name); v != "" {
+		return v, true
+	}
+	return "", false
+}
+
+// actionEnvVersion returns the version of actionEnv, or fallback when it is
+// unset or malformed
+func actionEnvVersion(name, action string, fallback string) string {
+	v, ok := actionEnv(name, action)
+	if !ok {
+		return fallback
+	}
+	if _, err := parseVersion(strings.TrimSpace(v)); err != nil {
+		return fallback
+	}
+	return strings.TrimSpace(v)
+}
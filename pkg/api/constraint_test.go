@@ -0,0 +1,195 @@
+package api
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	testSecret       = "api-test-secret"
+	testAndroidAppID = 11
+	testIOSAppID     = 12
+)
+
+// setAppEnv configures app ids and a token secret, clearing overrides of
+// constraints
+func setAppEnv(t *testing.T) {
+	t.Setenv("AUTH_TOKEN_SECRET", testSecret)
+	t.Setenv("GKKKB_ANDROID_APP_ID", "11")
+	t.Setenv("GKKKB_IOS_APP_ID", "12")
+	for _, key := range []string{"APP_PLATFORMS", "APP_MIN_ANDROID_VERSION", "APP_MIN_IOS_VERSION",
+		"APP_PLATFORMS_CALL_TEST", "APP_MIN_ANDROID_VERSION_CALL_TEST", "APP_MIN_IOS_VERSION_CALL_TEST"} {
+		t.Setenv(key, "")
+	}
+}
+
+// appRequest returns a request of a user of given app, sending version in
+// GKKKB-App-Version unless it is empty. App 0 is a web client.
+func appRequest(t *testing.T, appID int, version string) *http.Request {
+	t.Helper()
+
+	segment := func(v interface{}) string {
+		b, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return base64.RawURLEncoding.EncodeToString(b)
+	}
+	unsigned := segment(map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + segment(map[string]interface{}{
+		"resource_owner": map[string]interface{}{"id": 7, "role": "user", "branch_id": 1},
+		"application_id": appID,
+	})
+	mac := hmac.New(sha256.New, []byte(testSecret))
+	mac.Write([]byte(unsigned))
+
+	r := httptest.NewRequest("GET", "/profiles/7", nil)
+	r.Header.Set("Authorization", "Bearer "+unsigned+"."+base64.RawURLEncoding.EncodeToString(mac.Sum(nil)))
+	if version != "" {
+		r.Header.Set("GKKKB-App-Version", version)
+	}
+	return r
+}
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.10.0", "1.9.9", 1},
+		{"1.9.9", "1.10.0", -1},
+		{"1.2", "1.2.0", 0},
+		{"2", "10", -1},
+		{"3.0.1", "3.0.0", 1},
+		{"250", "250", 0},
+	}
+	for _, c := range cases {
+		a, err := parseVersion(c.a)
+		if err != nil {
+			t.Fatalf("%s: %v", c.a, err)
+		}
+		b, err := parseVersion(c.b)
+		if err != nil {
+			t.Fatalf("%s: %v", c.b, err)
+		}
+		if got := compareVersions(a, b); got != c.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+
+	for _, v := range []string{"", "abc", "1..2", "1.x", "v1.2.0", "1.-2", "1.2.0-beta"} {
+		if _, err := parseVersion(v); err == nil {
+			t.Errorf("%q parsed as a version", v)
+		}
+	}
+}
+
+func TestConstraintCheck(t *testing.T) {
+	setAppEnv(t)
+
+	minimum := Constraint{MinAndroidVersion: "1.9.9", MinIOSVersion: "2.0.0"}
+	cases := []struct {
+		name       string
+		constraint Constraint
+		appID      int
+		version    string
+		want       error
+	}{
+		{"newer android", minimum, testAndroidAppID, "1.10.0", nil},
+		{"same android", minimum, testAndroidAppID, "1.9.9", nil},
+		{"older android", minimum, testAndroidAppID, "1.9.8", response.AppUpdateRequiredError},
+		{"older ios", minimum, testIOSAppID, "1.10.0", response.AppUpdateRequiredError},
+		{"missing version", minimum, testAndroidAppID, "", response.AppUpdateRequiredError},
+		{"malformed version", minimum, testAndroidAppID, "latest", response.AppUpdateRequiredError},
+		{"no minimum", Constraint{}, testAndroidAppID, "", nil},
+		{"web without platforms", minimum, 0, "", nil},
+		{"web allowed", Constraint{Platforms: []string{PlatformWeb}}, 0, "", nil},
+		{"web not allowed", Constraint{Platforms: []string{currentuser.PlatformAndroid}}, 0, "", response.PlatformNotAllowedError},
+		{"ios not allowed", Constraint{Platforms: []string{currentuser.PlatformAndroid, PlatformWeb}}, testIOSAppID, "9.0.0", response.PlatformNotAllowedError},
+	}
+	for _, c := range cases {
+		user, err := currentuser.FromRequest(appRequest(t, c.appID, c.version))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := c.constraint.check("call-test", user); got != c.want {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestConstraintCheckOverriddenByEnv(t *testing.T) {
+	setAppEnv(t)
+
+	user, err := currentuser.FromRequest(appRequest(t, testAndroidAppID, "1.10.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	constraint := Constraint{MinAndroidVersion: "1.0.0"}
+
+	t.Setenv("APP_MIN_ANDROID_VERSION", "1.11.0")
+	if err := constraint.check("call-test", user); err != response.AppUpdateRequiredError {
+		t.Errorf("global minimum: got %v, want %v", err, response.AppUpdateRequiredError)
+	}
+
+	t.Setenv("APP_MIN_ANDROID_VERSION_CALL_TEST", "1.10.0")
+	if err := constraint.check("call-test", user); err != nil {
+		t.Errorf("action minimum: got %v, want nil", err)
+	}
+
+	// a malformed override keeps the constraint minimum
+	t.Setenv("APP_MIN_ANDROID_VERSION_CALL_TEST", "one")
+	t.Setenv("APP_MIN_ANDROID_VERSION", "")
+	if err := constraint.check("call-test", user); err != nil {
+		t.Errorf("malformed minimum: got %v, want nil", err)
+	}
+}
+
+func TestNewHandleRequiresUpdate(t *testing.T) {
+	setAppEnv(t)
+
+	called := false
+	_, handle := newHandle("call-test", User, Constraint{MinAndroidVersion: "1.10.0"}, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+		called = true
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	err := handle(w, appRequest(t, testAndroidAppID, "1.9.9"), nil)
+	if called {
+		t.Error("handler called for an outdated app")
+	}
+	if err != response.AppUpdateRequiredError {
+		t.Errorf("error %v, want %v", err, response.AppUpdateRequiredError)
+	}
+	if w.Code != response.AppUpdateRequiredError.HTTPCode {
+		t.Errorf("status %d, want %d", w.Code, response.AppUpdateRequiredError.HTTPCode)
+	}
+
+	var body struct {
+		Errors []struct {
+			Message string `json:"message"`
+			Code    int    `json:"code"`
+		} `json:"errors"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("body %q: %v", w.Body.String(), err)
+	}
+	if len(body.Errors) != 1 || body.Errors[0].Code != response.AppUpdateRequiredError.Code || body.Errors[0].Message != response.AppUpdateRequiredError.Message {
+		t.Errorf("errors %+v, want %s (%d)", body.Errors, response.AppUpdateRequiredError.Message, response.AppUpdateRequiredError.Code)
+	}
+
+	called = false
+	if err := handle(httptest.NewRecorder(), appRequest(t, testAndroidAppID, "1.10.0"), nil); err != nil || !called {
+		t.Errorf("up to date app: error %v, handler called %v", err, called)
+	}
+}
@@ -2,11 +2,14 @@ package currentuser
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/gkkkb/piston/authorization"
+	"github.com/gkkkb/pokedex/pkg/tenant"
 )
 
 // CurrentUser contains user informations in a context
@@ -14,11 +17,19 @@ type CurrentUser struct {
 	ID       uint
 	Role     string
 	Username string
+	// BranchID is the church branch the user belongs to
+	BranchID uint
 
 	applicationID int
 	appVersion    string
 }
 
+// Platform types returned by Platform
+const (
+	PlatformAndroid = "gkkkbandroid"
+	PlatformIOS     = "gkkkbios"
+)
+
 type key int
 
 // Key is currentuser context key
@@ -31,24 +42,65 @@ func FromRequest(r *http.Request) (*CurrentUser, error) {
 		return nil, err
 	}
 
+	claims, err := verifiedClaims(r)
+	if err != nil {
+		return nil, err
+	}
+
 	return &CurrentUser{
 		ID:       token.Token.ResourceOwner.ID,
 		Role:     token.Token.ResourceOwner.Role,
 		Username: token.Token.ResourceOwner.Username,
+		BranchID: branchClaim(claims),
 
 		applicationID: token.Token.ApplicationID,
 		appVersion:    r.Header.Get("GKKKB-App-Version"),
 	}, nil
 }
 
+// branchClaim returns branch_id of verified claims, either top level or
+// inside resource_owner. Tokens issued before branches existed have none
+// and get the default branch.
+func branchClaim(claims []byte) uint {
+	var c struct {
+		BranchID      uint `json:"branch_id"`
+		ResourceOwner struct {
+			BranchID uint `json:"branch_id"`
+		} `json:"resource_owner"`
+	}
+	json.Unmarshal(claims, &c)
+
+	switch {
+	case c.BranchID != 0:
+		return c.BranchID
+	case c.ResourceOwner.BranchID != 0:
+		return c.ResourceOwner.BranchID
+	}
+	return tenant.Default()
+}
+
 // NewContext returns context containing given CurrentUser
 func NewContext(ctx context.Context, user *CurrentUser) context.Context {
 	return context.WithValue(ctx, Key, user)
 }
 
-// FromContext returns CurrentUser contained in given context
+// Lookup returns CurrentUser contained in given context, reporting whether
+// there is one. Background jobs and internal routes have none.
+func Lookup(ctx context.Context) (*CurrentUser, bool) {
+	if ctx == nil {
+		return nil, false
+	}
+	user, ok := ctx.Value(Key).(*CurrentUser)
+	return user, ok && user != nil
+}
+
+// FromContext returns CurrentUser contained in given context, or an
+// anonymous user when there is none
 func FromContext(ctx context.Context) *CurrentUser {
-	user, _ := ctx.Value(Key).(*CurrentUser)
+	user, ok := Lookup(ctx)
+	if !ok {
+		return &CurrentUser{}
+	}
 
 	honeybadger.SetContext(honeybadger.Context{
 		"user_id":       user.ID,
@@ -59,19 +111,39 @@ func FromContext(ctx context.Context) *CurrentUser {
 	return user
 }
 
+// IsAnonymous reports whether user is not logged in
+func (user *CurrentUser) IsAnonymous() bool {
+	return user == nil || user.ID == 0
+}
+
 // Platform returns given user's platform type
 func (user *CurrentUser) Platform() string {
+	if user == nil {
+		return ""
+	}
 	switch strconv.Itoa(user.applicationID) {
 	case os.Getenv("GKKKB_ANDROID_APP_ID"):
-		return "gkkkbandroid"
+		return PlatformAndroid
 	case os.Getenv("GKKKB_IOS_APP_ID"):
-		return "gkkkbios"
+		return PlatformIOS
 	}
 	return ""
 }
 
 // AppVersion returns given user's platform version
 func (user *CurrentUser) AppVersion() int {
+	if user == nil {
+		return 0
+	}
 	av, _ := strconv.Atoi(user.appVersion)
 	return av
 }
+
+// AppVersionName returns given user's GKKKB-App-Version header as sent,
+// such as 1.10.0
+func (user *CurrentUser) AppVersionName() string {
+	if user == nil {
+		return ""
+	}
+	return strings.TrimSpace(user.appVersion)
+}
@@ -0,0 +1,40 @@
+package currentuser
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/resource"
+)
+
+func TestFromContextWithoutUser(t *testing.T) {
+	for name, ctx := range map[string]context.Context{
+		"background": context.Background(),
+		"job":        resource.NewJobContext(context.Background(), "filegc"),
+		"nil user":   NewContext(context.Background(), nil),
+	} {
+		if _, ok := Lookup(ctx); ok {
+			t.Errorf("%s: Lookup found a user", name)
+		}
+
+		user := FromContext(ctx)
+		if user == nil {
+			t.Fatalf("%s: FromContext returned nil", name)
+		}
+		if !user.IsAnonymous() {
+			t.Errorf("%s: user %d is not anonymous", name, user.ID)
+		}
+		if user.Platform() != "" || user.AppVersion() != 0 {
+			t.Errorf("%s: platform %q version %d, want none", name, user.Platform(), user.AppVersion())
+		}
+	}
+}
+
+func TestFromContextInJob(t *testing.T) {
+	ctx := NewContext(context.Background(), &CurrentUser{ID: 7})
+	ctx = resource.NewJobContext(ctx, "transfer")
+
+	if user := FromContext(ctx); user.ID != 7 {
+		t.Errorf("user %d, want 7", user.ID)
+	}
+}
@@ -0,0 +1,132 @@
+package currentuser
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrInvalidToken is returned for a bearer token which is malformed,
+	// expired or whose signature does not verify
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrNoTokenKey is returned when verifying a token without the key of its algorithm
+	ErrNoTokenKey = errors.New("AUTH_TOKEN_SECRET or AUTH_TOKEN_PUBLIC_KEY is not set")
+)
+
+// verifiedClaims returns the payload of the bearer token of r once its
+// signature is verified, with AUTH_TOKEN_SECRET for HS256 tokens or the PEM
+// encoded AUTH_TOKEN_PUBLIC_KEY for RS256 ones. Any other algorithm, none
+// included, is rejected.
+func verifiedClaims(r *http.Request) ([]byte, error) {
+	parts := strings.Split(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "), ".")
+	if len(parts) != 3 {
+		return nil, ErrInvalidToken
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[2], "="))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch header.Alg {
+	case "HS256":
+		secret := os.Getenv("AUTH_TOKEN_SECRET")
+		if secret == "" {
+			return nil, ErrNoTokenKey
+		}
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, ErrInvalidToken
+		}
+	case "RS256":
+		key, err := publicKey()
+		if err != nil {
+			return nil, err
+		}
+		sum := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, sum[:], signature); err != nil {
+			return nil, ErrInvalidToken
+		}
+	default:
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if claims.Exp != 0 && time.Now().Unix() >= claims.Exp {
+		return nil, ErrInvalidToken
+	}
+	return payload, nil
+}
+
+// CheckKeys returns an error unless AUTH_TOKEN_SECRET or a valid
+// AUTH_TOKEN_PUBLIC_KEY is set, so servers refuse to start rather than
+// reject every request
+func CheckKeys() error {
+	if os.Getenv("AUTH_TOKEN_SECRET") != "" {
+		return nil
+	}
+	if os.Getenv("AUTH_TOKEN_PUBLIC_KEY") == "" {
+		return ErrNoTokenKey
+	}
+	_, err := publicKey()
+	return err
+}
+
+// publicKey returns the RSA key of AUTH_TOKEN_PUBLIC_KEY
+func publicKey() (*rsa.PublicKey, error) {
+	block, _ := pem.Decode([]byte(os.Getenv("AUTH_TOKEN_PUBLIC_KEY")))
+	if block == nil {
+		return nil, ErrNoTokenKey
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, ErrNoTokenKey
+	}
+	return rsaKey, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(segment, "="))
+	if err != nil {
+		return ErrInvalidToken
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return ErrInvalidToken
+	}
+	return nil
+}
@@ -0,0 +1,160 @@
+package currentuser
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "currentuser-test-secret"
+
+func encodeSegment(t *testing.T, v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func hs256(t *testing.T, secret string, claims map[string]interface{}) string {
+	unsigned := encodeSegment(t, map[string]string{"alg": "HS256", "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func claimsOf(token string) ([]byte, error) {
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Authorization", "Bearer "+token)
+	return verifiedClaims(r)
+}
+
+func TestBranchClaim(t *testing.T) {
+	t.Setenv("AUTH_TOKEN_SECRET", testSecret)
+	t.Setenv("DEFAULT_BRANCH_ID", "1")
+
+	cases := []struct {
+		name   string
+		claims map[string]interface{}
+		want   uint
+	}{
+		{"top level", map[string]interface{}{"branch_id": 3}, 3},
+		{"resource owner", map[string]interface{}{"resource_owner": map[string]interface{}{"branch_id": 4}}, 4},
+		{"issued before branches", map[string]interface{}{"resource_owner": map[string]interface{}{"id": 7}}, 1},
+	}
+	for _, c := range cases {
+		claims, err := claimsOf(hs256(t, testSecret, c.claims))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if got := branchClaim(claims); got != c.want {
+			t.Errorf("%s: branch %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestVerifiedClaimsRejects(t *testing.T) {
+	t.Setenv("AUTH_TOKEN_SECRET", testSecret)
+
+	valid := hs256(t, testSecret, map[string]interface{}{"branch_id": 3})
+	forged := hs256(t, "another-secret", map[string]interface{}{"branch_id": 3})
+	none := encodeSegment(t, map[string]string{"alg": "none"}) + "." + encodeSegment(t, map[string]interface{}{"branch_id": 3}) + "."
+	expired := hs256(t, testSecret, map[string]interface{}{"branch_id": 3, "exp": time.Now().Add(-time.Minute).Unix()})
+
+	// a payload swapped under a valid signature must not verify
+	tampered := hs256(t, testSecret, map[string]interface{}{"branch_id": 3})
+	parts := strings.Split(tampered, ".")
+	tampered = parts[0] + "." + encodeSegment(t, map[string]interface{}{"branch_id": 9}) + "." + parts[2]
+
+	for name, token := range map[string]string{
+		"forged":    forged,
+		"alg none":  none,
+		"expired":   expired,
+		"tampered":  tampered,
+		"malformed": "not-a-token",
+	} {
+		if _, err := claimsOf(token); err != ErrInvalidToken {
+			t.Errorf("%s: got %v, want %v", name, err, ErrInvalidToken)
+		}
+	}
+
+	t.Setenv("AUTH_TOKEN_SECRET", "")
+	if _, err := claimsOf(valid); err != ErrNoTokenKey {
+		t.Errorf("without secret: got %v, want %v", err, ErrNoTokenKey)
+	}
+}
+
+func TestVerifiedClaimsRS256(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("AUTH_TOKEN_PUBLIC_KEY", string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})))
+	t.Setenv("AUTH_TOKEN_SECRET", "")
+
+	unsigned := encodeSegment(t, map[string]string{"alg": "RS256"}) + "." + encodeSegment(t, map[string]interface{}{"branch_id": 5})
+	sum := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := claimsOf(unsigned + "." + base64.RawURLEncoding.EncodeToString(signature))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := branchClaim(claims); got != 5 {
+		t.Errorf("branch %d, want 5", got)
+	}
+
+	// an HS256 token signed with the public key must not pass as RS256
+	confused := hs256(t, string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})), map[string]interface{}{"branch_id": 5})
+	if _, err := claimsOf(confused); err == nil {
+		t.Error("HS256 token signed with the public key verified")
+	}
+}
+
+func TestCheckKeys(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicPEM := string(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	cases := []struct {
+		name      string
+		secret    string
+		publicKey string
+		valid     bool
+	}{
+		{"none", "", "", false},
+		{"secret", testSecret, "", true},
+		{"public key", "", publicPEM, true},
+		{"malformed public key", "", "not a key", false},
+	}
+	for _, c := range cases {
+		t.Setenv("AUTH_TOKEN_SECRET", c.secret)
+		t.Setenv("AUTH_TOKEN_PUBLIC_KEY", c.publicKey)
+		if err := CheckKeys(); (err == nil) != c.valid {
+			t.Errorf("%s: CheckKeys() = %v, want valid %v", c.name, err, c.valid)
+		}
+	}
+}
@@ -1,15 +1,19 @@
 package api
 
 import (
+	"context"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
+	"github.com/gkkkb/pokedex/pkg/api/request"
 	"github.com/gkkkb/pokedex/pkg/api/response"
 	"github.com/gkkkb/pokedex/pkg/constants"
 	"github.com/gkkkb/pokedex/pkg/currentuser" 
 	"github.com/gkkkb/pokedex/pkg/log"
 	"github.com/gkkkb/pokedex/pkg/resource"
+	"github.com/gkkkb/pokedex/pkg/tenant"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -18,13 +22,22 @@ import (
 // https://github.com/bukalapak/packen/tree/master/middleware
 type HandleWithError func(http.ResponseWriter, *http.Request, httprouter.Params) error
 
-func newHandle(action string, security Authority, handle HandleWithError) (string, HandleWithError) {
+func newHandle(action string, security Authority, constraint Constraint, handle HandleWithError) (string, HandleWithError) {
 	return action, func(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
 
 		startTime := time.Now()
-		rID := r.Context().Value("X-Request-ID").(string)
+		rID, _ := r.Context().Value("X-Request-ID").(string)
+		if rID == "" {
+			rID = request.CreateRequestID()
+		}
 		ctx := resource.NewContext(r.Context(), rID, action, startTime)
 
+		// anonymous routes, such as the tus preflight, also serve requests
+		// without a token, acting for no user and no branch
+		if security == Anonymous && r.Header.Get("Authorization") == "" {
+			return handle(w, r.WithContext(ctx), params)
+		}
+
 		currentUser, err := currentuser.FromRequest(r)
 		if err != nil {
 			log.ErrLog(ctx, err, "authorization", "authorize fail")
@@ -39,6 +52,26 @@ func newHandle(action string, security Authority, handle HandleWithError) (strin
 			return response.UserUnauthorizedError
 		}
 
+		if err := constraint.check(action, currentUser); err != nil {
+			ce := err.(response.CustomError)
+			response.Write(w, response.BuildError([]error{ce}), ce.HTTPCode)
+			return ce
+		}
+
+		branchID, err := activeBranch(r, currentUser)
+		if err != nil {
+			ce := err.(response.CustomError)
+			response.Write(w, response.BuildError([]error{ce}), ce.HTTPCode)
+			return ce
+		}
+		ctx = tenant.NewContext(ctx, branchID)
+
+		if timeout, err := strconv.Atoi(os.Getenv("API_TIMEOUT")); err == nil && timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, time.Duration(timeout)*time.Second)
+			defer cancel()
+		}
+
 		r = r.WithContext(ctx)
 		return handle(w, r, params)
 	}
@@ -61,6 +94,8 @@ func newInternalHandle(action string, security Authority, handle HandleWithError
 			return response.UserUnauthorizedError
 		}
 
+		// internal routes act for no user and reach every branch
+		r = r.WithContext(tenant.Unscoped(r.Context()))
 		return handle(w, r, params)
 	}
 }
@@ -77,7 +112,7 @@ func isRequestAuthorized(security Authority, currentUser *currentuser.CurrentUse
 }
 
 func isRoleAllowed(role string) bool {
-	return isInSliceString(role, []string{constants.ROLE_ADM})
+	return isInSliceString(role, []string{constants.ROLE_ADM, constants.ROLE_SUPER_ADM})
 }
 
 func isUserLoggedIn(userID uint) bool {
@@ -0,0 +1,38 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/api/response"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestNewHandleWithoutToken(t *testing.T) {
+	cases := []struct {
+		name     string
+		security Authority
+		status   int
+		called   bool
+	}{
+		{"anonymous", Anonymous, http.StatusNoContent, true},
+		{"user", User, response.InvalidTokenError.HTTPCode, false},
+		{"admin", Admin, response.InvalidTokenError.HTTPCode, false},
+	}
+	for _, c := range cases {
+		called := false
+		_, handle := newHandle("call-test", c.security, Constraint{}, func(w http.ResponseWriter, r *http.Request, _ httprouter.Params) error {
+			called = true
+			w.WriteHeader(http.StatusNoContent)
+			return nil
+		})
+
+		w := httptest.NewRecorder()
+		handle(w, httptest.NewRequest("OPTIONS", "/uploads", nil), nil)
+		if w.Code != c.status || called != c.called {
+			t.Errorf("%s: status %d, handler called %v, want %d, %v", c.name, w.Code, called, c.status, c.called)
+		}
+	}
+}
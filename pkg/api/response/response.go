@@ -27,6 +27,13 @@ var (
 		Code:     10202,
 		HTTPCode: http.StatusConflict,
 	}
+	// VersionConflictError represents an update based on an outdated version,
+	// Data holds the current record
+	VersionConflictError = CustomError{
+		Message:  "Record has been modified",
+		Code:     10203,
+		HTTPCode: http.StatusConflict,
+	}
 	// ProposalStatusConflictError represents new status for proposal not acceptable
 	ProposalNewStatusError = CustomError{
 		Message:  "Status not acceptable",
@@ -99,6 +106,60 @@ var (
 		Code:     10220,
 		HTTPCode: http.StatusNotFound,
 	}
+	// ProfileNotExistsError represents Profile not found error
+	ProfileNotExistsError = CustomError{
+		Message:  "Profile not found",
+		Code:     10221,
+		HTTPCode: http.StatusNotFound,
+	}
+	// DocumentNotExistsError represents Document not found error
+	DocumentNotExistsError = CustomError{
+		Message:  "Document not found",
+		Code:     10223,
+		HTTPCode: http.StatusNotFound,
+	}
+	// HouseholdNotExistsError represents Household not found error
+	HouseholdNotExistsError = CustomError{
+		Message:  "Household not found",
+		Code:     10224,
+		HTTPCode: http.StatusNotFound,
+	}
+	// TransferNotExistsError represents Transfer not found error
+	TransferNotExistsError = CustomError{
+		Message:  "Transfer not found",
+		Code:     10225,
+		HTTPCode: http.StatusNotFound,
+	}
+	// TransferExistsError represents member already having a transfer in progress
+	TransferExistsError = CustomError{
+		Message:  "Transfer exists",
+		Code:     10226,
+		HTTPCode: http.StatusConflict,
+	}
+	// RegistryFileNotExistsError represents Registry file not found error
+	RegistryFileNotExistsError = CustomError{
+		Message:  "Registry file not found",
+		Code:     10227,
+		HTTPCode: http.StatusNotFound,
+	}
+	// TransferImportedError represents transfer package imported before
+	TransferImportedError = CustomError{
+		Message:  "Transfer already imported",
+		Code:     10228,
+		HTTPCode: http.StatusConflict,
+	}
+	// PrivateDocumentNotExistsError represents Private document not found error
+	PrivateDocumentNotExistsError = CustomError{
+		Message:  "Private document not found",
+		Code:     10229,
+		HTTPCode: http.StatusNotFound,
+	}
+	// ErasureRequestNotExistsError represents Erasure request not found error
+	ErasureRequestNotExistsError = CustomError{
+		Message:  "Erasure request not found",
+		Code:     10222,
+		HTTPCode: http.StatusNotFound,
+	}
 
 	// InvalidTokenError represents Invalid token error
 	InvalidTokenError = CustomError{
@@ -133,6 +194,25 @@ var (
 		HTTPCode: http.StatusBadRequest,
 	}
 
+	// AppUpdateRequiredError represents client app version below the minimum required
+	AppUpdateRequiredError = CustomError{
+		Message:  "Please update your app",
+		Code:     10006,
+		HTTPCode: http.StatusUpgradeRequired,
+	}
+	// PlatformNotAllowedError represents client platform not allowed to call the API
+	PlatformNotAllowedError = CustomError{
+		Message:  "Platform not allowed",
+		Code:     10007,
+		HTTPCode: http.StatusForbidden,
+	}
+	// BranchNotAllowedError represents user accessing a branch other than their own
+	BranchNotAllowedError = CustomError{
+		Message:  "Branch not allowed",
+		Code:     10008,
+		HTTPCode: http.StatusForbidden,
+	}
+
 	// InvalidFileTypeError represents Uploaded file type not supported
 	InvalidFileTypeError = CustomError{
 		Message:  "File type not supported",
@@ -146,6 +226,33 @@ var (
 		HTTPCode: http.StatusNotAcceptable,
 	}
 
+	// UploadNotExistsError represents uploaded file not found in storage
+	UploadNotExistsError = CustomError{
+		Message:  "Uploaded file not found",
+		Code:     71004,
+		HTTPCode: http.StatusNotFound,
+	}
+
+	// UploadOffsetConflictError represents resumable upload chunk not starting at the current offset
+	UploadOffsetConflictError = CustomError{
+		Message:  "Upload offset conflict",
+		Code:     71005,
+		HTTPCode: http.StatusConflict,
+	}
+	// FileTooLargeError represents file exceeding the size limit of its purpose
+	FileTooLargeError = CustomError{
+		Message:  "File too large",
+		Code:     71006,
+		HTTPCode: http.StatusRequestEntityTooLarge,
+	}
+
+	// InvalidTransferPackageError represents transfer package that is malformed, tampered or from an untrusted church
+	InvalidTransferPackageError = CustomError{
+		Message:  "Invalid transfer package",
+		Code:     71007,
+		HTTPCode: http.StatusUnprocessableEntity,
+	}
+
 	//OfflineProposalCsvError represents error on offline proposals csv
 	OfflineProposalCsvError = CustomError{
 		Message:  "Invalid Offline Proposal CSV File",
@@ -174,6 +281,7 @@ type MetaInfo struct {
 // ErrorBody holds data for error response
 type ErrorBody struct {
 	Errors []ErrorInfo `json:"errors"`
+	Data   interface{} `json:"data,omitempty"`
 	Meta   interface{} `json:"meta"`
 }
 
@@ -190,6 +298,8 @@ type CustomError struct {
 	Field    string
 	Code     int
 	HTTPCode int
+	// Data is written along the error, e.g. the current record on conflicts
+	Data interface{}
 }
 
 // Error is a function to convert error to string.
@@ -231,6 +341,7 @@ func BuildError(errors []error) ErrorBody {
 				Field:   ce.Field,
 			},
 		},
+		Data: ce.Data,
 		Meta: MetaInfo{
 			HTTPStatus: ce.HTTPCode,
 		},
@@ -270,6 +381,9 @@ func BuildErrors(errors []error) ErrorBody {
 
 // BuildErrorAndStatus is a function to Differentiate Error and create Error Body and Response Status Code
 func BuildErrorAndStatus(err error, fieldName string) (ErrorBody, int) {
+	if ce, ok := err.(CustomError); ok {
+		return BuildError([]error{ce}), ce.HTTPCode
+	}
 
 	if strings.Contains(err.Error(), "strconv.ParseInt: parsing") ||
 		strings.Contains(err.Error(), "strconv.Atoi: parsing") ||
@@ -325,6 +439,34 @@ func BuildErrorAndStatus(err error, fieldName string) (ErrorBody, int) {
 		return BuildError([]error{VariantOnLocationNotExistsError}), VariantOnLocationNotExistsError.HTTPCode
 	} else if strings.Contains(err.Error(), CityNotExistsError.Message) {
 		return BuildError([]error{CityNotExistsError}), CityNotExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), UploadNotExistsError.Message) {
+		return BuildError([]error{UploadNotExistsError}), UploadNotExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), ProfileNotExistsError.Message) {
+		return BuildError([]error{ProfileNotExistsError}), ProfileNotExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), DocumentNotExistsError.Message) {
+		return BuildError([]error{DocumentNotExistsError}), DocumentNotExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), HouseholdNotExistsError.Message) {
+		return BuildError([]error{HouseholdNotExistsError}), HouseholdNotExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), ErasureRequestNotExistsError.Message) {
+		return BuildError([]error{ErasureRequestNotExistsError}), ErasureRequestNotExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), TransferNotExistsError.Message) {
+		return BuildError([]error{TransferNotExistsError}), TransferNotExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), TransferExistsError.Message) {
+		return BuildError([]error{TransferExistsError}), TransferExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), TransferImportedError.Message) {
+		return BuildError([]error{TransferImportedError}), TransferImportedError.HTTPCode
+	} else if strings.Contains(err.Error(), PrivateDocumentNotExistsError.Message) {
+		return BuildError([]error{PrivateDocumentNotExistsError}), PrivateDocumentNotExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), RegistryFileNotExistsError.Message) {
+		return BuildError([]error{RegistryFileNotExistsError}), RegistryFileNotExistsError.HTTPCode
+	} else if strings.Contains(err.Error(), "too large") {
+		return BuildError([]error{FileTooLargeError}), FileTooLargeError.HTTPCode
+	} else if strings.Contains(err.Error(), "unknown image variant") {
+		pe := InvalidParameterError
+		pe.Field = fieldName
+		return BuildError([]error{pe}), InvalidParameterError.HTTPCode
+	} else if strings.Contains(err.Error(), "transfer package") {
+		return BuildError([]error{InvalidTransferPackageError}), InvalidTransferPackageError.HTTPCode
 	}
 
 	return BuildError([]error{ErrTetapTenangTetapSemangat}), ErrTetapTenangTetapSemangat.HTTPCode
@@ -0,0 +1,32 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestBuildErrorAndStatusCustomError(t *testing.T) {
+	ce := InvalidParameterError
+	ce.Field = "profile_id"
+
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{UserUnauthorizedError, UserUnauthorizedError.HTTPCode},
+		{ce, http.StatusUnprocessableEntity},
+		{errors.New("User not authorized"), UserUnauthorizedError.HTTPCode},
+		{errors.New("Transfer already imported"), http.StatusConflict},
+		{errors.New("Private document not found"), http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		body, status := BuildErrorAndStatus(tt.err, "")
+		if status != tt.status {
+			t.Errorf("BuildErrorAndStatus(%v) status = %d, want %d", tt.err, status, tt.status)
+		}
+		if len(body.Errors) != 1 {
+			t.Errorf("BuildErrorAndStatus(%v) errors = %v, want one", tt.err, body.Errors)
+		}
+	}
+}
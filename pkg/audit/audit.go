@@ -0,0 +1,17 @@
+package audit
+
+import (
+	"context"
+
+	"github.com/gkkkb/pokedex/pkg/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Record writes an audit log entry in the branch of ctx
+func Record(ctx context.Context, db sqlx.ExecerContext, actorID uint, action, subjectType string, subjectID uint, detail string) error {
+	_, err := db.ExecContext(ctx,
+		"INSERT INTO audit_logs (branch_id, actor_id, action, subject_type, subject_id, detail) VALUES (?, ?, ?, ?, ?, ?)",
+		tenant.FromContext(ctx), actorID, action, subjectType, subjectID, detail)
+	return err
+}
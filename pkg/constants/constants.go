@@ -2,5 +2,7 @@ package constants
 
 const (
 	//User Roles
-	ROLE_ADM   = "ADM"
-)
\ No newline at end of file
+	ROLE_ADM = "ADM"
+	// ROLE_SUPER_ADM administers every church branch
+	ROLE_SUPER_ADM = "SADM"
+)
@@ -0,0 +1,83 @@
+// Package document keeps versioned attachments of profiles
+package document
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Document types
+const (
+	TypeCertificate    = "certificate"
+	TypeTransferLetter = "transfer_letter"
+	TypeConsentForm    = "consent_form"
+	TypeOther          = "other"
+)
+
+// Types lists every accepted document type
+var Types = []string{TypeCertificate, TypeTransferLetter, TypeConsentForm, TypeOther}
+
+var (
+	// ErrDocumentNotFound is returned when a document or version does not exist
+	ErrDocumentNotFound = errors.New("Document not found")
+	// ErrInvalidType is returned for a document type outside Types
+	ErrInvalidType = errors.New("Invalid document type")
+)
+
+// Document is an attachment of a profile, its content kept in versions
+type Document struct {
+	ID        uint      `db:"id" json:"id"`
+	BranchID  uint      `db:"branch_id" json:"branch_id"`
+	ProfileID uint      `db:"profile_id" json:"profile_id"`
+	Type      string    `db:"type" json:"type"`
+	Title     string    `db:"title" json:"title"`
+	CreatedBy uint      `db:"created_by" json:"created_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+
+	Latest *Version `db:"-" json:"latest_version,omitempty"`
+}
+
+// Version is an uploaded revision of a document
+type Version struct {
+	ID           uint      `db:"id" json:"id"`
+	DocumentID   uint      `db:"document_id" json:"document_id"`
+	Version      uint      `db:"version" json:"version"`
+	Filename     string    `db:"filename" json:"-"`
+	OriginalName string    `db:"original_name" json:"original_name"`
+	ContentType  string    `db:"content_type" json:"content_type"`
+	Size         int64     `db:"size" json:"size"`
+	UploadedBy   uint      `db:"uploaded_by" json:"uploaded_by"`
+	CreatedAt    time.Time `db:"created_at" json:"uploaded_at"`
+}
+
+// Upload is a file uploaded as a document version
+type Upload struct {
+	File         io.Reader
+	OriginalName string
+	Size         int64
+	UploadedBy   uint
+}
+
+// Prefix returns storage prefix of given document's versions
+func Prefix(profileID uint, documentID uint) string {
+	return fmt.Sprintf("documents/profiles/%d/%d", profileID, documentID)
+}
+
+// StagingPrefix returns storage prefix new documents of given profile are
+// put under until their id is known
+func StagingPrefix(profileID uint) string {
+	return fmt.Sprintf("documents/profiles/%d/staging", profileID)
+}
+
+// IsValidType reports whether docType is one of Types
+func IsValidType(docType string) bool {
+	for _, t := range Types {
+		if t == docType {
+			return true
+		}
+	}
+	return false
+}
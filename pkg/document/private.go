@@ -0,0 +1,23 @@
+package document
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrPrivateDocumentNotFound is returned when a private document does not exist
+var ErrPrivateDocumentNotFound = errors.New("Private document not found")
+
+// Private is an encrypted document of a profile, stored once without
+// versions under profile.PrivateDocumentPrefix
+type Private struct {
+	ID           uint      `db:"id" json:"id"`
+	BranchID     uint      `db:"branch_id" json:"branch_id"`
+	ProfileID    uint      `db:"profile_id" json:"profile_id"`
+	Filename     string    `db:"filename" json:"filename"`
+	OriginalName string    `db:"original_name" json:"original_name"`
+	ContentType  string    `db:"content_type" json:"content_type"`
+	Size         int64     `db:"size" json:"size"`
+	UploadedBy   uint      `db:"uploaded_by" json:"uploaded_by"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
@@ -0,0 +1,376 @@
+// Package filegc deletes stored files no longer referenced by the database
+package filegc
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/log"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/registry"
+	"github.com/gkkkb/pokedex/pkg/resource"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+	"github.com/gkkkb/pokedex/pkg/transfer"
+	"github.com/gkkkb/pokedex/pkg/upload"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// listPageSize is how many objects are listed per storage call
+const listPageSize = 1000
+
+var logger = log.Package("filegc")
+
+var (
+	reclaimedBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pokedex_filegc_reclaimed_bytes_total",
+		Help: "Bytes of orphaned files deleted by the file garbage collector",
+	}, []string{"prefix"})
+	deletedFiles = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "pokedex_filegc_deleted_files_total",
+		Help: "Orphaned files deleted by the file garbage collector",
+	}, []string{"prefix"})
+	orphanedFiles = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "pokedex_filegc_orphaned_files",
+		Help: "Orphaned files found by the last sweep, deleted or not",
+	}, []string{"prefix"})
+)
+
+func init() {
+	prometheus.MustRegister(reclaimedBytes, deletedFiles, orphanedFiles)
+}
+
+// Stores a source may live in
+const (
+	// StorePublic holds profile photos
+	StorePublic = "public"
+	// StorePrivate holds unencrypted private files
+	StorePrivate = "private"
+	// StoreDocuments holds encrypted documents and upload chunks
+	StoreDocuments = "documents"
+)
+
+// Stores maps store names of sources to their storage
+type Stores map[string]storage.StorageInterface
+
+// Source is a storage prefix whose files are referenced from the database
+type Source struct {
+	Prefix string
+	// Store is the name of the store Prefix lives in
+	Store string
+	// Referenced returns every object name under Prefix still in use
+	Referenced func(ctx context.Context, db *sqlx.DB) (map[string]bool, error)
+}
+
+// Sources are swept by default, every prefix written by the app is listed
+// so no file outlives its record
+var Sources = []Source{
+	{Prefix: "profiles", Store: StorePublic, Referenced: referencedPhotos},
+	{Prefix: "documents", Store: StoreDocuments, Referenced: referencedDocuments},
+	{Prefix: "private", Store: StoreDocuments, Referenced: referencedPrivateDocuments},
+	{Prefix: "transfers", Store: StoreDocuments, Referenced: referencedTransferPackages},
+	{Prefix: "uploads", Store: StoreDocuments, Referenced: referencedChunks},
+	{Prefix: registry.Prefix, Store: StorePrivate, Referenced: referencedRegistryFiles},
+}
+
+// Config controls a sweep
+type Config struct {
+	// GracePeriod keeps files until they have been found unreferenced for
+	// that long, so uploads not yet confirmed are not collected
+	GracePeriod time.Duration
+	// DryRun only reports orphaned files without deleting them
+	DryRun bool
+}
+
+// ConfigFromEnv reads FILE_GC_GRACE_PERIOD and FILE_GC_DRY_RUN
+func ConfigFromEnv() Config {
+	grace, err := time.ParseDuration(os.Getenv("FILE_GC_GRACE_PERIOD"))
+	if err != nil {
+		grace = 72 * time.Hour
+	}
+
+	dryRun, err := strconv.ParseBool(os.Getenv("FILE_GC_DRY_RUN"))
+	if err != nil {
+		dryRun = true
+	}
+
+	return Config{GracePeriod: grace, DryRun: dryRun}
+}
+
+// Orphan is a stored file without database reference
+type Orphan struct {
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modified_at"`
+	// FirstSeenAt is when a sweep first found the file unreferenced
+	FirstSeenAt time.Time `json:"first_seen_at"`
+	Deleted     bool      `json:"deleted"`
+}
+
+// Report summarizes a sweep
+type Report struct {
+	DryRun         bool     `json:"dry_run"`
+	Scanned        int      `json:"scanned"`
+	Orphans        []Orphan `json:"orphans"`
+	ReclaimedBytes int64    `json:"reclaimed_bytes"`
+}
+
+// Sweep lists every file under sources and deletes those found unreferenced
+// for longer than the grace period. When a file was first found so is kept
+// in file_orphans, dry runs included, since the time of an object says
+// nothing about when its record went away.
+func Sweep(ctx context.Context, db *sqlx.DB, stores Stores, sources []Source, cfg Config) (Report, error) {
+	report := Report{DryRun: cfg.DryRun, Orphans: []Orphan{}}
+	sweepID := uuid.New().String()
+	now := time.Now().UTC().Truncate(time.Second)
+	cutoff := now.Add(-cfg.GracePeriod)
+
+	for _, src := range sources {
+		store, ok := stores[src.Store]
+		if !ok {
+			return report, fmt.Errorf("filegc: no %s store for prefix %s", src.Store, src.Prefix)
+		}
+
+		referenced, err := src.Referenced(ctx, db)
+		if err != nil {
+			return report, err
+		}
+
+		orphans := 0
+		marker := ""
+		for {
+			infos, next, err := store.List(src.Prefix, marker, listPageSize)
+			if err != nil {
+				return report, err
+			}
+
+			unreferenced := []storage.FileInfo{}
+			for _, info := range infos {
+				report.Scanned++
+				if !referenced[info.Name] {
+					unreferenced = append(unreferenced, info)
+				}
+			}
+
+			firstSeen, err := recordOrphans(ctx, db, src.Store, unreferenced, sweepID, now)
+			if err != nil {
+				return report, err
+			}
+
+			for _, info := range unreferenced {
+				seen, ok := firstSeen[info.Name]
+				if !ok || seen.After(cutoff) {
+					continue
+				}
+
+				orphans++
+				orphan := Orphan{Name: info.Name, Size: info.Size, ModTime: info.ModTime, FirstSeenAt: seen}
+				if !cfg.DryRun {
+					if err := store.Delete("", info.Name); err != nil {
+						return report, err
+					}
+					if _, err := db.ExecContext(ctx, "DELETE FROM file_orphans WHERE store = ? AND name = ?", src.Store, info.Name); err != nil {
+						return report, err
+					}
+					orphan.Deleted = true
+					report.ReclaimedBytes += info.Size
+					reclaimedBytes.WithLabelValues(src.Prefix).Add(float64(info.Size))
+					deletedFiles.WithLabelValues(src.Prefix).Inc()
+				}
+				report.Orphans = append(report.Orphans, orphan)
+			}
+
+			if next == "" {
+				break
+			}
+			marker = next
+		}
+
+		// files not found unreferenced by this sweep were referenced again
+		// or deleted, a later orphaning starts a new grace period
+		if _, err := db.ExecContext(ctx, "DELETE FROM file_orphans WHERE store = ? AND name LIKE ? AND sweep_id != ?", src.Store, src.Prefix+"/%", sweepID); err != nil {
+			return report, err
+		}
+
+		orphanedFiles.WithLabelValues(src.Prefix).Set(float64(orphans))
+	}
+
+	return report, nil
+}
+
+// recordOrphans records infos of store as found unreferenced by the sweep
+// sweepID at now and returns when each was first found so
+func recordOrphans(ctx context.Context, db *sqlx.DB, store string, infos []storage.FileInfo, sweepID string, now time.Time) (map[string]time.Time, error) {
+	firstSeen := map[string]time.Time{}
+	if len(infos) == 0 {
+		return firstSeen, nil
+	}
+
+	names := make([]string, len(infos))
+	values := make([]string, len(infos))
+	args := make([]interface{}, 0, 4*len(infos))
+	for i, info := range infos {
+		names[i] = info.Name
+		values[i] = "(?, ?, ?, ?)"
+		args = append(args, store, info.Name, now, sweepID)
+	}
+	if _, err := db.ExecContext(ctx, "INSERT INTO file_orphans (store, name, first_seen_at, sweep_id) VALUES "+strings.Join(values, ", ")+" ON DUPLICATE KEY UPDATE sweep_id = VALUES(sweep_id)", args...); err != nil {
+		return nil, err
+	}
+
+	query, args, err := sqlx.In("SELECT name, first_seen_at FROM file_orphans WHERE store = ? AND name IN (?)", store, names)
+	if err != nil {
+		return nil, err
+	}
+	rows := []struct {
+		Name        string    `db:"name"`
+		FirstSeenAt time.Time `db:"first_seen_at"`
+	}{}
+	if err := db.SelectContext(ctx, &rows, query, args...); err != nil {
+		return nil, err
+	}
+
+	for _, r := range rows {
+		firstSeen[r.Name] = r.FirstSeenAt
+	}
+	return firstSeen, nil
+}
+
+// referencedPhotos returns photos of live profiles along with their variants
+func referencedPhotos(ctx context.Context, db *sqlx.DB) (map[string]bool, error) {
+	rows := []struct {
+		ID    uint   `db:"id"`
+		Photo string `db:"photo"`
+	}{}
+	if err := db.SelectContext(ctx, &rows, "SELECT id, photo FROM profiles WHERE photo != '' AND deleted_at IS NULL"); err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, r := range rows {
+		prefix := profile.PhotoPrefix(r.ID)
+		referenced[prefix+"/"+r.Photo] = true
+		for _, v := range storage.Variants {
+			referenced[prefix+"/"+storage.VariantName(r.Photo, v.Name)] = true
+		}
+	}
+	return referenced, nil
+}
+
+// referencedDocuments returns every version of every document, deleted
+// documents included until their erasure removes them
+func referencedDocuments(ctx context.Context, db *sqlx.DB) (map[string]bool, error) {
+	rows := []struct {
+		ProfileID  uint   `db:"profile_id"`
+		DocumentID uint   `db:"document_id"`
+		Filename   string `db:"filename"`
+	}{}
+	if err := db.SelectContext(ctx, &rows, "SELECT d.profile_id, v.document_id, v.filename FROM document_versions v JOIN documents d ON d.id = v.document_id"); err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, r := range rows {
+		referenced[document.Prefix(r.ProfileID, r.DocumentID)+"/"+r.Filename] = true
+	}
+	return referenced, nil
+}
+
+// referencedPrivateDocuments returns private documents of profiles
+func referencedPrivateDocuments(ctx context.Context, db *sqlx.DB) (map[string]bool, error) {
+	rows := []struct {
+		ProfileID uint   `db:"profile_id"`
+		Filename  string `db:"filename"`
+	}{}
+	if err := db.SelectContext(ctx, &rows, "SELECT profile_id, filename FROM private_documents"); err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, r := range rows {
+		referenced[profile.PrivateDocumentPrefix(r.ProfileID)+"/"+r.Filename] = true
+	}
+	return referenced, nil
+}
+
+// referencedTransferPackages returns packages of transfers to another church
+func referencedTransferPackages(ctx context.Context, db *sqlx.DB) (map[string]bool, error) {
+	rows := []struct {
+		ID      uint   `db:"id"`
+		Package string `db:"package"`
+	}{}
+	if err := db.SelectContext(ctx, &rows, "SELECT id, package FROM transfers WHERE package != ''"); err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, r := range rows {
+		referenced[transfer.Prefix(r.ID)+"/"+r.Package] = true
+	}
+	return referenced, nil
+}
+
+// referencedChunks returns chunks of uploads not yet assembled
+func referencedChunks(ctx context.Context, db *sqlx.DB) (map[string]bool, error) {
+	rows := []struct {
+		UploadID string `db:"upload_id"`
+		Filename string `db:"filename"`
+	}{}
+	if err := db.SelectContext(ctx, &rows, "SELECT upload_id, filename FROM upload_chunks"); err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, r := range rows {
+		referenced[upload.ChunkPrefix(r.UploadID)+"/"+r.Filename] = true
+	}
+	return referenced, nil
+}
+
+// referencedRegistryFiles returns every registry file
+func referencedRegistryFiles(ctx context.Context, db *sqlx.DB) (map[string]bool, error) {
+	filenames := []string{}
+	if err := db.SelectContext(ctx, &filenames, "SELECT filename FROM registry_files"); err != nil {
+		return nil, err
+	}
+
+	referenced := map[string]bool{}
+	for _, f := range filenames {
+		referenced[registry.Prefix+"/"+f] = true
+	}
+	return referenced, nil
+}
+
+// Run sweeps sources every interval until ctx is done
+func Run(ctx context.Context, db *sqlx.DB, stores Stores, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job := tenant.Unscoped(resource.NewJobContext(ctx, "filegc"))
+			report, err := Sweep(job, db, stores, Sources, ConfigFromEnv())
+			if err != nil {
+				logger.Error(job, err, "sweep failed", nil)
+				continue
+			}
+			logger.Info(job, "sweep done", log.Fields{
+				"scanned":         report.Scanned,
+				"orphaned":        len(report.Orphans),
+				"reclaimed_bytes": report.ReclaimedBytes,
+				"dry_run":         report.DryRun,
+			})
+		}
+	}
+}
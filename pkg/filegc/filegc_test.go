@@ -0,0 +1,162 @@
+package filegc_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/filegc"
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+	"github.com/gkkkb/pokedex/pkg/upload"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func memory(t *testing.T) storage.StorageInterface {
+	t.Helper()
+
+	store, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	return store
+}
+
+func TestSweepEveryPrefix(t *testing.T) {
+	db := pokedextest.DB(t)
+	pokedextest.LoadFixtures(t, db, "testdata/references.yml")
+	ctx := tenant.NewContext(context.Background(), 1)
+
+	stores := filegc.Stores{
+		filegc.StorePublic:    memory(t),
+		filegc.StorePrivate:   memory(t),
+		filegc.StoreDocuments: memory(t),
+	}
+
+	files := map[string][]string{
+		filegc.StorePublic: {"profiles/9201/current.jpg", "profiles/9201/old.jpg"},
+		filegc.StoreDocuments: {
+			"documents/profiles/9201/9301/kept.pdf", "documents/profiles/9201/staging/orphan.pdf",
+			"private/profiles/9201/kept.pdf", "private/profiles/9201/orphan.pdf",
+			"transfers/9401/kept.zip", "transfers/9401/orphan.zip",
+			"uploads/in-progress/kept", "uploads/in-progress/orphan",
+		},
+		filegc.StorePrivate: {"registry/kept.pdf", "registry/orphan.pdf"},
+	}
+	for name, names := range files {
+		for _, n := range names {
+			if err := stores[name].Put("", n, strings.NewReader("data")); err != nil {
+				t.Fatalf("Put %s: %v", n, err)
+			}
+		}
+	}
+
+	// a photo uploaded with tus is attached to its profile on completion
+	u, err := upload.Create(ctx, db, upload.Purposes[upload.PurposePhoto], 1, 9202, 4, "filename dHVzLmpwZw==", 7)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := upload.Append(ctx, db, stores[filegc.StoreDocuments], stores[filegc.StorePublic], u, 0, strings.NewReader("data")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// a negative grace period makes every file old enough
+	report, err := filegc.Sweep(ctx, db, stores, filegc.Sources, filegc.Config{GracePeriod: -time.Hour})
+	if err != nil {
+		t.Fatalf("Sweep: %v", err)
+	}
+
+	for name, names := range files {
+		for _, n := range names {
+			_, err := stores[name].Stat("", n)
+			if orphan := strings.Contains(n, "orphan") || strings.Contains(n, "old"); orphan != (err == storage.ErrFileNotFound) {
+				t.Errorf("%s: orphan %v, Stat error %v", n, orphan, err)
+			}
+		}
+	}
+	if _, err := stores[filegc.StorePublic].Stat(upload.Purposes[upload.PurposePhoto].Prefix(u), u.Filename); err != nil {
+		t.Errorf("photo uploaded with tus: %v", err)
+	}
+	if len(report.Orphans) != 6 {
+		t.Errorf("%d orphans, want 6: %+v", len(report.Orphans), report.Orphans)
+	}
+}
+
+func TestSweepWithoutStore(t *testing.T) {
+	sources := []filegc.Source{{Prefix: "registry", Store: filegc.StorePrivate}}
+	if _, err := filegc.Sweep(context.Background(), nil, filegc.Stores{}, sources, filegc.Config{}); err == nil {
+		t.Error("Sweep without the store of a source succeeded")
+	}
+}
+
+func TestSweepGracePeriodFromFirstSeen(t *testing.T) {
+	db := pokedextest.DB(t)
+	ctx := tenant.NewContext(context.Background(), 1)
+
+	stores := filegc.Stores{filegc.StorePrivate: memory(t)}
+	sources := []filegc.Source{{Prefix: "registry", Store: filegc.StorePrivate, Referenced: func(ctx context.Context, db *sqlx.DB) (map[string]bool, error) {
+		filenames := []string{}
+		err := db.SelectContext(ctx, &filenames, "SELECT filename FROM registry_files")
+		referenced := map[string]bool{}
+		for _, f := range filenames {
+			referenced["registry/"+f] = true
+		}
+		return referenced, err
+	}}}
+	cfg := filegc.Config{GracePeriod: time.Hour}
+
+	if err := stores[filegc.StorePrivate].Put("registry", "scan.pdf", strings.NewReader("data")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	sweep := func() filegc.Report {
+		report, err := filegc.Sweep(ctx, db, stores, sources, cfg)
+		if err != nil {
+			t.Fatalf("Sweep: %v", err)
+		}
+		return report
+	}
+	backdate := func() {
+		if _, err := db.Exec("UPDATE file_orphans SET first_seen_at = first_seen_at - INTERVAL 2 HOUR"); err != nil {
+			t.Fatalf("backdate: %v", err)
+		}
+	}
+
+	// a file found unreferenced for the first time is kept, however old
+	if report := sweep(); len(report.Orphans) != 0 {
+		t.Fatalf("first sweep orphans %+v, want none", report.Orphans)
+	}
+	backdate()
+
+	// referenced again, it is forgotten and its grace period starts over
+	// once it is unreferenced anew
+	if _, err := db.Exec("INSERT INTO registry_files (branch_id, upload_id, filename, size, created_by) VALUES (1, 'scan', 'scan.pdf', 4, 7)"); err != nil {
+		t.Fatalf("insert registry file: %v", err)
+	}
+	sweep()
+	if _, err := db.Exec("DELETE FROM registry_files WHERE upload_id = 'scan'"); err != nil {
+		t.Fatalf("delete registry file: %v", err)
+	}
+	if report := sweep(); len(report.Orphans) != 0 {
+		t.Fatalf("orphans %+v after the reference went away again, want none", report.Orphans)
+	}
+
+	backdate()
+	report := sweep()
+	if len(report.Orphans) != 1 || !report.Orphans[0].Deleted {
+		t.Fatalf("orphans %+v past the grace period, want registry/scan.pdf deleted", report.Orphans)
+	}
+	if _, err := stores[filegc.StorePrivate].Stat("registry", "scan.pdf"); err != storage.ErrFileNotFound {
+		t.Errorf("Stat after sweep: %v, want %v", err, storage.ErrFileNotFound)
+	}
+
+	var recorded int
+	if err := db.Get(&recorded, "SELECT COUNT(*) FROM file_orphans"); err != nil {
+		t.Fatal(err)
+	}
+	if recorded != 0 {
+		t.Errorf("%d orphans still recorded after deletion, want 0", recorded)
+	}
+}
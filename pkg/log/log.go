@@ -1,65 +1,54 @@
+// Package log is the single structured logger of pokedex. Entries carry
+// request or background job values found in their context and never
+// contain personal data fields listed in Config.Redact. Every function
+// accepts contexts without any of those values.
 package log
 
 import (
 	"context"
 	"fmt"
-	"log"
 	"os"
-	"strconv"
-	"time"
 
-	"github.com/gkkkb/pokedex/pkg/currentuser"
-	"github.com/gkkkb/pokedex/pkg/resource"
-	plog "github.com/gkkkb/piston/log"
+	"github.com/sirupsen/logrus"
 )
 
 // DevLog logs only on development or staging
 func DevLog(v ...interface{}) {
 	if os.Getenv("ENV") == "development" || os.Getenv("ENV") == "staging" {
-		log.Println(v)
+		Default().Log(context.Background(), "", logrus.InfoLevel, fmt.Sprint(v...), nil)
 	}
 }
 
-// ErrLog logs errors with packen.RequestError
+// ErrLog logs err of a request
 func ErrLog(ctx context.Context, err error, category, message string) {
-	if os.Getenv("ENV") != "test" {
-		res := resource.FromContext(ctx)
-		plog.RequestError(fmt.Sprintf("%s", err.Error()), map[string]interface{}{
-			"request_id": res.RequestID,
-			"tags":       append([]string{"post"}, res.Action, category),
-			"message":    message,
-			"duration":   strconv.FormatFloat(time.Since(res.StartTime).Seconds(), 'f', -1, 64),
-		})
+	fields := Fields{"category": category}
+	if err != nil {
+		fields["error"] = err.Error()
 	}
+	Default().Log(ctx, "", logrus.ErrorLevel, message, fields)
 }
 
-// InfoLog logs informations with packen.RequestInfo
+// InfoLog logs informations of a request
 func InfoLog(ctx context.Context, message string, tags ...string) {
-	if os.Getenv("ENV") != "test" {
-		res := resource.FromContext(ctx)
-		user := currentuser.FromContext(ctx)
-		plog.RequestInfo("", map[string]interface{}{
-			"request_id": res.RequestID,
-			"tags":       append([]string{"post"}, tags...),
-			"message":    fmt.Sprintf("%d: %s", user.ID, message),
-			"duration":   strconv.FormatFloat(time.Since(res.StartTime).Seconds(), 'f', -1, 64),
-		})
-	}
+	Default().Log(ctx, "", logrus.InfoLevel, message, Fields{"tags": tags})
 }
 
-// InfoLog logs with additional informations with packen.RequestInfo
+// AdditionalInfoLog logs informations of a request along with mapInfo
 func AdditionalInfoLog(ctx context.Context, message string, mapInfo map[string]interface{}, tags ...string) {
-	if os.Getenv("ENV") != "test" {
-		res := resource.FromContext(ctx)
-		user := currentuser.FromContext(ctx)
-		mapInfo["request_id"] = res.RequestID
-		mapInfo["tags"] = append([]string{"post"}, tags...)
-		mapInfo["message"] = fmt.Sprintf("%d: %s", user.ID, message)
-		mapInfo["duration"] = strconv.FormatFloat(time.Since(res.StartTime).Seconds(), 'f', -1, 64)
-		plog.RequestInfo("", mapInfo)
+	fields := Fields{"tags": tags}
+	for k, v := range mapInfo {
+		fields[k] = v
 	}
+	Default().Log(ctx, "", logrus.InfoLevel, message, fields)
+}
+
+// SlowQueryLog logs a slow database query with fields describing it
+func SlowQueryLog(ctx context.Context, fields map[string]interface{}) {
+	Package("mysql").Warn(ctx, "slow query", fields)
 }
 
+// Fatal logs v then exits
 func Fatal(v ...interface{}) {
-	log.Fatal(v)
+	Default().Log(context.Background(), "", logrus.FatalLevel, fmt.Sprint(v...), nil)
+	os.Exit(1)
 }
@@ -0,0 +1,112 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/resource"
+
+	"github.com/sirupsen/logrus"
+)
+
+// capture makes package level functions write JSON entries to the returned
+// buffer until the test ends
+func capture(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var out bytes.Buffer
+	SetDefault(New(Config{Format: FormatJSON, Level: logrus.DebugLevel, Redact: DefaultRedact, Output: &out}))
+	t.Cleanup(func() { SetDefault(nil) })
+	return &out
+}
+
+// entries decodes every entry written to out
+func entries(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+
+	var all []map[string]interface{}
+	dec := json.NewDecoder(out)
+	for dec.More() {
+		var entry map[string]interface{}
+		if err := dec.Decode(&entry); err != nil {
+			t.Fatalf("entry is not JSON: %v", err)
+		}
+		all = append(all, entry)
+	}
+	return all
+}
+
+// logAll calls every package level helper taking a context
+func logAll(ctx context.Context) {
+	ErrLog(ctx, errors.New("boom"), "test", "error")
+	InfoLog(ctx, "info", "tag")
+	AdditionalInfoLog(ctx, "additional", map[string]interface{}{"phone": "08123456789"}, "tag")
+	SlowQueryLog(ctx, map[string]interface{}{"query": "SELECT 1"})
+	Package("filegc").Error(ctx, errors.New("boom"), "package error", nil)
+}
+
+func TestHelpersWithoutRequest(t *testing.T) {
+	out := capture(t)
+	logAll(context.Background())
+
+	got := entries(t, out)
+	if len(got) != 5 {
+		t.Fatalf("%d entries, want 5", len(got))
+	}
+	for _, entry := range got {
+		for _, field := range []string{"request_id", "action", "job_id", "user_id", "duration"} {
+			if _, ok := entry[field]; ok {
+				t.Errorf("entry %q has %s without request or job", entry["msg"], field)
+			}
+		}
+	}
+}
+
+func TestHelpersInJob(t *testing.T) {
+	out := capture(t)
+	ctx := resource.NewJobContext(context.Background(), "filegc")
+	logAll(ctx)
+
+	job := resource.JobFromContext(ctx)
+	got := entries(t, out)
+	if len(got) != 5 {
+		t.Fatalf("%d entries, want 5", len(got))
+	}
+	for _, entry := range got {
+		if entry["job_id"] != job.ID || entry["job"] != "filegc" {
+			t.Errorf("entry %q: job_id %v job %v, want %s filegc", entry["msg"], entry["job_id"], entry["job"], job.ID)
+		}
+		if _, ok := entry["request_id"]; ok {
+			t.Errorf("entry %q has request_id in a job", entry["msg"])
+		}
+		if _, ok := entry["user_id"]; ok {
+			t.Errorf("entry %q has user_id in a job", entry["msg"])
+		}
+	}
+}
+
+func TestHelpersInRequest(t *testing.T) {
+	out := capture(t)
+	ctx := resource.NewContext(context.Background(), "req-1", "GET /profiles", time.Now())
+	ctx = currentuser.NewContext(ctx, &currentuser.CurrentUser{ID: 7})
+	InfoLog(ctx, "info")
+
+	got := entries(t, out)
+	if len(got) != 1 {
+		t.Fatalf("%d entries, want 1", len(got))
+	}
+	if got[0]["request_id"] != "req-1" || got[0]["action"] != "GET /profiles" {
+		t.Errorf("request_id %v action %v, want req-1 GET /profiles", got[0]["request_id"], got[0]["action"])
+	}
+	if got[0]["user_id"] != float64(7) {
+		t.Errorf("user_id %v, want 7", got[0]["user_id"])
+	}
+	if _, ok := got[0]["job_id"]; ok {
+		t.Error("request entry has job_id")
+	}
+}
@@ -0,0 +1,267 @@
+package log
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/resource"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Output formats
+const (
+	FormatJSON = "json"
+	FormatText = "text"
+)
+
+// redacted replaces values of redacted fields
+const redacted = "[REDACTED]"
+
+// DefaultRedact lists personal data fields never written to logs
+var DefaultRedact = []string{"phone", "address", "email", "birth_date"}
+
+// Fields are structured values attached to a log entry
+type Fields map[string]interface{}
+
+// Config configures a Logger
+type Config struct {
+	// Format is FormatJSON or FormatText
+	Format string
+	Level  logrus.Level
+	// Levels overrides Level of given packages
+	Levels map[string]logrus.Level
+	// Redact lists fields whose values are replaced before writing
+	Redact []string
+	Output io.Writer
+}
+
+// ConfigFromEnv reads Config from environment variables:
+//
+//	LOG_FORMAT              json or text, text on development by default
+//	LOGGING_LEVEL           level of every package, info by default
+//	LOGGING_PACKAGE_LEVELS  comma separated overrides such as mysql=debug,upload=warn
+//	LOG_REDACT_FIELDS       comma separated fields redacted on top of DefaultRedact
+//
+// Nothing is written when ENV is test.
+func ConfigFromEnv() Config {
+	cfg := Config{
+		Format: os.Getenv("LOG_FORMAT"),
+		Level:  logrus.InfoLevel,
+		Levels: map[string]logrus.Level{},
+		Redact: append([]string{}, DefaultRedact...),
+		Output: os.Stdout,
+	}
+
+	if cfg.Format == "" {
+		cfg.Format = FormatJSON
+		if os.Getenv("ENV") == "development" {
+			cfg.Format = FormatText
+		}
+	}
+	if level, err := logrus.ParseLevel(os.Getenv("LOGGING_LEVEL")); err == nil {
+		cfg.Level = level
+	}
+	for _, pair := range splitList(os.Getenv("LOGGING_PACKAGE_LEVELS")) {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if level, err := logrus.ParseLevel(kv[1]); err == nil {
+			cfg.Levels[strings.TrimSpace(kv[0])] = level
+		}
+	}
+	cfg.Redact = append(cfg.Redact, splitList(os.Getenv("LOG_REDACT_FIELDS"))...)
+
+	if os.Getenv("ENV") == "test" {
+		cfg.Output = ioutil.Discard
+	}
+	return cfg
+}
+
+// Logger writes structured entries carrying request_id, action, user_id
+// and duration of the request in their context, or job_id and duration of
+// the background job
+type Logger struct {
+	out    *logrus.Logger
+	level  logrus.Level
+	levels map[string]logrus.Level
+	redact map[string]bool
+}
+
+// New returns Logger configured by cfg
+func New(cfg Config) *Logger {
+	out := logrus.New()
+	out.Out = cfg.Output
+	if out.Out == nil {
+		out.Out = os.Stdout
+	}
+	// levels are checked per package before reaching logrus
+	out.Level = logrus.TraceLevel
+	if cfg.Format == FormatText {
+		out.Formatter = &logrus.TextFormatter{FullTimestamp: true}
+	} else {
+		out.Formatter = &logrus.JSONFormatter{}
+	}
+
+	l := &Logger{out: out, level: cfg.Level, levels: cfg.Levels, redact: map[string]bool{}}
+	for _, field := range cfg.Redact {
+		l.redact[strings.ToLower(field)] = true
+	}
+	return l
+}
+
+var (
+	std   *Logger
+	stdMu sync.RWMutex
+)
+
+// Default returns the logger used by package level functions, configured
+// from environment variables until SetDefault replaces it
+func Default() *Logger {
+	stdMu.RLock()
+	l := std
+	stdMu.RUnlock()
+	if l != nil {
+		return l
+	}
+
+	stdMu.Lock()
+	defer stdMu.Unlock()
+	if std == nil {
+		std = New(ConfigFromEnv())
+	}
+	return std
+}
+
+// SetDefault replaces the logger used by package level functions
+func SetDefault(l *Logger) {
+	stdMu.Lock()
+	std = l
+	stdMu.Unlock()
+}
+
+// Enabled reports whether entries of given package and level are written
+func (l *Logger) Enabled(pkg string, level logrus.Level) bool {
+	threshold, ok := l.levels[pkg]
+	if !ok {
+		threshold = l.level
+	}
+	return level <= threshold
+}
+
+// Log writes an entry of given package with fields of ctx and given fields
+func (l *Logger) Log(ctx context.Context, pkg string, level logrus.Level, message string, fields Fields) {
+	if !l.Enabled(pkg, level) {
+		return
+	}
+
+	data := logrus.Fields{}
+	for k, v := range contextFields(ctx) {
+		data[k] = v
+	}
+	for k, v := range fields {
+		data[k] = l.redactValue(k, v)
+	}
+	if pkg != "" {
+		data["package"] = pkg
+	}
+
+	l.out.WithFields(data).Log(level, message)
+}
+
+// redactValue returns v, or redacted when key is a redacted field.
+// Nested fields are redacted too.
+func (l *Logger) redactValue(key string, v interface{}) interface{} {
+	if l.redact[strings.ToLower(key)] {
+		return redacted
+	}
+
+	var nested map[string]interface{}
+	switch m := v.(type) {
+	case Fields:
+		nested = m
+	case map[string]interface{}:
+		nested = m
+	default:
+		return v
+	}
+
+	clean := make(map[string]interface{}, len(nested))
+	for k, nv := range nested {
+		clean[k] = l.redactValue(k, nv)
+	}
+	return clean
+}
+
+// contextFields returns request or job values of ctx, leaving out those
+// ctx does not have
+func contextFields(ctx context.Context) Fields {
+	fields := Fields{}
+	if ctx == nil {
+		return fields
+	}
+
+	if res := resource.FromContext(ctx); res != nil {
+		fields["request_id"] = res.RequestID
+		fields["action"] = res.Action
+		fields["duration"] = time.Since(res.StartTime).Seconds()
+	}
+	if job := resource.JobFromContext(ctx); job != nil {
+		fields["job_id"] = job.ID
+		fields["job"] = job.Name
+		fields["duration"] = time.Since(job.StartTime).Seconds()
+	}
+	if user, ok := currentuser.Lookup(ctx); ok {
+		fields["user_id"] = user.ID
+	}
+	return fields
+}
+
+// Package logs entries of a single package, honouring its level in
+// LOGGING_PACKAGE_LEVELS. It writes through Default, so it may be declared
+// before the default logger is configured.
+type Package string
+
+// Debug logs a debug entry
+func (p Package) Debug(ctx context.Context, message string, fields Fields) {
+	Default().Log(ctx, string(p), logrus.DebugLevel, message, fields)
+}
+
+// Info logs an informational entry
+func (p Package) Info(ctx context.Context, message string, fields Fields) {
+	Default().Log(ctx, string(p), logrus.InfoLevel, message, fields)
+}
+
+// Warn logs a warning entry
+func (p Package) Warn(ctx context.Context, message string, fields Fields) {
+	Default().Log(ctx, string(p), logrus.WarnLevel, message, fields)
+}
+
+// Error logs err
+func (p Package) Error(ctx context.Context, err error, message string, fields Fields) {
+	all := Fields{}
+	if err != nil {
+		all["error"] = err.Error()
+	}
+	for k, v := range fields {
+		all[k] = v
+	}
+	Default().Log(ctx, string(p), logrus.ErrorLevel, message, all)
+}
+
+func splitList(v string) []string {
+	list := []string{}
+	for _, s := range strings.Split(v, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			list = append(list, s)
+		}
+	}
+	return list
+}
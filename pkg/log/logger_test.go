@@ -0,0 +1,112 @@
+package log
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+)
+
+func TestRedactValue(t *testing.T) {
+	l := New(Config{Redact: DefaultRedact})
+
+	cases := []struct {
+		name  string
+		key   string
+		value interface{}
+		want  interface{}
+	}{
+		{"top level", "phone", "08123456789", redacted},
+		{"case variant", "Phone", "08123456789", redacted},
+		{"kept", "profile_id", 7, 7},
+		{
+			"nested map",
+			"profile",
+			map[string]interface{}{"id": 7, "address": "Jl. Merdeka 1"},
+			map[string]interface{}{"id": 7, "address": redacted},
+		},
+		{
+			"nested fields",
+			"changes",
+			Fields{"Email": "a@example.com", "name": "Budi"},
+			map[string]interface{}{"Email": redacted, "name": "Budi"},
+		},
+		{
+			"deeply nested",
+			"household",
+			map[string]interface{}{"head": map[string]interface{}{"BIRTH_DATE": "1990-01-01", "id": 3}},
+			map[string]interface{}{"head": map[string]interface{}{"BIRTH_DATE": redacted, "id": 3}},
+		},
+	}
+	for _, c := range cases {
+		if got := l.redactValue(c.key, c.value); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%s: got %v, want %v", c.name, got, c.want)
+		}
+	}
+}
+
+func TestConfigFromEnvRedactFields(t *testing.T) {
+	t.Setenv("ENV", "production")
+	t.Setenv("LOG_REDACT_FIELDS", "nik, Mother_Name")
+
+	var out bytes.Buffer
+	cfg := ConfigFromEnv()
+	cfg.Output = &out
+	New(cfg).Log(context.Background(), "", logrus.InfoLevel, "profile", Fields{
+		"nik":         "3171234567890001",
+		"mother_name": "Siti",
+		"phone":       "08123456789",
+		"name":        "Budi",
+	})
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("entry %q is not JSON: %v", out.String(), err)
+	}
+	for _, field := range []string{"nik", "mother_name", "phone"} {
+		if entry[field] != redacted {
+			t.Errorf("%s: got %v, want %s", field, entry[field], redacted)
+		}
+	}
+	if entry["name"] != "Budi" {
+		t.Errorf("name: got %v, want Budi", entry["name"])
+	}
+}
+
+func TestConfigFromEnvFormat(t *testing.T) {
+	cases := []struct {
+		env, format string
+		want        string
+	}{
+		{"production", "", FormatJSON},
+		{"staging", "", FormatJSON},
+		{"development", "", FormatText},
+		{"development", FormatJSON, FormatJSON},
+		{"production", FormatText, FormatText},
+	}
+	for _, c := range cases {
+		t.Setenv("ENV", c.env)
+		t.Setenv("LOG_FORMAT", c.format)
+
+		var out bytes.Buffer
+		cfg := ConfigFromEnv()
+		cfg.Output = &out
+		if cfg.Format != c.want {
+			t.Errorf("ENV=%s LOG_FORMAT=%q: format %s, want %s", c.env, c.format, cfg.Format, c.want)
+		}
+		New(cfg).Log(context.Background(), "", logrus.InfoLevel, "hello", Fields{"phone": "08123456789"})
+
+		entry := out.String()
+		isJSON := json.Valid(bytes.TrimSpace(out.Bytes()))
+		if isJSON != (c.want == FormatJSON) {
+			t.Errorf("ENV=%s LOG_FORMAT=%q: entry %q written as JSON %v", c.env, c.format, entry, isJSON)
+		}
+		if strings.Contains(entry, "08123456789") {
+			t.Errorf("ENV=%s LOG_FORMAT=%q: entry %q contains a redacted value", c.env, c.format, entry)
+		}
+	}
+}
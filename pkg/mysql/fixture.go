@@ -0,0 +1,99 @@
+package mysql
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// LoadFixtures inserts rows of a YAML document mapping table names to rows,
+// in document order so referenced rows can be listed first:
+//
+//	profiles:
+//	  - id: 1
+//	    name: Jane
+//	    visibility: {phone: private}
+//
+// Nested maps and lists are stored as JSON.
+func LoadFixtures(ctx context.Context, db sqlx.ExecerContext, r io.Reader) error {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var tables yaml.MapSlice
+	if err := yaml.Unmarshal(b, &tables); err != nil {
+		return err
+	}
+
+	for _, table := range tables {
+		rows, ok := table.Value.([]interface{})
+		if !ok {
+			return fmt.Errorf("mysql: fixture %v must be a list of rows", table.Key)
+		}
+
+		for _, row := range rows {
+			columns, ok := row.(yaml.MapSlice)
+			if !ok {
+				return fmt.Errorf("mysql: fixture %v has a row that is not a map", table.Key)
+			}
+			if err := insertFixture(ctx, db, fmt.Sprint(table.Key), columns); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func insertFixture(ctx context.Context, db sqlx.ExecerContext, table string, columns yaml.MapSlice) error {
+	names := make([]string, 0, len(columns))
+	marks := make([]string, 0, len(columns))
+	args := make([]interface{}, 0, len(columns))
+	for _, c := range columns {
+		v, err := fixtureValue(c.Value)
+		if err != nil {
+			return err
+		}
+
+		names = append(names, fmt.Sprintf("`%v`", c.Key))
+		marks = append(marks, "?")
+		args = append(args, v)
+	}
+
+	query := fmt.Sprintf("INSERT INTO `%s` (%s) VALUES (%s)", table, strings.Join(names, ", "), strings.Join(marks, ", "))
+	_, err := db.ExecContext(ctx, query, args...)
+	return err
+}
+
+func fixtureValue(v interface{}) (interface{}, error) {
+	switch v.(type) {
+	case yaml.MapSlice, []interface{}:
+		b, err := json.Marshal(jsonValue(v))
+		return string(b), err
+	}
+	return v, nil
+}
+
+// jsonValue converts YAML maps into maps encoding/json accepts
+func jsonValue(v interface{}) interface{} {
+	switch t := v.(type) {
+	case yaml.MapSlice:
+		m := map[string]interface{}{}
+		for _, item := range t {
+			m[fmt.Sprint(item.Key)] = jsonValue(item.Value)
+		}
+		return m
+	case []interface{}:
+		for i := range t {
+			t[i] = jsonValue(t[i])
+		}
+		return t
+	}
+	return v
+}
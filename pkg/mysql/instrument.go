@@ -0,0 +1,305 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/log"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	queryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pokedex_db_query_duration_seconds",
+		Help:    "Duration of database queries, including reading their rows",
+		Buckets: []float64{.001, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+	}, []string{"query", "status"})
+	queryRows = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "pokedex_db_query_rows",
+		Help:    "Rows returned or affected by database queries",
+		Buckets: prometheus.ExponentialBuckets(1, 4, 8),
+	}, []string{"query"})
+)
+
+func init() {
+	prometheus.MustRegister(queryDuration, queryRows)
+}
+
+var (
+	// queryNameComment names a query explicitly, e.g. /* profile.find */ SELECT ...
+	queryNameComment = regexp.MustCompile(`^\s*/\*\s*([\w.:-]+)\s*\*/`)
+	queryVerb        = regexp.MustCompile(`^\s*(\w+)`)
+	queryTable       = regexp.MustCompile("(?i)\\b(?:from|into|update|table|join)\\s+`?(\\w+)`?")
+)
+
+// QueryName returns the metric label of query, taken from a leading
+// comment or else built from its verb and first table
+func QueryName(query string) string {
+	if m := queryNameComment.FindStringSubmatch(query); m != nil {
+		return m[1]
+	}
+
+	verb := queryVerb.FindStringSubmatch(query)
+	if verb == nil {
+		return "unknown"
+	}
+	name := strings.ToLower(verb[1])
+
+	if table := queryTable.FindStringSubmatch(query); table != nil {
+		name += " " + strings.ToLower(table[1])
+	}
+	return name
+}
+
+// slowQueryThreshold returns DATABASE_SLOW_QUERY_THRESHOLD, 200ms by default
+func slowQueryThreshold() time.Duration {
+	return envDuration("DATABASE_SLOW_QUERY_THRESHOLD", 200*time.Millisecond)
+}
+
+// observe records a finished query in metrics, logging it when slow
+func observe(ctx context.Context, query string, start time.Time, rows int64, err error) {
+	duration := time.Since(start)
+	name := QueryName(query)
+
+	status := "ok"
+	if err != nil && err != driver.ErrSkip {
+		status = "error"
+	}
+	queryDuration.WithLabelValues(name, status).Observe(duration.Seconds())
+	queryRows.WithLabelValues(name).Observe(float64(rows))
+
+	if duration < slowQueryThreshold() || os.Getenv("ENV") == "test" {
+		return
+	}
+
+	fields := map[string]interface{}{
+		"query_name": name,
+		"query":      truncate(query, 1000),
+		"duration":   duration.Seconds(),
+		"rows":       rows,
+	}
+	if status == "error" {
+		fields["error"] = err.Error()
+	}
+	log.SlowQueryLog(ctx, fields)
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
+
+// openInstrumented opens dsn through a connector recording every query
+func openInstrumented(dsn string) (*sqlx.DB, error) {
+	connector, err := mysqldriver.MySQLDriver{}.OpenConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return sqlx.NewDb(sql.OpenDB(instrumentedConnector{connector}), "mysql"), nil
+}
+
+type instrumentedConnector struct {
+	driver.Connector
+}
+
+func (c instrumentedConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedConn{Conn: conn}, nil
+}
+
+// instrumentedConn records queries run directly on the connection and
+// through statements it prepares
+type instrumentedConn struct {
+	driver.Conn
+}
+
+func (c *instrumentedConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *instrumentedConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var (
+		stmt driver.Stmt
+		err  error
+	)
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = p.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &instrumentedStmt{Stmt: stmt, query: query}, nil
+}
+
+func (c *instrumentedConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	res, err := execer.ExecContext(ctx, query, args)
+	if err != driver.ErrSkip {
+		observe(ctx, query, start, rowsAffected(res), err)
+	}
+	return res, err
+}
+
+func (c *instrumentedConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		if err != driver.ErrSkip {
+			observe(ctx, query, start, 0, err)
+		}
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, ctx: ctx, query: query, start: start}, nil
+}
+
+func (c *instrumentedConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (c *instrumentedConn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *instrumentedConn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+type instrumentedStmt struct {
+	driver.Stmt
+	query string
+}
+
+func (s *instrumentedStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	start := time.Now()
+
+	var (
+		res driver.Result
+		err error
+	)
+	if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+		res, err = e.ExecContext(ctx, args)
+	} else {
+		res, err = s.Stmt.Exec(namedValues(args))
+	}
+
+	observe(ctx, s.query, start, rowsAffected(res), err)
+	return res, err
+}
+
+func (s *instrumentedStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	start := time.Now()
+
+	var (
+		rows driver.Rows
+		err  error
+	)
+	if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+		rows, err = q.QueryContext(ctx, args)
+	} else {
+		rows, err = s.Stmt.Query(namedValues(args))
+	}
+
+	if err != nil {
+		observe(ctx, s.query, start, 0, err)
+		return nil, err
+	}
+	return &instrumentedRows{Rows: rows, ctx: ctx, query: s.query, start: start}, nil
+}
+
+func (s *instrumentedStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// instrumentedRows records its query once rows are closed, so the duration
+// includes reading them
+type instrumentedRows struct {
+	driver.Rows
+	ctx   context.Context
+	query string
+	start time.Time
+	count int64
+	err   error
+}
+
+func (r *instrumentedRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch err {
+	case nil:
+		r.count++
+	case io.EOF:
+	default:
+		r.err = err
+	}
+	return err
+}
+
+func (r *instrumentedRows) Close() error {
+	err := r.Rows.Close()
+	observe(r.ctx, r.query, r.start, r.count, r.err)
+	return err
+}
+
+func rowsAffected(res driver.Result) int64 {
+	if res == nil {
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return n
+}
+
+// namedValues converts args for drivers predating context support
+func namedValues(args []driver.NamedValue) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a.Value
+	}
+	return values
+}
@@ -0,0 +1,82 @@
+package mysql
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// statementEnd splits a migration file into statements
+var statementEnd = regexp.MustCompile(`;\s*(\n|$)`)
+
+// Migrate applies every .sql file in dir not applied yet, in filename order,
+// recording applied files in schema_migrations. It returns applied filenames.
+func Migrate(ctx context.Context, db *sqlx.DB, dir string) ([]string, error) {
+	if _, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version VARCHAR(255) NOT NULL, applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (version)) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4"); err != nil {
+		return nil, err
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	done := []string{}
+	if err := db.SelectContext(ctx, &done, "SELECT version FROM schema_migrations"); err != nil {
+		return nil, err
+	}
+	isDone := map[string]bool{}
+	for _, v := range done {
+		isDone[v] = true
+	}
+
+	applied := []string{}
+	for _, f := range files {
+		version := filepath.Base(f)
+		if isDone[version] {
+			continue
+		}
+
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return applied, err
+		}
+
+		// MySQL commits DDL implicitly, a failed file may be half applied
+		for _, stmt := range statementEnd.Split(string(b), -1) {
+			if strings.TrimSpace(stmt) == "" {
+				continue
+			}
+			if _, err := db.ExecContext(ctx, stmt); err != nil {
+				return applied, &MigrationError{Version: version, Err: err}
+			}
+		}
+
+		if _, err := db.ExecContext(ctx, "INSERT INTO schema_migrations (version) VALUES (?)", version); err != nil {
+			return applied, err
+		}
+		applied = append(applied, version)
+	}
+	return applied, nil
+}
+
+// MigrationError is returned when a statement of a migration file fails
+type MigrationError struct {
+	Version string
+	Err     error
+}
+
+func (e *MigrationError) Error() string {
+	return "mysql: migration " + e.Version + " failed: " + e.Err.Error()
+}
+
+// Unwrap returns the failing statement's error
+func (e *MigrationError) Unwrap() error {
+	return e.Err
+}
@@ -1,45 +1,184 @@
 package mysql
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"strconv"
 	"time"
 
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/gkkkb/pokedex/pkg/log"
+
+	driver "github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
-// Init returns connector to Decepticon database
-func Init() *sqlx.DB {
-	dbUsername := os.Getenv("DATABASE_USERNAME")
-	dbPassword := os.Getenv("DATABASE_PASSWORD")
-	dbHost := os.Getenv("DATABASE_HOST")
-	dbName := os.Getenv("DATABASE_NAME")
-	dbPort := os.Getenv("DATABASE_PORT")
-	if dbPort == "" {
-		dbPort = "3306"
+var logger = log.Package("mysql")
+
+// Config contains connection and pool settings of a database
+type Config struct {
+	Username string
+	Password string
+	Host     string
+	Port     string
+	Name     string
+
+	// TLS is true, false, skip-verify, preferred or a registered config name
+	TLS       string
+	Charset   string
+	Collation string
+	Timezone  *time.Location
+
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// ConnectRetries is how many times Open pings before giving up,
+	// waiting RetryBackoff doubled after every failure
+	ConnectRetries int
+	RetryBackoff   time.Duration
+}
+
+// ConnectError is returned when a database stays unreachable after every retry
+type ConnectError struct {
+	Host     string
+	Attempts int
+	Err      error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("mysql: cannot connect to %s after %d attempts: %s", e.Host, e.Attempts, e.Err)
+}
+
+// Unwrap returns the last connection error
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+// ConfigFromEnv reads DATABASE_* variables
+func ConfigFromEnv() (Config, error) {
+	cfg := Config{
+		Username:        os.Getenv("DATABASE_USERNAME"),
+		Password:        os.Getenv("DATABASE_PASSWORD"),
+		Host:            os.Getenv("DATABASE_HOST"),
+		Port:            envString("DATABASE_PORT", "3306"),
+		Name:            os.Getenv("DATABASE_NAME"),
+		TLS:             envString("DATABASE_TLS", "false"),
+		Charset:         envString("DATABASE_CHARSET", "utf8mb4"),
+		Collation:       envString("DATABASE_COLLATION", "utf8mb4_unicode_ci"),
+		MaxOpenConns:    envInt("DATABASE_MAX_OPEN_CONNS", 0),
+		MaxIdleConns:    envInt("DATABASE_MAX_IDLE_CONNS", envInt("DATABASE_POOL", 2)),
+		ConnMaxLifetime: envDuration("DATABASE_CONN_MAX_LIFETIME", time.Minute),
+		ConnMaxIdleTime: envDuration("DATABASE_CONN_MAX_IDLE_TIME", 0),
+		ConnectRetries:  envInt("DATABASE_CONNECT_RETRIES", 5),
+		RetryBackoff:    envDuration("DATABASE_CONNECT_BACKOFF", time.Second),
 	}
 
-	env := os.Getenv("ENV")
+	loc, err := time.LoadLocation(envString("DATABASE_TIMEZONE", "UTC"))
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Timezone = loc
+
+	return cfg, nil
+}
+
+// DSN returns data source name of cfg
+func (cfg Config) DSN() string {
+	dc := driver.NewConfig()
+	dc.User = cfg.Username
+	dc.Passwd = cfg.Password
+	dc.Net = "tcp"
+	dc.Addr = fmt.Sprintf("%s:%s", cfg.Host, cfg.Port)
+	dc.DBName = cfg.Name
+	dc.ParseTime = true
+	dc.TLSConfig = cfg.TLS
+	dc.Collation = cfg.Collation
+	dc.Loc = cfg.Timezone
+	dc.Params = map[string]string{"charset": cfg.Charset}
+	return dc.FormatDSN()
+}
 
+// Init returns connector to Decepticon database configured from environment
+func Init() (*sqlx.DB, error) {
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	env := os.Getenv("ENV")
 	if env == "development" || env == "staging" {
-		fmt.Printf("Connecting to [USERNAME]:[PASSWORD]@(%s:%v)/%s?parseTime=true\n", dbHost, dbPort, dbName)
+		fmt.Printf("Connecting to [USERNAME]:[PASSWORD]@(%s:%v)/%s?parseTime=true\n", cfg.Host, cfg.Port, cfg.Name)
+	}
+
+	return Open(cfg)
+}
+
+// Open connects to database of cfg, pinging it until it answers or
+// ConnectRetries is exhausted
+func Open(cfg Config) (*sqlx.DB, error) {
+	db, err := openInstrumented(cfg.DSN())
+	if err != nil {
+		return nil, err
 	}
 
-	dataSourceName := fmt.Sprintf("%s:%v@(%s:%v)/%s?parseTime=true", dbUsername, dbPassword, dbHost, dbPort, dbName)
-	db, _ := sqlx.Open("mysql", dataSourceName)
+	configurePool(db, cfg)
 
-	if err := db.Ping(); err != nil {
+	attempts := cfg.ConnectRetries
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	backoff := cfg.RetryBackoff
+	for attempt := 1; ; attempt++ {
 		// https://stackoverflow.com/questions/32345124/why-does-sql-open-return-nil-as-error-when-it-should-not
-		panic(err.Error())
+		if err = db.Ping(); err == nil {
+			return db, nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		logger.Warn(context.Background(), "ping failed, retrying", log.Fields{
+			"host":    cfg.Host,
+			"attempt": attempt,
+			"of":      attempts,
+			"backoff": backoff.String(),
+			"error":   err.Error(),
+		})
+		time.Sleep(backoff)
+		backoff *= 2
 	}
 
-	if dp, err := strconv.Atoi(os.Getenv("DATABASE_POOL")); err == nil && dp > 0 {
-		db.SetMaxIdleConns(dp)
+	db.Close()
+	return nil, &ConnectError{Host: cfg.Host, Attempts: attempts, Err: err}
+}
+
+func configurePool(db *sqlx.DB, cfg Config) {
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
+}
+
+func envString(key string, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
 	}
+	return fallback
+}
 
-	db.SetConnMaxLifetime(time.Minute)
-	// db.SetMaxOpenConns(500)
-	return db
+func envInt(key string, fallback int) int {
+	if v, err := strconv.Atoi(os.Getenv(key)); err == nil && v >= 0 {
+		return v
+	}
+	return fallback
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if v, err := time.ParseDuration(os.Getenv(key)); err == nil && v >= 0 {
+		return v
+	}
+	return fallback
 }
@@ -0,0 +1,118 @@
+package mysql
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+)
+
+func TestDSN(t *testing.T) {
+	jakarta, err := time.LoadLocation("Asia/Jakarta")
+	if err != nil {
+		t.Skipf("no time zone database: %v", err)
+	}
+
+	cfg := Config{
+		Username:  "pokedex",
+		Password:  "p@ss:word/1",
+		Host:      "db.internal",
+		Port:      "3307",
+		Name:      "pokedex",
+		TLS:       "skip-verify",
+		Charset:   "utf8mb4",
+		Collation: "utf8mb4_unicode_ci",
+		Timezone:  jakarta,
+	}
+
+	dc, err := driver.ParseDSN(cfg.DSN())
+	if err != nil {
+		t.Fatalf("DSN %q does not parse: %v", cfg.DSN(), err)
+	}
+	if dc.User != cfg.Username || dc.Passwd != cfg.Password {
+		t.Errorf("credentials %s:%s, want %s:%s", dc.User, dc.Passwd, cfg.Username, cfg.Password)
+	}
+	if dc.Net != "tcp" || dc.Addr != "db.internal:3307" || dc.DBName != "pokedex" {
+		t.Errorf("address %s(%s)/%s, want tcp(db.internal:3307)/pokedex", dc.Net, dc.Addr, dc.DBName)
+	}
+	if dc.TLSConfig != "skip-verify" {
+		t.Errorf("tls %q, want skip-verify", dc.TLSConfig)
+	}
+	if dc.Collation != "utf8mb4_unicode_ci" {
+		t.Errorf("collation %q, want utf8mb4_unicode_ci", dc.Collation)
+	}
+	if dc.Params["charset"] != "utf8mb4" {
+		t.Errorf("charset %q, want utf8mb4", dc.Params["charset"])
+	}
+	if dc.Loc.String() != "Asia/Jakarta" {
+		t.Errorf("loc %s, want Asia/Jakarta", dc.Loc)
+	}
+	if !dc.ParseTime {
+		t.Error("parseTime is off")
+	}
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	for _, key := range []string{"DATABASE_PORT", "DATABASE_TLS", "DATABASE_CHARSET", "DATABASE_COLLATION", "DATABASE_TIMEZONE",
+		"DATABASE_MAX_OPEN_CONNS", "DATABASE_MAX_IDLE_CONNS", "DATABASE_POOL", "DATABASE_CONNECT_RETRIES", "DATABASE_CONNECT_BACKOFF"} {
+		t.Setenv(key, "")
+	}
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Port != "3306" || cfg.TLS != "false" || cfg.Charset != "utf8mb4" || cfg.Collation != "utf8mb4_unicode_ci" || cfg.Timezone != time.UTC {
+		t.Errorf("defaults %+v", cfg)
+	}
+	if cfg.MaxIdleConns != 2 || cfg.ConnectRetries != 5 || cfg.RetryBackoff != time.Second {
+		t.Errorf("pool defaults %+v", cfg)
+	}
+
+	t.Setenv("DATABASE_TLS", "true")
+	t.Setenv("DATABASE_POOL", "4")
+	t.Setenv("DATABASE_CONNECT_RETRIES", "-1")
+	t.Setenv("DATABASE_CONNECT_BACKOFF", "250ms")
+	if cfg, err = ConfigFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.TLS != "true" || cfg.MaxIdleConns != 4 || cfg.ConnectRetries != 5 || cfg.RetryBackoff != 250*time.Millisecond {
+		t.Errorf("overrides %+v", cfg)
+	}
+
+	t.Setenv("DATABASE_TIMEZONE", "Nowhere/Atlantis")
+	if _, err := ConfigFromEnv(); err == nil {
+		t.Error("unknown time zone accepted")
+	}
+}
+
+func TestOpenRetriesWithBackoff(t *testing.T) {
+	cfg := Config{
+		Host:           "127.0.0.1",
+		Port:           "1",
+		Charset:        "utf8mb4",
+		Timezone:       time.UTC,
+		ConnectRetries: 3,
+		RetryBackoff:   20 * time.Millisecond,
+	}
+
+	start := time.Now()
+	db, err := Open(cfg)
+	elapsed := time.Since(start)
+	if db != nil {
+		t.Fatal("unreachable database opened")
+	}
+
+	var connectErr *ConnectError
+	if !errors.As(err, &connectErr) {
+		t.Fatalf("error %v (%T), want *ConnectError", err, err)
+	}
+	if connectErr.Host != "127.0.0.1" || connectErr.Attempts != 3 || connectErr.Err == nil {
+		t.Errorf("error %+v, want 3 attempts to 127.0.0.1 with the last error", connectErr)
+	}
+	// waits 20ms then 40ms between the three pings
+	if elapsed < 60*time.Millisecond {
+		t.Errorf("gave up after %s, want at least 60ms of backoff", elapsed)
+	}
+}
@@ -0,0 +1,249 @@
+package mysql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/log"
+	"github.com/gkkkb/pokedex/pkg/resource"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	errNotReplica         = errors.New("not a replica")
+	errReplicationStopped = errors.New("replication stopped")
+)
+
+// Replicas routes read-only queries to replica connections. A replica is
+// only used once a probe found it lagging no more than maxLag behind the
+// primary, otherwise reads fall back to the primary.
+type Replicas struct {
+	primary *sqlx.DB
+	maxLag  time.Duration
+	next    uint32
+
+	mu    *sync.RWMutex
+	hosts []*replica
+}
+
+type replica struct {
+	host    string
+	db      *sqlx.DB
+	lag     time.Duration
+	healthy bool
+}
+
+// ReplicaStats contains health and connection pool stats of a replica
+type ReplicaStats struct {
+	Host    string      `json:"host"`
+	Healthy bool        `json:"healthy"`
+	Lag     string      `json:"lag"`
+	Pool    sql.DBStats `json:"pool"`
+}
+
+// InitReplicas opens connections to comma separated host[:port] in
+// DATABASE_REPLICA_HOSTS, sharing settings of the primary. Without
+// replicas every read goes to primary. Replicas are not pinged here,
+// unreachable ones stay unhealthy until Probe reaches them.
+func InitReplicas(primary *sqlx.DB) *Replicas {
+	maxLag, err := time.ParseDuration(os.Getenv("DATABASE_REPLICA_MAX_LAG"))
+	if err != nil {
+		maxLag = 10 * time.Second
+	}
+
+	r := NewReplicas(primary, maxLag)
+
+	cfg, err := ConfigFromEnv()
+	if err != nil {
+		logger.Error(context.Background(), err, "skipping replicas", nil)
+		return r
+	}
+
+	for _, h := range strings.Split(os.Getenv("DATABASE_REPLICA_HOSTS"), ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+
+		rc := cfg
+		if rc.Host, rc.Port, err = net.SplitHostPort(h); err != nil {
+			rc.Host, rc.Port = h, "3306"
+		}
+
+		db, err := openInstrumented(rc.DSN())
+		if err != nil {
+			logger.Error(context.Background(), err, "skipping replica", log.Fields{"host": h})
+			continue
+		}
+		configurePool(db, rc)
+
+		r.hosts = append(r.hosts, &replica{host: h, db: db})
+	}
+	return r
+}
+
+// NewReplicas returns Replicas without any replica, so every read goes to primary
+func NewReplicas(primary *sqlx.DB, maxLag time.Duration) *Replicas {
+	return &Replicas{primary: primary, maxLag: maxLag, mu: &sync.RWMutex{}}
+}
+
+// Reader returns a healthy replica in round robin, or primary when every
+// replica is unhealthy or lagging
+func (r *Replicas) Reader() *sqlx.DB {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n := len(r.hosts)
+	start := int(atomic.AddUint32(&r.next, 1))
+	for i := 0; i < n; i++ {
+		h := r.hosts[(start+i)%n]
+		if h.healthy && h.lag <= r.maxLag {
+			return h.db
+		}
+	}
+	return r.primary
+}
+
+// ReadOnly returns Queryer sending reads to Reader and writes to primary
+func (r *Replicas) ReadOnly() ReadOnlyDB {
+	return ReadOnlyDB{replicas: r}
+}
+
+// Probe measures replication lag of every replica
+func (r *Replicas) Probe(ctx context.Context) {
+	for _, h := range r.hosts {
+		lag, err := replicationLag(ctx, h.db)
+		if err != nil {
+			logger.Error(ctx, err, "replica unhealthy", log.Fields{"host": h.host})
+		}
+
+		r.mu.Lock()
+		h.lag, h.healthy = lag, err == nil
+		r.mu.Unlock()
+	}
+}
+
+// Run probes replicas every interval until ctx is done
+func (r *Replicas) Run(ctx context.Context, interval time.Duration) {
+	if len(r.hosts) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		r.Probe(resource.NewJobContext(ctx, "replica-probe"))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Stats returns health and pool stats of every replica
+func (r *Replicas) Stats() []ReplicaStats {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := []ReplicaStats{}
+	for _, h := range r.hosts {
+		stats = append(stats, ReplicaStats{Host: h.host, Healthy: h.healthy, Lag: h.lag.String(), Pool: h.db.Stats()})
+	}
+	return stats
+}
+
+// replicationLag reads Seconds_Behind_Master of db, failing when replication
+// is not running
+func replicationLag(ctx context.Context, db *sqlx.DB) (time.Duration, error) {
+	rows, err := db.QueryxContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, errNotReplica
+	}
+
+	status := map[string]interface{}{}
+	if err := rows.MapScan(status); err != nil {
+		return 0, err
+	}
+
+	behind, ok := status["Seconds_Behind_Master"].([]byte)
+	if !ok {
+		return 0, errReplicationStopped
+	}
+
+	seconds, err := strconv.Atoi(string(behind))
+	if err != nil {
+		return 0, err
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// ReadOnlyDB picks a connection from Replicas on every query. Queries that
+// must see their own writes should use the primary instead.
+type ReadOnlyDB struct {
+	replicas *Replicas
+}
+
+// DriverName implements sqlx.ExtContext
+func (db ReadOnlyDB) DriverName() string {
+	return db.replicas.primary.DriverName()
+}
+
+// Rebind implements sqlx.ExtContext
+func (db ReadOnlyDB) Rebind(query string) string {
+	return db.replicas.primary.Rebind(query)
+}
+
+// BindNamed implements sqlx.ExtContext
+func (db ReadOnlyDB) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	return db.replicas.primary.BindNamed(query, arg)
+}
+
+// QueryContext implements sqlx.ExtContext
+func (db ReadOnlyDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.replicas.Reader().QueryContext(ctx, query, args...)
+}
+
+// QueryxContext implements sqlx.ExtContext
+func (db ReadOnlyDB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlx.Rows, error) {
+	return db.replicas.Reader().QueryxContext(ctx, query, args...)
+}
+
+// QueryRowxContext implements sqlx.ExtContext
+func (db ReadOnlyDB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlx.Row {
+	return db.replicas.Reader().QueryRowxContext(ctx, query, args...)
+}
+
+// GetContext runs query on a replica and scans a single row into dest
+func (db ReadOnlyDB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.replicas.Reader().GetContext(ctx, dest, query, args...)
+}
+
+// SelectContext runs query on a replica and scans every row into dest
+func (db ReadOnlyDB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.replicas.Reader().SelectContext(ctx, dest, query, args...)
+}
+
+// ExecContext always runs on primary, replicas are never written to
+func (db ReadOnlyDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return db.replicas.primary.ExecContext(ctx, query, args...)
+}
@@ -0,0 +1,86 @@
+package mysql
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// unreachable returns a connection to a port nothing listens on, opened
+// without connecting
+func unreachable(t *testing.T) *sqlx.DB {
+	t.Helper()
+
+	db, err := openInstrumented(Config{Host: "127.0.0.1", Port: "1", Charset: "utf8mb4", Timezone: time.UTC}.DSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func TestReaderFallsBackToPrimary(t *testing.T) {
+	primary, first, second := unreachable(t), unreachable(t), unreachable(t)
+
+	cases := []struct {
+		name  string
+		hosts []*replica
+		want  []*sqlx.DB
+	}{
+		{"no replica", nil, []*sqlx.DB{primary}},
+		{"down", []*replica{{host: "first", db: first}}, []*sqlx.DB{primary}},
+		{"lagging", []*replica{{host: "first", db: first, healthy: true, lag: 11 * time.Second}}, []*sqlx.DB{primary}},
+		{"at max lag", []*replica{{host: "first", db: first, healthy: true, lag: 10 * time.Second}}, []*sqlx.DB{first}},
+		{
+			"one lagging",
+			[]*replica{{host: "first", db: first, healthy: true, lag: time.Minute}, {host: "second", db: second, healthy: true}},
+			[]*sqlx.DB{second},
+		},
+		{
+			"round robin",
+			[]*replica{{host: "first", db: first, healthy: true}, {host: "second", db: second, healthy: true}},
+			[]*sqlx.DB{first, second},
+		},
+	}
+	for _, c := range cases {
+		r := NewReplicas(primary, 10*time.Second)
+		r.hosts = c.hosts
+
+		seen := map[*sqlx.DB]bool{}
+		for i := 0; i < 4; i++ {
+			seen[r.Reader()] = true
+		}
+		if len(seen) != len(c.want) {
+			t.Errorf("%s: read from %d connections, want %d", c.name, len(seen), len(c.want))
+		}
+		for _, db := range c.want {
+			if !seen[db] {
+				t.Errorf("%s: expected connection never read from", c.name)
+			}
+		}
+	}
+}
+
+func TestProbeMarksUnreachableReplicaUnhealthy(t *testing.T) {
+	primary, down := unreachable(t), unreachable(t)
+
+	r := NewReplicas(primary, 10*time.Second)
+	r.hosts = []*replica{{host: "down", db: down, healthy: true}}
+	if r.Reader() != down {
+		t.Fatal("healthy replica is not read from")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r.Probe(ctx)
+
+	if r.Reader() != primary {
+		t.Error("reads are not sent to primary once the replica is down")
+	}
+	stats := r.Stats()
+	if len(stats) != 1 || stats[0].Healthy {
+		t.Errorf("stats %+v, want one unhealthy replica", stats)
+	}
+}
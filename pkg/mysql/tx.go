@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	"context"
+	"time"
+
+	driver "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// errDeadlock is ER_LOCK_DEADLOCK, the transaction was rolled back by MySQL
+	errDeadlock = 1213
+	// errDuplicate is ER_DUP_ENTRY, a unique key already holds the value
+	errDuplicate = 1062
+	// txAttempts is how many times WithTx runs fn before giving up on deadlocks
+	txAttempts = 3
+)
+
+// WithTx runs fn inside a transaction, committing when fn returns nil and
+// rolling back otherwise. fn is retried from the start when MySQL reports a
+// deadlock, so it must not have side effects outside tx that can't be repeated.
+func WithTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	var err error
+	for attempt := 1; attempt <= txAttempts; attempt++ {
+		err = runTx(ctx, db, fn)
+		if !isDeadlock(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt) * 50 * time.Millisecond):
+		}
+	}
+	return err
+}
+
+func runTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func isDeadlock(err error) bool {
+	me, ok := err.(*driver.MySQLError)
+	return ok && me.Number == errDeadlock
+}
+
+// IsDuplicate reports whether err is MySQL rejecting a row whose unique key
+// is already taken
+func IsDuplicate(err error) bool {
+	me, ok := err.(*driver.MySQLError)
+	return ok && me.Number == errDuplicate
+}
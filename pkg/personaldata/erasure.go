@@ -0,0 +1,274 @@
+package personaldata
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/audit"
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/registry"
+	"github.com/gkkkb/pokedex/pkg/repository"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+	"github.com/gkkkb/pokedex/pkg/transfer"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Erasure request statuses
+const (
+	StatusRequested = "requested"
+	StatusRejected  = "rejected"
+	StatusApproved  = "approved"
+	StatusCompleted = "completed"
+)
+
+var (
+	// ErrErasureRequestNotFound is returned when an erasure request does not exist
+	ErrErasureRequestNotFound = errors.New("Erasure request not found")
+	// ErrErasureNotPending is returned when reviewing an already reviewed request
+	ErrErasureNotPending = errors.New("Data not updatable")
+)
+
+// ErasureRequest contains a member's request to erase their data
+type ErasureRequest struct {
+	ID          uint      `db:"id" json:"id"`
+	BranchID    uint      `db:"branch_id" json:"branch_id"`
+	ProfileID   uint      `db:"profile_id" json:"profile_id"`
+	RequestedBy uint      `db:"requested_by" json:"requested_by"`
+	ReviewedBy  *uint     `db:"reviewed_by" json:"reviewed_by,omitempty"`
+	Status      string    `db:"status" json:"status"`
+	Reason      *string   `db:"reason" json:"reason,omitempty"`
+	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at" json:"updated_at"`
+}
+
+const erasureColumns = "id, branch_id, profile_id, requested_by, reviewed_by, status, reason, created_at, updated_at"
+
+// RequestErasure records a pending erasure request for given profile
+func RequestErasure(ctx context.Context, db *sqlx.DB, profileID, requestedBy uint, reason string) (ErasureRequest, error) {
+	p, err := repository.NewProfileRepository(db).Find(ctx, profileID)
+	if err != nil {
+		return ErasureRequest{}, err
+	}
+
+	res, err := db.ExecContext(ctx, "INSERT INTO erasure_requests (branch_id, profile_id, requested_by, status, reason) VALUES (?, ?, ?, ?, ?)",
+		p.BranchID, profileID, requestedBy, StatusRequested, reason)
+	if err != nil {
+		return ErasureRequest{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return ErasureRequest{}, err
+	}
+
+	if err := audit.Record(ctx, db, requestedBy, "erasure-requested", "profile", profileID, reason); err != nil {
+		return ErasureRequest{}, err
+	}
+
+	return FindErasureRequest(ctx, db, uint(id))
+}
+
+// FindErasureRequest returns erasure request with given id in the branch of ctx
+func FindErasureRequest(ctx context.Context, db sqlx.QueryerContext, id uint) (ErasureRequest, error) {
+	var req ErasureRequest
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := sqlx.GetContext(ctx, db, &req, "SELECT "+erasureColumns+" FROM erasure_requests WHERE id = ? AND "+branch, append([]interface{}{id}, args...)...)
+	if err == sql.ErrNoRows {
+		return req, ErrErasureRequestNotFound
+	}
+	return req, err
+}
+
+// RejectErasure marks a pending erasure request as rejected by given admin
+func RejectErasure(ctx context.Context, db *sqlx.DB, id, adminID uint) error {
+	return mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		req, err := lockPending(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE erasure_requests SET status = ?, reviewed_by = ? WHERE id = ?", StatusRejected, adminID, id); err != nil {
+			return err
+		}
+
+		return audit.Record(ctx, tx, adminID, "erasure-rejected", "profile", req.ProfileID, "")
+	})
+}
+
+// Stores holding objects of an erasure request
+const (
+	fileStore     = "storage"
+	privateStore  = "private"
+	documentStore = "documents"
+)
+
+// erasureFile is a stored object to delete once an erasure is approved
+type erasureFile struct {
+	ID         uint   `db:"id"`
+	Store      string `db:"store"`
+	FilePrefix string `db:"file_prefix"`
+	Filename   string `db:"filename"`
+}
+
+// ApproveErasure anonymizes the profile of a pending erasure request and
+// deletes its photo, documents, registry files and transfer packages. Objects to delete are recorded
+// along with the anonymization, so an approved request whose deletion
+// failed is processed again until it is completed.
+func ApproveErasure(ctx context.Context, db *sqlx.DB, stores Stores, id, adminID uint) error {
+	var req ErasureRequest
+	err := mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		var err error
+		if req, err = lockErasure(ctx, tx, id); err != nil {
+			return err
+		}
+		switch req.Status {
+		case StatusApproved:
+			return nil
+		case StatusRequested:
+		default:
+			return ErrErasureNotPending
+		}
+
+		var photo string
+		if err := tx.GetContext(ctx, &photo, "SELECT photo FROM profiles WHERE id = ?", req.ProfileID); err != nil {
+			return err
+		}
+		if photo != "" {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO erasure_request_files (erasure_request_id, store, file_prefix, filename) VALUES (?, ?, ?, ?)",
+				id, fileStore, profile.PhotoPrefix(req.ProfileID), photo); err != nil {
+				return err
+			}
+		}
+
+		versions := []struct {
+			DocumentID uint   `db:"document_id"`
+			Filename   string `db:"filename"`
+		}{}
+		if err := tx.SelectContext(ctx, &versions, "SELECT v.document_id, v.filename FROM document_versions v JOIN documents d ON d.id = v.document_id WHERE d.profile_id = ?", req.ProfileID); err != nil {
+			return err
+		}
+		for _, v := range versions {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO erasure_request_files (erasure_request_id, store, file_prefix, filename) VALUES (?, ?, ?, ?)",
+				id, documentStore, document.Prefix(req.ProfileID, v.DocumentID), v.Filename); err != nil {
+				return err
+			}
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO erasure_request_files (erasure_request_id, store, file_prefix, filename) SELECT ?, ?, ?, filename FROM private_documents WHERE profile_id = ?",
+			id, documentStore, profile.PrivateDocumentPrefix(req.ProfileID), req.ProfileID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO erasure_request_files (erasure_request_id, store, file_prefix, filename) SELECT ?, ?, ?, filename FROM registry_files WHERE profile_id = ?",
+			id, privateStore, registry.Prefix, req.ProfileID); err != nil {
+			return err
+		}
+
+		packages := []struct {
+			ID      uint   `db:"id"`
+			Package string `db:"package"`
+		}{}
+		if err := tx.SelectContext(ctx, &packages, "SELECT id, package FROM transfers WHERE profile_id = ? AND package != ''", req.ProfileID); err != nil {
+			return err
+		}
+		for _, p := range packages {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO erasure_request_files (erasure_request_id, store, file_prefix, filename) VALUES (?, ?, ?, ?)",
+				id, documentStore, transfer.Prefix(p.ID), p.Package); err != nil {
+				return err
+			}
+		}
+
+		if err := anonymize(ctx, tx, req.ProfileID); err != nil {
+			return err
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE erasure_requests SET status = ?, reviewed_by = ? WHERE id = ?", StatusApproved, adminID, id); err != nil {
+			return err
+		}
+
+		return audit.Record(ctx, tx, adminID, "erasure-approved", "profile", req.ProfileID, "")
+	})
+	if err != nil {
+		return err
+	}
+
+	return completeErasure(ctx, db, map[string]storage.StorageInterface{fileStore: stores.Files, privateStore: stores.Private, documentStore: stores.Documents}, req, adminID)
+}
+
+// completeErasure deletes the recorded objects of an approved request,
+// forgetting each one once deleted, then marks the request completed
+func completeErasure(ctx context.Context, db *sqlx.DB, stores map[string]storage.StorageInterface, req ErasureRequest, adminID uint) error {
+	files := []erasureFile{}
+	if err := db.SelectContext(ctx, &files, "SELECT id, store, file_prefix, filename FROM erasure_request_files WHERE erasure_request_id = ? ORDER BY id", req.ID); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		store, ok := stores[f.Store]
+		if !ok {
+			return fmt.Errorf("unknown erasure store %q", f.Store)
+		}
+		if err := store.Delete(f.FilePrefix, f.Filename); err != nil {
+			return err
+		}
+		if _, err := db.ExecContext(ctx, "DELETE FROM erasure_request_files WHERE id = ?", f.ID); err != nil {
+			return err
+		}
+	}
+
+	if _, err := db.ExecContext(ctx, "UPDATE erasure_requests SET status = ? WHERE id = ?", StatusCompleted, req.ID); err != nil {
+		return err
+	}
+
+	return audit.Record(ctx, db, adminID, "erasure-completed", "profile", req.ProfileID, "")
+}
+
+func lockPending(ctx context.Context, tx *sqlx.Tx, id uint) (ErasureRequest, error) {
+	req, err := lockErasure(ctx, tx, id)
+	if err != nil {
+		return req, err
+	}
+
+	if req.Status != StatusRequested {
+		return req, ErrErasureNotPending
+	}
+	return req, nil
+}
+
+func lockErasure(ctx context.Context, tx *sqlx.Tx, id uint) (ErasureRequest, error) {
+	var req ErasureRequest
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := tx.GetContext(ctx, &req, "SELECT "+erasureColumns+" FROM erasure_requests WHERE id = ? AND "+branch+" FOR UPDATE", append([]interface{}{id}, args...)...)
+	if err == sql.ErrNoRows {
+		return req, ErrErasureRequestNotFound
+	}
+	return req, err
+}
+
+func anonymize(ctx context.Context, tx *sqlx.Tx, profileID uint) error {
+	queries := []string{
+		"UPDATE profiles SET user_id = 0, household_id = NULL, version = version + 1, name = 'Deleted member', gender = '', birth_date = NULL, phone = '', email = '', address = '', photo = '', visibility = NULL, deleted_at = NOW() WHERE id = ?",
+		"UPDATE profile_histories SET old_value = NULL, new_value = NULL WHERE profile_id = ?",
+		"DELETE FROM group_members WHERE profile_id = ?",
+		"DELETE FROM profile_name_trigrams WHERE profile_id = ?",
+		"DELETE v FROM document_versions v JOIN documents d ON d.id = v.document_id WHERE d.profile_id = ?",
+		"DELETE FROM documents WHERE profile_id = ?",
+		"DELETE FROM private_documents WHERE profile_id = ?",
+		"DELETE FROM registry_files WHERE profile_id = ?",
+		"UPDATE transfers SET reason = NULL, package = '' WHERE profile_id = ?",
+	}
+
+	for _, q := range queries {
+		if _, err := tx.ExecContext(ctx, q, profileID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
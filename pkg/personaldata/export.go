@@ -0,0 +1,160 @@
+package personaldata
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/registry"
+	"github.com/gkkkb/pokedex/pkg/repository"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/transfer"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Stores holds the storages personal data is kept in
+type Stores struct {
+	// Files keeps profile photos
+	Files storage.StorageInterface
+	// Private keeps registry files
+	Private storage.StorageInterface
+	// Documents keeps documents, private documents and transfer packages
+	Documents storage.StorageInterface
+}
+
+// Export writes a zip archive of every personal data held for given profile
+// into w, querying repos and, for transfers, db. Files are read from stores.
+func Export(ctx context.Context, db sqlx.QueryerContext, repos *repository.Repositories, stores Stores, profileID uint, w io.Writer) error {
+	p, err := repos.Profiles.Find(ctx, profileID)
+	if err != nil {
+		return err
+	}
+
+	histories, err := repos.Profiles.Histories(ctx, profileID)
+	if err != nil {
+		return err
+	}
+
+	attendances, err := repos.Profiles.Attendances(ctx, profileID)
+	if err != nil {
+		return err
+	}
+
+	docs, err := repos.Documents.All(ctx, profileID)
+	if err != nil {
+		return err
+	}
+
+	versions := map[uint][]document.Version{}
+	for _, d := range docs {
+		if versions[d.ID], err = repos.Documents.Versions(ctx, d.ID); err != nil {
+			return err
+		}
+	}
+
+	privateDocs, err := repos.PrivateDocuments.All(ctx, profileID)
+	if err != nil {
+		return err
+	}
+
+	registryFiles, err := repos.Registry.ForProfile(ctx, profileID)
+	if err != nil {
+		return err
+	}
+
+	transfers, err := transfer.ForProfile(ctx, db, profileID)
+	if err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+
+	entries := map[string]interface{}{
+		"profile.json":           p,
+		"groups.json":            p.GroupIDs,
+		"history.json":           histories,
+		"attendances.json":       attendances,
+		"documents.json":         docs,
+		"private-documents.json": privateDocs,
+		"registry-files.json":    registryFiles,
+		"transfers.json":         transfers,
+	}
+	for name, v := range entries {
+		if err := writeJSON(archive, name, v); err != nil {
+			return err
+		}
+	}
+
+	if p.Photo != "" {
+		if err := writeFile(archive, stores.Files, profile.PhotoPrefix(p.ID), p.Photo, path.Join("files", p.Photo)); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range docs {
+		for _, v := range versions[d.ID] {
+			dest := path.Join("documents", fmt.Sprint(d.ID), v.Filename)
+			if err := writeFile(archive, stores.Documents, document.Prefix(profileID, d.ID), v.Filename, dest); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, d := range privateDocs {
+		if err := writeFile(archive, stores.Documents, profile.PrivateDocumentPrefix(profileID), d.Filename, path.Join("private-documents", d.Filename)); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range registryFiles {
+		if err := writeFile(archive, stores.Private, registry.Prefix, f.Filename, path.Join("registry-files", f.Filename)); err != nil {
+			return err
+		}
+	}
+
+	for _, t := range transfers {
+		if !t.HasPackage() {
+			continue
+		}
+		if err := writeFile(archive, stores.Documents, transfer.Prefix(t.ID), t.Package, path.Join("transfers", fmt.Sprint(t.ID), t.Package)); err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+func writeJSON(archive *zip.Writer, name string, v interface{}) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func writeFile(archive *zip.Writer, store storage.StorageInterface, filePrefix, filename, dest string) error {
+	src, err := store.Get(filePrefix, filename)
+	if err != nil {
+		return err
+	}
+	if c, ok := src.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	f, err := archive.Create(dest)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(f, src)
+	return err
+}
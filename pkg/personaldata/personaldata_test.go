@@ -0,0 +1,148 @@
+package personaldata_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/personaldata"
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/registry"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+	"github.com/gkkkb/pokedex/pkg/transfer"
+)
+
+const memberID = 9601
+
+// storedFile is an object of the member kept in one of the stores
+type storedFile struct {
+	store      func(personaldata.Stores) storage.StorageInterface
+	filePrefix string
+	filename   string
+	content    string
+	// entry is the path of the file in the export
+	entry string
+}
+
+var memberFiles = []storedFile{
+	{documentsStore, document.Prefix(memberID, 9602), "baptism.pdf", "baptism", "documents/9602/baptism.pdf"},
+	{documentsStore, profile.PrivateDocumentPrefix(memberID), "id-card.pdf", "id card", "private-documents/id-card.pdf"},
+	{privateStore, registry.Prefix, "lukas.tif", "lukas", "registry-files/lukas.tif"},
+	{documentsStore, transfer.Prefix(9603), "package.zip", "package", "transfers/9603/package.zip"},
+}
+
+func documentsStore(s personaldata.Stores) storage.StorageInterface { return s.Documents }
+func privateStore(s personaldata.Stores) storage.StorageInterface   { return s.Private }
+
+// setup loads the member of testdata/profile.yml and stores its files
+func setup(t *testing.T) (*pokedex.Pokedex, personaldata.Stores) {
+	db := pokedextest.DB(t)
+	pokedextest.LoadFixtures(t, db, "testdata/profile.yml")
+	instance := pokedextest.Instance(t, db)
+	stores := personaldata.Stores{Files: instance.Storage, Private: instance.Private, Documents: instance.Documents}
+
+	for _, f := range memberFiles {
+		if err := f.store(stores).Put(f.filePrefix, f.filename, strings.NewReader(f.content)); err != nil {
+			t.Fatalf("put %s: %v", f.filename, err)
+		}
+	}
+	if err := instance.Private.Put(registry.Prefix, "book.tif", strings.NewReader("book")); err != nil {
+		t.Fatalf("put book.tif: %v", err)
+	}
+	return instance, stores
+}
+
+func TestExport(t *testing.T) {
+	instance, stores := setup(t)
+	ctx := tenant.NewContext(context.Background(), 1)
+
+	var buf bytes.Buffer
+	if err := personaldata.Export(ctx, instance.DB, instance.Repo, stores, memberID, &buf); err != nil {
+		t.Fatalf("Export: %v", err)
+	}
+
+	archive, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries := map[string]string{}
+	for _, f := range archive.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries[f.Name] = string(content)
+	}
+
+	for _, f := range memberFiles {
+		if got, ok := entries[f.entry]; !ok || got != f.content {
+			t.Errorf("entry %s = %q (present %v), want %q", f.entry, got, ok, f.content)
+		}
+	}
+	if !strings.Contains(entries["registry-files.json"], "lukas.tif") || strings.Contains(entries["registry-files.json"], "book.tif") {
+		t.Errorf("registry-files.json = %s, want only the member's file", entries["registry-files.json"])
+	}
+	if !strings.Contains(entries["transfers.json"], "GKKK Medan") {
+		t.Errorf("transfers.json = %s, want the transfer to GKKK Medan", entries["transfers.json"])
+	}
+	if !strings.Contains(entries["private-documents.json"], "id-card.pdf") {
+		t.Errorf("private-documents.json = %s, want id-card.pdf", entries["private-documents.json"])
+	}
+}
+
+func TestApproveErasure(t *testing.T) {
+	instance, stores := setup(t)
+	ctx := tenant.NewContext(context.Background(), 1)
+
+	req, err := personaldata.RequestErasure(ctx, instance.DB, memberID, 7, "")
+	if err != nil {
+		t.Fatalf("RequestErasure: %v", err)
+	}
+	if err := personaldata.ApproveErasure(ctx, instance.DB, stores, req.ID, 7); err != nil {
+		t.Fatalf("ApproveErasure: %v", err)
+	}
+
+	for _, f := range memberFiles {
+		if _, err := f.store(stores).Stat(f.filePrefix, f.filename); err != storage.ErrFileNotFound {
+			t.Errorf("stat %s after erasure: %v, want %v", f.entry, err, storage.ErrFileNotFound)
+		}
+	}
+	if _, err := instance.Private.Stat(registry.Prefix, "book.tif"); err != nil {
+		t.Errorf("registry file of no member erased: %v", err)
+	}
+
+	counts := map[string]string{
+		"private documents": "SELECT COUNT(*) FROM private_documents WHERE profile_id = ?",
+		"registry files":    "SELECT COUNT(*) FROM registry_files WHERE profile_id = ?",
+		"transfer packages": "SELECT COUNT(*) FROM transfers WHERE profile_id = ? AND package != ''",
+	}
+	for name, query := range counts {
+		var n int
+		if err := instance.DB.Get(&n, query, memberID); err != nil {
+			t.Fatalf("count %s: %v", name, err)
+		}
+		if n != 0 {
+			t.Errorf("%d %s left after erasure, want 0", n, name)
+		}
+	}
+
+	req, err = personaldata.FindErasureRequest(ctx, instance.DB, req.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Status != personaldata.StatusCompleted {
+		t.Errorf("status %s, want %s", req.Status, personaldata.StatusCompleted)
+	}
+}
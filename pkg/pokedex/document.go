@@ -0,0 +1,182 @@
+package pokedex
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/audit"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/document"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// AllDocuments lists documents attached to a profile with their latest versions
+func AllDocuments(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	docs, err := instance.Repo.Documents.All(r.Context(), p.ID)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, docs, http.StatusOK)
+}
+
+// CreateDocument attaches a new document to a profile
+func CreateDocument(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	file, header, err := documentFile(w, r)
+	if err != nil {
+		return writeError(w, err, "file")
+	}
+	defer file.Close()
+
+	docType := r.FormValue("type")
+	title := r.FormValue("title")
+	if title == "" {
+		title = header.Filename
+	}
+
+	doc, err := instance.Repo.Documents.Create(ctx, instance.Documents, p.ID, docType, title, newUpload(file, header, user.ID))
+	if err == document.ErrInvalidType {
+		ce := response.InvalidParameterError
+		ce.Field = "type"
+		return writeError(w, ce, "type")
+	}
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, doc, http.StatusCreated)
+}
+
+// CreateDocumentVersion uploads a new version of a profile document
+func CreateDocumentVersion(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	documentID, err := uintParam(params, "document_id")
+	if err != nil {
+		return writeError(w, err, "document_id")
+	}
+
+	file, header, err := documentFile(w, r)
+	if err != nil {
+		return writeError(w, err, "file")
+	}
+	defer file.Close()
+
+	v, err := instance.Repo.Documents.AddVersion(ctx, instance.Documents, p.ID, documentID, newUpload(file, header, user.ID))
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, v, http.StatusCreated)
+}
+
+// AllDocumentVersions lists every version of a profile document
+func AllDocumentVersions(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+
+	doc, err := managedDocument(r, params)
+	if err != nil {
+		return writeError(w, err, "document_id")
+	}
+
+	versions, err := instance.Repo.Documents.Versions(ctx, doc.ID)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, versions, http.StatusOK)
+}
+
+// DownloadDocumentVersion streams a version of a profile document,
+// its latest version when version is "latest"
+func DownloadDocumentVersion(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	doc, err := managedDocument(r, params)
+	if err != nil {
+		return writeError(w, err, "document_id")
+	}
+
+	var version uint
+	if params.ByName("version") != "latest" {
+		if version, err = uintParam(params, "version"); err != nil {
+			return writeError(w, err, "version")
+		}
+	}
+
+	v, err := instance.Repo.Documents.FindVersion(ctx, doc.ID, version)
+	if err != nil {
+		return writeError(w, err, "version")
+	}
+
+	f, err := instance.Documents.Get(document.Prefix(doc.ProfileID, doc.ID), v.Filename)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	if err := audit.Record(ctx, instance.DB, user.ID, "document-downloaded", "document", doc.ID, fmt.Sprintf("version %d", v.Version)); err != nil {
+		return writeError(w, err, "")
+	}
+
+	w.Header().Set("Content-Type", v.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", v.OriginalName))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// managedDocument returns document of document_id param if the current user may manage its profile
+func managedDocument(r *http.Request, params httprouter.Params) (document.Document, error) {
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return document.Document{}, err
+	}
+
+	documentID, err := uintParam(params, "document_id")
+	if err != nil {
+		return document.Document{}, err
+	}
+
+	return pokedex.GetInstance().Repo.Documents.Find(r.Context(), p.ID, documentID)
+}
+
+func documentFile(w http.ResponseWriter, r *http.Request) (multipart.File, *multipart.FileHeader, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentSize)
+	return r.FormFile("file")
+}
+
+func newUpload(file multipart.File, header *multipart.FileHeader, uploadedBy uint) document.Upload {
+	return document.Upload{File: file, OriginalName: header.Filename, Size: header.Size, UploadedBy: uploadedBy}
+}
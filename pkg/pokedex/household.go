@@ -0,0 +1,64 @@
+package pokedex
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/repository"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type householdParams struct {
+	Version *uint   `json:"version"`
+	Name    *string `json:"name"`
+	Address *string `json:"address"`
+}
+
+// UpdateHousehold edits a household based on the version the client last
+// read, answering with the current household when someone else edited it since
+func UpdateHousehold(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+
+	id, err := uintParam(params, "household_id")
+	if err != nil {
+		return writeError(w, err, "household_id")
+	}
+
+	h, err := instance.Repo.Households.Find(ctx, id)
+	if err != nil {
+		return writeError(w, err, "household_id")
+	}
+
+	var body householdParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return writeError(w, err, "")
+	}
+	if body.Version == nil {
+		return writeError(w, invalidParameter("version"), "version")
+	}
+	h.Version = *body.Version
+
+	if body.Name != nil {
+		if strings.TrimSpace(*body.Name) == "" {
+			return writeError(w, invalidParameter("name"), "name")
+		}
+		h.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.Address != nil {
+		h.Address = *body.Address
+	}
+
+	updated, err := instance.Repo.Households.Update(ctx, h)
+	if ce, ok := err.(*repository.ConflictError); ok {
+		return writeConflict(w, ce.Current)
+	}
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, updated, http.StatusOK)
+}
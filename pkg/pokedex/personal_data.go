@@ -0,0 +1,121 @@
+package pokedex
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/audit"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/personaldata"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+type erasureRequestParams struct {
+	Reason string `json:"reason"`
+}
+
+// ExportPersonalData streams a zip archive of every data held for a profile
+// straight to the client
+func ExportPersonalData(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+	profileID := p.ID
+
+	// the export is recorded before streaming, as a failure halfway through
+	// can no longer be reported once the archive is being written
+	if err := audit.Record(ctx, instance.DB, user.ID, "personal-data-exported", "profile", profileID, ""); err != nil {
+		return writeError(w, err, "")
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"profile-%d.zip\"", profileID))
+	w.WriteHeader(http.StatusOK)
+	return personaldata.Export(ctx, instance.Replicas.ReadOnly(), instance.Repo.ReadOnly, personalDataStores(instance), profileID, w)
+}
+
+func personalDataStores(instance *pokedex.Pokedex) personaldata.Stores {
+	return personaldata.Stores{Files: instance.Storage, Private: instance.Private, Documents: instance.Documents}
+}
+
+// RequestErasure records a request to erase a profile's personal data
+func RequestErasure(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+	profileID := p.ID
+
+	var body erasureRequestParams
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			return writeError(w, err, "")
+		}
+	}
+
+	req, err := personaldata.RequestErasure(ctx, instance.DB, profileID, user.ID, body.Reason)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, req, http.StatusCreated)
+}
+
+// ApproveErasure anonymizes the profile of a pending erasure request, or
+// retries deleting stored files of an approved one
+func ApproveErasure(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	id, err := uintParam(params, "erasure_request_id")
+	if err != nil {
+		return writeError(w, err, "erasure_request_id")
+	}
+
+	if err := personaldata.ApproveErasure(ctx, instance.DB, personalDataStores(instance), id, user.ID); err != nil {
+		return writeError(w, err, "")
+	}
+
+	req, err := personaldata.FindErasureRequest(ctx, instance.DB, id)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, req, http.StatusOK)
+}
+
+// RejectErasure rejects a pending erasure request
+func RejectErasure(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	id, err := uintParam(params, "erasure_request_id")
+	if err != nil {
+		return writeError(w, err, "erasure_request_id")
+	}
+
+	if err := personaldata.RejectErasure(ctx, instance.DB, id, user.ID); err != nil {
+		return writeError(w, err, "")
+	}
+
+	req, err := personaldata.FindErasureRequest(ctx, instance.DB, id)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, req, http.StatusOK)
+}
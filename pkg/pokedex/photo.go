@@ -0,0 +1,169 @@
+package pokedex
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/api/request"
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/upload"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// uploadExpiry is how long a presigned upload URL stays valid
+const uploadExpiry = 15 * time.Minute
+
+var photoExtensions = []string{".jpg", ".jpeg", ".png"}
+
+type photoUploadParams struct {
+	Filename string `json:"filename"`
+}
+
+type photoUpload struct {
+	Filename  string    `json:"filename"`
+	UploadURL string    `json:"upload_url"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type photoResult struct {
+	Filename string            `json:"filename"`
+	URL      string            `json:"url"`
+	Variants map[string]string `json:"variants"`
+}
+
+func newPhotoResult(store storage.StorageInterface, prefix string, filename string) (photoResult, error) {
+	url, err := store.GetPath(prefix, filename)
+	if err != nil {
+		return photoResult{}, err
+	}
+
+	result := photoResult{Filename: filename, URL: url, Variants: map[string]string{}}
+	for _, v := range storage.Variants {
+		if result.Variants[v.Name], err = storage.GetVariantPath(store, prefix, filename, v.Name); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// CreatePhotoUpload returns a presigned URL the client uploads a profile photo to directly
+func CreatePhotoUpload(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	var body photoUploadParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return writeError(w, err, "")
+	}
+
+	ext := strings.ToLower(filepath.Ext(body.Filename))
+	if !isInSliceString(ext, photoExtensions) {
+		return writeError(w, response.InvalidFileTypeError, "filename")
+	}
+
+	filename := request.CreateRequestID() + ext
+	url, err := instance.Storage.PresignedPutURL(profile.PhotoPrefix(p.ID), filename, uploadExpiry)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, photoUpload{Filename: filename, UploadURL: url, ExpiresAt: time.Now().Add(uploadExpiry)}, http.StatusCreated)
+}
+
+// ConfirmPhotoUpload attaches a directly uploaded photo to the profile once it exists in storage
+func ConfirmPhotoUpload(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	var body photoUploadParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return writeError(w, err, "")
+	}
+
+	prefix := profile.PhotoPrefix(p.ID)
+	info, err := instance.Storage.Stat(prefix, body.Filename)
+	if err == storage.ErrFileNotFound {
+		return writeError(w, response.UploadNotExistsError, "filename")
+	}
+	if err != nil {
+		return writeError(w, err, "filename")
+	}
+	if info.Size > upload.Purposes[upload.PurposePhoto].Limit() {
+		instance.Storage.Delete(prefix, body.Filename)
+		return writeError(w, response.FileTooLargeError, "filename")
+	}
+
+	f, err := instance.Storage.Get(prefix, body.Filename)
+	if err == storage.ErrFileNotFound {
+		return writeError(w, response.UploadNotExistsError, "filename")
+	}
+	if err != nil {
+		return writeError(w, err, "filename")
+	}
+	b, err := ioutil.ReadAll(f)
+	if c, ok := f.(io.Closer); ok {
+		c.Close()
+	}
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	// direct uploads skip the image pipeline, put the file again to strip
+	// EXIF data and generate variants
+	if err := instance.Storage.Put(prefix, body.Filename, bytes.NewReader(b)); err != nil {
+		return writeError(w, err, "filename")
+	}
+
+	if err := instance.Repo.Profiles.UpdatePhoto(ctx, p.ID, body.Filename); err != nil {
+		return writeError(w, err, "")
+	}
+
+	if p.Photo != "" && p.Photo != body.Filename {
+		instance.Storage.Delete(prefix, p.Photo)
+	}
+
+	result, err := newPhotoResult(instance.Storage, prefix, body.Filename)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, result, http.StatusOK)
+}
+
+// managedProfile returns profile of profile_id param if the current user may manage it
+func managedProfile(r *http.Request, params httprouter.Params) (profile.Profile, error) {
+	id, err := uintParam(params, "profile_id")
+	if err != nil {
+		return profile.Profile{}, err
+	}
+
+	p, err := pokedex.GetInstance().Repo.Profiles.Find(r.Context(), id)
+	if err != nil {
+		return p, err
+	}
+
+	if !canManage(currentuser.FromContext(r.Context()), p) {
+		return p, response.UserUnauthorizedError
+	}
+	return p, nil
+}
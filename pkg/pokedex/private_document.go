@@ -0,0 +1,134 @@
+package pokedex
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/api/request"
+	"github.com/gkkkb/pokedex/pkg/audit"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/repository"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxDocumentSize is the largest private document accepted in one request
+const maxDocumentSize = 32 << 20
+
+// AllPrivateDocuments lists private documents of a profile, newest first
+func AllPrivateDocuments(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	docs, err := instance.Repo.PrivateDocuments.All(r.Context(), p.ID)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, docs, http.StatusOK)
+}
+
+// UploadPrivateDocument stores an encrypted private document of a profile.
+// The file is put before the transaction recording it and deleted when
+// recording fails.
+func UploadPrivateDocument(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxDocumentSize)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return writeError(w, err, "file")
+	}
+	defer file.Close()
+
+	ext := strings.ToLower(filepath.Ext(header.Filename))
+	doc := document.Private{
+		BranchID:     p.BranchID,
+		ProfileID:    p.ID,
+		Filename:     request.CreateRequestID() + ext,
+		OriginalName: header.Filename,
+		ContentType:  mime.TypeByExtension(ext),
+		Size:         header.Size,
+		UploadedBy:   user.ID,
+	}
+
+	prefix := profile.PrivateDocumentPrefix(p.ID)
+	if err := instance.Documents.Put(prefix, doc.Filename, file); err != nil {
+		return writeError(w, err, "file")
+	}
+
+	err = mysql.WithTx(ctx, instance.DB, func(tx *sqlx.Tx) error {
+		if doc, err = repository.NewPrivateDocumentRepository(tx).Create(ctx, doc); err != nil {
+			return err
+		}
+		return audit.Record(ctx, tx, user.ID, "private-document-uploaded", "profile", p.ID, doc.Filename)
+	})
+	if err != nil {
+		instance.Documents.Delete(prefix, doc.Filename)
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, doc, http.StatusCreated)
+}
+
+// DownloadPrivateDocument decrypts and streams a private document of a profile
+func DownloadPrivateDocument(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	// only recorded documents of the profile are served, whatever the store holds
+	doc, err := instance.Repo.PrivateDocuments.Find(ctx, p.ID, params.ByName("filename"))
+	if err != nil {
+		return writeError(w, err, "filename")
+	}
+
+	f, err := instance.Documents.Get(profile.PrivateDocumentPrefix(p.ID), doc.Filename)
+	if err != nil {
+		return writeError(w, err, "filename")
+	}
+	if c, ok := f.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	if err := audit.Record(ctx, instance.DB, user.ID, "private-document-downloaded", "profile", p.ID, doc.Filename); err != nil {
+		return writeError(w, err, "")
+	}
+
+	name := doc.OriginalName
+	if name == "" {
+		name = doc.Filename
+	}
+
+	w.Header().Set("Content-Type", doc.ContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -0,0 +1,79 @@
+package pokedex_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+)
+
+func TestPrivateDocuments(t *testing.T) {
+	db := pokedextest.DB(t)
+	pokedextest.LoadFixtures(t, db, "testdata/profiles.yml")
+	srv := pokedextest.Server(t, db)
+
+	admin := pokedextest.User{ID: 7, Role: "ADM", Username: "admin", BranchID: 1}
+	url := srv.URL + "/profiles/9401/private-documents"
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "id-card.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte("identity card"))
+	form.Close()
+
+	req := pokedextest.Request(t, "POST", url, &body, admin)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var created struct {
+		Data document.Private `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&created)
+	res.Body.Close()
+	if err != nil || res.StatusCode != http.StatusCreated {
+		t.Fatalf("upload status %d, decode error %v", res.StatusCode, err)
+	}
+
+	res, err = http.DefaultClient.Do(pokedextest.Request(t, "GET", url, nil, admin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var listed struct {
+		Data []document.Private `json:"data"`
+	}
+	err = json.NewDecoder(res.Body).Decode(&listed)
+	res.Body.Close()
+	if err != nil || len(listed.Data) != 1 || listed.Data[0].OriginalName != "id-card.pdf" {
+		t.Fatalf("listed %+v, decode error %v, want id-card.pdf", listed.Data, err)
+	}
+
+	res, err = http.DefaultClient.Do(pokedextest.Request(t, "GET", url+"/"+created.Data.Filename, nil, admin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || string(content) != "identity card" {
+		t.Errorf("download status %d content %q, want the uploaded file", res.StatusCode, content)
+	}
+
+	// files not recorded for the profile are not served
+	res, err = http.DefaultClient.Do(pokedextest.Request(t, "GET", url+"/unrecorded.pdf", nil, admin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("unrecorded file status %d, want %d", res.StatusCode, http.StatusNotFound)
+	}
+}
@@ -0,0 +1,219 @@
+package pokedex
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/repository"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// profileParams holds editable profile fields, absent fields are kept
+type profileParams struct {
+	Version     *uint                   `json:"version"`
+	HouseholdID *uint                   `json:"household_id"`
+	Name        *string                 `json:"name"`
+	Gender      *string                 `json:"gender"`
+	BirthDate   *string                 `json:"birth_date"`
+	Phone       *string                 `json:"phone"`
+	Email       *string                 `json:"email"`
+	Address     *string                 `json:"address"`
+	Visibility  profile.FieldVisibility `json:"visibility"`
+}
+
+const (
+	defaultProfileLimit = 20
+	maxProfileLimit     = 100
+)
+
+// DetailProfile returns a profile with fields hidden from the current user cleared
+func DetailProfile(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ctx := r.Context()
+
+	id, err := uintParam(params, "profile_id")
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	p, err := pokedex.GetInstance().Repo.Profiles.Find(ctx, id)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	visible, err := visibleProfiles(ctx, p)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, visible[0], http.StatusOK)
+}
+
+// AllProfiles lists profiles of the current branch ordered by name, with
+// fields hidden from the current user cleared
+func AllProfiles(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	ctx := r.Context()
+
+	limit, err := queryInt(r, "limit", defaultProfileLimit, maxProfileLimit)
+	if err != nil {
+		return writeError(w, err, "limit")
+	}
+	offset, err := queryInt(r, "offset", 0, -1)
+	if err != nil {
+		return writeError(w, err, "offset")
+	}
+
+	profiles, err := pokedex.GetInstance().Repo.ReadOnly.Profiles.List(ctx, limit, offset)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	visible, err := visibleProfiles(ctx, profiles...)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	meta := response.MetaInfo{HTTPStatus: http.StatusOK, Limit: limit, Offset: offset}
+	response.Write(w, response.BuildSuccess(visible, meta), http.StatusOK)
+	return nil
+}
+
+// visibleProfiles returns profiles with fields hidden from the current
+// user cleared, relating the user by the groups of their own profile
+func visibleProfiles(ctx context.Context, profiles ...profile.Profile) ([]profile.Profile, error) {
+	user := currentuser.FromContext(ctx)
+
+	groupIDs, err := pokedex.GetInstance().Repo.ReadOnly.Profiles.ViewerGroupIDs(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := make([]profile.Profile, len(profiles))
+	for i, p := range profiles {
+		visible[i] = p.VisibleTo(profile.RelationOf(user, p, groupIDs))
+	}
+	return visible, nil
+}
+
+// queryInt returns a non negative integer query parameter capped by max,
+// or fallback when absent. A negative max means no cap.
+func queryInt(r *http.Request, name string, fallback, max int) (int, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 || max >= 0 && n > max {
+		return 0, invalidParameter(name)
+	}
+	return n, nil
+}
+
+// UpdateProfile edits a profile based on the version the client last read,
+// answering with the current profile when someone else edited it since
+func UpdateProfile(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	var body profileParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return writeError(w, err, "")
+	}
+	if body.Version == nil {
+		return writeError(w, invalidParameter("version"), "version")
+	}
+
+	if field, ok := body.apply(&p); !ok {
+		return writeError(w, invalidParameter(field), field)
+	}
+	if body.HouseholdID != nil {
+		h, err := instance.Repo.Households.Find(ctx, *body.HouseholdID)
+		if err != nil {
+			return writeError(w, err, "household_id")
+		}
+		// super admins see every branch, members still only join households of their own
+		if h.BranchID != p.BranchID {
+			return writeError(w, invalidParameter("household_id"), "household_id")
+		}
+	}
+
+	updated, err := instance.Repo.Profiles.Update(ctx, p, user.ID)
+	if ce, ok := err.(*repository.ConflictError); ok {
+		current, err := visibleProfiles(ctx, ce.Current.(profile.Profile))
+		if err != nil {
+			return writeError(w, err, "")
+		}
+		return writeConflict(w, current[0])
+	}
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	visible, err := visibleProfiles(ctx, updated)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+	return writeSuccess(w, visible[0], http.StatusOK)
+}
+
+// apply copies given fields into p, returning the first invalid field
+func (body profileParams) apply(p *profile.Profile) (string, bool) {
+	p.Version = *body.Version
+
+	if body.HouseholdID != nil {
+		p.HouseholdID = body.HouseholdID
+	}
+	if body.Name != nil {
+		if strings.TrimSpace(*body.Name) == "" {
+			return "name", false
+		}
+		p.Name = strings.TrimSpace(*body.Name)
+	}
+	if body.Gender != nil {
+		if !isInSliceString(*body.Gender, []string{"", "M", "F"}) {
+			return "gender", false
+		}
+		p.Gender = *body.Gender
+	}
+	if body.BirthDate != nil {
+		if *body.BirthDate == "" {
+			p.BirthDate = nil
+		} else {
+			t, err := time.Parse("2006-01-02", *body.BirthDate)
+			if err != nil {
+				return "birth_date", false
+			}
+			p.BirthDate = &t
+		}
+	}
+	if body.Phone != nil {
+		p.Phone = *body.Phone
+	}
+	if body.Email != nil {
+		p.Email = *body.Email
+	}
+	if body.Address != nil {
+		p.Address = *body.Address
+	}
+	if body.Visibility != nil {
+		if err := body.Visibility.Validate(); err != nil {
+			return "visibility", false
+		}
+		p.Visibility = body.Visibility
+	}
+	return "", true
+}
@@ -0,0 +1,67 @@
+package pokedex_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+	"github.com/gkkkb/pokedex/pkg/profile"
+)
+
+func TestDetailProfileIsScopedToBranch(t *testing.T) {
+	db := pokedextest.DB(t)
+	pokedextest.LoadFixtures(t, db, "testdata/profiles.yml")
+	srv := pokedextest.Server(t, db)
+
+	admin := pokedextest.User{ID: 7, Role: "ADM", Username: "admin", BranchID: 1}
+
+	res, err := http.DefaultClient.Do(pokedextest.Request(t, "GET", srv.URL+"/profiles/9401", nil, admin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("status %d, want %d", res.StatusCode, http.StatusOK)
+	}
+	var body struct {
+		Data profile.Profile `json:"data"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Data.ID != 9401 || body.Data.Name != "Maria" {
+		t.Errorf("got profile %d %q, want 9401 Maria", body.Data.ID, body.Data.Name)
+	}
+
+	// a profile of another branch does not exist for the admin
+	other, err := http.DefaultClient.Do(pokedextest.Request(t, "GET", srv.URL+"/profiles/9402", nil, admin))
+	if err != nil {
+		t.Fatal(err)
+	}
+	other.Body.Close()
+	if other.StatusCode != http.StatusNotFound {
+		t.Errorf("other branch status %d, want %d", other.StatusCode, http.StatusNotFound)
+	}
+
+	// unless the super admin picks it
+	sadm := pokedextest.Request(t, "GET", srv.URL+"/profiles/9402", nil, pokedextest.User{ID: 8, Role: "SADM", Username: "root", BranchID: 1})
+	sadm.Header.Set("GKKKB-Branch-ID", "2")
+	picked, err := http.DefaultClient.Do(sadm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	picked.Body.Close()
+	if picked.StatusCode != http.StatusOK {
+		t.Errorf("super admin status %d, want %d", picked.StatusCode, http.StatusOK)
+	}
+
+	unsigned, err := http.Get(srv.URL + "/profiles/9401")
+	if err != nil {
+		t.Fatal(err)
+	}
+	unsigned.Body.Close()
+	if unsigned.StatusCode == http.StatusOK {
+		t.Error("request without token was served")
+	}
+}
@@ -0,0 +1,85 @@
+package pokedex
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path/filepath"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/audit"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/registry"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultRegistryLimit = 20
+	maxRegistryLimit     = 100
+)
+
+// AllRegistryFiles lists registry scans uploaded to the current branch
+func AllRegistryFiles(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	limit, err := queryInt(r, "limit", defaultRegistryLimit, maxRegistryLimit)
+	if err != nil {
+		return writeError(w, err, "limit")
+	}
+	offset, err := queryInt(r, "offset", 0, -1)
+	if err != nil {
+		return writeError(w, err, "offset")
+	}
+
+	files, err := pokedex.GetInstance().Repo.Registry.All(r.Context(), limit, offset)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	meta := response.MetaInfo{HTTPStatus: http.StatusOK, Limit: limit, Offset: offset}
+	response.Write(w, response.BuildSuccess(files, meta), http.StatusOK)
+	return nil
+}
+
+// DownloadRegistryFile streams a registry scan from private storage
+func DownloadRegistryFile(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	id, err := uintParam(params, "registry_file_id")
+	if err != nil {
+		return writeError(w, err, "registry_file_id")
+	}
+
+	f, err := instance.Repo.Registry.Find(ctx, id)
+	if err != nil {
+		return writeError(w, err, "registry_file_id")
+	}
+
+	file, err := instance.Private.Get(registry.Prefix, f.Filename)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+	if c, ok := file.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	if err := audit.Record(ctx, instance.DB, user.ID, "registry-file-downloaded", "registry_file", f.ID, f.Filename); err != nil {
+		return writeError(w, err, "")
+	}
+
+	name := f.OriginalName
+	if name == "" {
+		name = f.Filename
+	}
+
+	w.Header().Set("Content-Type", mime.TypeByExtension(filepath.Ext(f.Filename)))
+	w.Header().Set("Content-Length", fmt.Sprint(f.Size))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, file)
+	return err
+}
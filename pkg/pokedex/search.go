@@ -0,0 +1,88 @@
+package pokedex
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/search"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+)
+
+// searchResult is a ranked search result along with the matched profile
+type searchResult struct {
+	search.Result
+	Profile profile.Profile `json:"profile"`
+}
+
+// SearchProfiles finds members by name despite spelling variants and typos,
+// answering every match with fields hidden from the current user cleared
+func SearchProfiles(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+
+	query := r.URL.Query().Get("q")
+	if len(search.Normalize(query)) < 2 {
+		return writeError(w, invalidParameter("q"), "q")
+	}
+
+	limit := defaultSearchLimit
+	if v := r.URL.Query().Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxSearchLimit {
+			return writeError(w, invalidParameter("limit"), "limit")
+		}
+		limit = n
+	}
+
+	results, err := instance.Repo.ReadOnly.Profiles.Search(ctx, query, limit)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	ids := make([]uint, len(results))
+	for i, res := range results {
+		ids[i] = res.ID
+	}
+	profiles, err := instance.Repo.ReadOnly.Profiles.FindMany(ctx, ids)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+	visible, err := visibleProfiles(ctx, profiles...)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	byID := make(map[uint]profile.Profile, len(visible))
+	for _, p := range visible {
+		byID[p.ID] = p
+	}
+	matches := make([]searchResult, 0, len(results))
+	for _, res := range results {
+		// a profile deleted since the search is left out
+		if p, ok := byID[res.ID]; ok {
+			matches = append(matches, searchResult{Result: res, Profile: p})
+		}
+	}
+
+	return writeSuccess(w, matches, http.StatusOK)
+}
+
+// ReindexProfileNames rebuilds the name search index of every profile
+func ReindexProfileNames(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+
+	indexed, err := instance.Repo.Profiles.ReindexNames(r.Context())
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, map[string]int{"indexed": indexed}, http.StatusOK)
+}
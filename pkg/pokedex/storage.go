@@ -0,0 +1,25 @@
+package pokedex
+
+import (
+	"net/http"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/filegc"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// OrphanedFiles reports stored files no longer referenced, without deleting them
+func OrphanedFiles(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+
+	cfg := filegc.ConfigFromEnv()
+	cfg.DryRun = true
+
+	report, err := filegc.Sweep(r.Context(), instance.DB, instance.FileStores(), filegc.Sources, cfg)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, report, http.StatusOK)
+}
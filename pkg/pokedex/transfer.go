@@ -0,0 +1,190 @@
+package pokedex
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/audit"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+	"github.com/gkkkb/pokedex/pkg/transfer"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// maxTransferPackageSize limits imported transfer packages
+const maxTransferPackageSize = 1 << 30
+
+type transferParams struct {
+	ToBranchID        uint   `json:"to_branch_id"`
+	DestinationChurch string `json:"destination_church"`
+	Reason            string `json:"reason"`
+}
+
+// RequestTransfer records a request to move a member to another branch or church
+func RequestTransfer(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	p, err := managedProfile(r, params)
+	if err != nil {
+		return writeError(w, err, "profile_id")
+	}
+
+	var body transferParams
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return writeError(w, err, "")
+	}
+
+	t, err := transfer.Request(ctx, instance.DB, p.ID, body.ToBranchID, strings.TrimSpace(body.DestinationChurch), user.ID, body.Reason)
+	if err == transfer.ErrInvalidDestination {
+		return writeError(w, invalidParameter("to_branch_id"), "to_branch_id")
+	}
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, t, http.StatusCreated)
+}
+
+// DetailTransfer returns a transfer leaving or entering the current branch
+func DetailTransfer(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	id, err := uintParam(params, "transfer_id")
+	if err != nil {
+		return writeError(w, err, "transfer_id")
+	}
+
+	t, err := transfer.Find(r.Context(), pokedex.GetInstance().DB, id)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, t, http.StatusOK)
+}
+
+// ApproveTransfer approves a transfer on behalf of the current branch,
+// completing it once every side approved
+func ApproveTransfer(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	id, err := uintParam(params, "transfer_id")
+	if err != nil {
+		return writeError(w, err, "transfer_id")
+	}
+
+	// a missing key only matters once a transfer out is packaged
+	key, _ := transfer.SigningKey()
+	out := transfer.Packager{Repos: instance.Repo, Store: instance.Storage, Documents: instance.Documents, Key: key, Church: transfer.Church()}
+	if err := transfer.Approve(ctx, instance.DB, out, id, user.ID); err != nil {
+		return writeError(w, err, "")
+	}
+
+	t, err := transfer.Find(ctx, instance.DB, id)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, t, http.StatusOK)
+}
+
+// RejectTransfer rejects a pending transfer on behalf of the current branch
+func RejectTransfer(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	id, err := uintParam(params, "transfer_id")
+	if err != nil {
+		return writeError(w, err, "transfer_id")
+	}
+
+	if err := transfer.Reject(ctx, instance.DB, id, user.ID); err != nil {
+		return writeError(w, err, "")
+	}
+
+	t, err := transfer.Find(ctx, instance.DB, id)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, t, http.StatusOK)
+}
+
+// DownloadTransferPackage streams the signed package of a completed transfer to another church
+func DownloadTransferPackage(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	id, err := uintParam(params, "transfer_id")
+	if err != nil {
+		return writeError(w, err, "transfer_id")
+	}
+
+	t, err := transfer.Find(ctx, instance.DB, id)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+	if !t.HasPackage() {
+		return writeError(w, transfer.ErrTransferNotFound, "")
+	}
+
+	f, err := instance.Documents.Get(transfer.Prefix(t.ID), t.Package)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+	if c, ok := f.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	if err := audit.Record(ctx, instance.DB, user.ID, "transfer-package-downloaded", "profile", t.ProfileID, fmt.Sprintf("transfer %d", t.ID)); err != nil {
+		return writeError(w, err, "")
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", t.Package))
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(http.StatusOK)
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// ImportTransferPackage creates a member of the current branch from a
+// transfer package signed by a trusted church, sent as the request body
+func ImportTransferPackage(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	branchID := tenant.FromContext(ctx)
+	if branchID == tenant.All || branchID == tenant.None {
+		return writeError(w, invalidParameter(tenant.Header), tenant.Header)
+	}
+
+	content, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxTransferPackageSize))
+	if err != nil {
+		return writeError(w, response.FileTooLargeError, "")
+	}
+
+	pkg, err := transfer.ReadPackage(bytes.NewReader(content), int64(len(content)), transfer.TrustedKeys())
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	p, err := transfer.Import(ctx, instance.DB, instance.Repo, instance.Storage, instance.Documents, pkg, branchID, user.ID)
+	if err != nil {
+		return writeError(w, err, "")
+	}
+
+	return writeSuccess(w, p, http.StatusCreated)
+}
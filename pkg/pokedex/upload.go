@@ -0,0 +1,223 @@
+package pokedex
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+	"github.com/gkkkb/pokedex/pkg/upload"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,expiration,termination"
+	// maxChunkSize is the most stored from a single PATCH, advertised as
+	// Tus-Max-Chunk-Size
+	maxChunkSize = 32 << 20
+)
+
+// UploadOptions describes the tus server capabilities
+func UploadOptions(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	var max int64
+	for _, p := range upload.Purposes {
+		if p.Limit() > max {
+			max = p.Limit()
+		}
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Tus-Version", tusVersion)
+	w.Header().Set("Tus-Extension", tusExtensions)
+	w.Header().Set("Tus-Max-Size", strconv.FormatInt(max, 10))
+	w.Header().Set("Tus-Max-Chunk-Size", strconv.Itoa(maxChunkSize))
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// CreateUpload starts a resumable upload. The purpose and, for photos, the
+// profile_id are given in Upload-Metadata. Registry files may name the
+// profile_id of the member they belong to.
+func CreateUpload(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+	ctx := r.Context()
+	user := currentuser.FromContext(ctx)
+
+	metadata := upload.ParseMetadata(r.Header.Get("Upload-Metadata"))
+	purpose, ok := upload.Purposes[metadata["purpose"]]
+	if !ok {
+		return writeTusError(w, invalidParameter("purpose"))
+	}
+
+	// uploads without a profile stay in the active branch, which for a super
+	// admin without one is tenant.All and only visible to super admins
+	branchID := tenant.FromContext(ctx)
+	var profileID uint
+	if purpose.Private && !isAdmin(user) {
+		return writeTusError(w, response.UserUnauthorizedError)
+	}
+	if !purpose.Private || metadata["profile_id"] != "" {
+		id, err := strconv.Atoi(metadata["profile_id"])
+		if err != nil || id <= 0 {
+			return writeTusError(w, invalidParameter("profile_id"))
+		}
+
+		p, err := instance.Repo.Profiles.Find(ctx, uint(id))
+		if err != nil {
+			return writeTusError(w, err)
+		}
+		if !canManage(user, p) {
+			return writeTusError(w, response.UserUnauthorizedError)
+		}
+		profileID = p.ID
+		branchID = p.BranchID
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil {
+		return writeTusError(w, invalidParameter("Upload-Length"))
+	}
+
+	u, err := upload.Create(ctx, instance.DB, purpose, branchID, profileID, length, r.Header.Get("Upload-Metadata"), user.ID)
+	if err != nil {
+		return writeTusError(w, err)
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Location", r.URL.Path+"/"+u.ID)
+	w.Header().Set("Upload-Expires", u.ExpiresAt.Format(http.TimeFormat))
+	w.WriteHeader(http.StatusCreated)
+	return nil
+}
+
+// UploadOffset returns how many bytes of an upload have been received,
+// retrying the assembly of an upload whose every chunk was received
+func UploadOffset(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+
+	u, err := ownedUpload(r, params)
+	if err != nil {
+		return writeTusError(w, err)
+	}
+
+	u, err = upload.Resume(r.Context(), instance.DB, instance.Documents, uploadDestination(u), u)
+	if err != nil {
+		return writeTusError(w, err)
+	}
+
+	writeUploadHeaders(w, u)
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+	return nil
+}
+
+// AppendUpload appends a chunk to an upload, assembling it once complete.
+// Only the first maxChunkSize bytes of a larger body are stored, the client
+// resumes from the returned Upload-Offset.
+func AppendUpload(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+
+	u, err := ownedUpload(r, params)
+	if err != nil {
+		return writeTusError(w, err)
+	}
+
+	if r.Header.Get("Content-Type") != "application/offset+octet-stream" {
+		return writeTusError(w, response.NoMediaError)
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		return writeTusError(w, invalidParameter("Upload-Offset"))
+	}
+
+	body := io.LimitReader(r.Body, maxChunkSize)
+	u, err = upload.Append(r.Context(), instance.DB, instance.Documents, uploadDestination(u), u, offset, body)
+	if err != nil {
+		return writeTusError(w, err)
+	}
+
+	writeUploadHeaders(w, u)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// TerminateUpload cancels an upload and deletes its received chunks
+func TerminateUpload(w http.ResponseWriter, r *http.Request, params httprouter.Params) error {
+	instance := pokedex.GetInstance()
+
+	u, err := ownedUpload(r, params)
+	if err != nil {
+		return writeTusError(w, err)
+	}
+
+	if err := upload.Terminate(r.Context(), instance.DB, instance.Documents, u); err != nil {
+		return writeTusError(w, err)
+	}
+
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// uploadDestination returns storage completed uploads of u's purpose are assembled into
+func uploadDestination(u upload.Upload) storage.StorageInterface {
+	instance := pokedex.GetInstance()
+	if upload.Purposes[u.Purpose].Private {
+		return instance.Private
+	}
+	return instance.Storage
+}
+
+// ownedUpload returns upload of upload_id param if it was created by the current user
+func ownedUpload(r *http.Request, params httprouter.Params) (upload.Upload, error) {
+	u, err := upload.Find(r.Context(), pokedex.GetInstance().DB, params.ByName("upload_id"))
+	if err != nil {
+		return u, err
+	}
+
+	user := currentuser.FromContext(r.Context())
+	if user == nil || user.ID != u.CreatedBy {
+		return u, upload.ErrUploadNotFound
+	}
+	return u, nil
+}
+
+func writeUploadHeaders(w http.ResponseWriter, u upload.Upload) {
+	w.Header().Set("Tus-Resumable", tusVersion)
+	w.Header().Set("Upload-Offset", strconv.FormatInt(u.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(u.Length, 10))
+	if u.CompletedAt == nil {
+		w.Header().Set("Upload-Expires", u.ExpiresAt.Format(http.TimeFormat))
+	}
+}
+
+// writeTusError writes err with the status code tus clients expect
+func writeTusError(w http.ResponseWriter, err error) error {
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	switch err {
+	case upload.ErrUploadNotFound:
+		err = response.UploadNotExistsError
+	case upload.ErrOffsetMismatch, upload.ErrUploadCompleted:
+		err = response.UploadOffsetConflictError
+	case storage.ErrFileTooLarge:
+		err = response.FileTooLargeError
+	case upload.ErrInvalidLength:
+		err = invalidParameter("Upload-Length")
+	}
+
+	return writeError(w, err, "")
+}
+
+func invalidParameter(field string) response.CustomError {
+	ce := response.InvalidParameterError
+	ce.Field = field
+	return ce
+}
@@ -0,0 +1,86 @@
+package pokedex_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+)
+
+// chunkSize is Tus-Max-Chunk-Size of the server
+const chunkSize = 32 << 20
+
+func TestUploadOptionsWithoutToken(t *testing.T) {
+	db := pokedextest.DB(t)
+	srv := pokedextest.Server(t, db)
+
+	req, err := http.NewRequest("OPTIONS", srv.URL+"/uploads", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusNoContent {
+		t.Fatalf("status %d, want %d", res.StatusCode, http.StatusNoContent)
+	}
+	if got := res.Header.Get("Tus-Max-Chunk-Size"); got != strconv.Itoa(chunkSize) {
+		t.Errorf("Tus-Max-Chunk-Size %q, want %d", got, chunkSize)
+	}
+	if res.Header.Get("Tus-Max-Size") == "" {
+		t.Error("Tus-Max-Size is not advertised")
+	}
+}
+
+func TestAppendUploadOverChunkSize(t *testing.T) {
+	db := pokedextest.DB(t)
+	srv := pokedextest.Server(t, db)
+	admin := pokedextest.User{ID: 7, Role: "ADM", Username: "admin", BranchID: 1}
+
+	content := bytes.Repeat([]byte("registry"), (chunkSize+16)/8)
+	length := strconv.Itoa(len(content))
+
+	req := pokedextest.Request(t, "POST", srv.URL+"/uploads", nil, admin)
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Length", length)
+	req.Header.Set("Upload-Metadata", "purpose "+base64.StdEncoding.EncodeToString([]byte("registry"))+",filename "+base64.StdEncoding.EncodeToString([]byte("book.tif")))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Fatalf("create status %d, want %d", res.StatusCode, http.StatusCreated)
+	}
+	location := srv.URL + res.Header.Get("Location")
+
+	patch := func(offset int) *http.Response {
+		req := pokedextest.Request(t, "PATCH", location, bytes.NewReader(content[offset:]), admin)
+		req.Header.Set("Tus-Resumable", "1.0.0")
+		req.Header.Set("Content-Type", "application/offset+octet-stream")
+		req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		return res
+	}
+
+	// the whole file in one PATCH is stored up to the chunk size
+	res = patch(0)
+	if res.StatusCode != http.StatusNoContent || res.Header.Get("Upload-Offset") != strconv.Itoa(chunkSize) {
+		t.Fatalf("first PATCH status %d offset %s, want %d at %d", res.StatusCode, res.Header.Get("Upload-Offset"), http.StatusNoContent, chunkSize)
+	}
+
+	res = patch(chunkSize)
+	if res.StatusCode != http.StatusNoContent || res.Header.Get("Upload-Offset") != length {
+		t.Fatalf("resumed PATCH status %d offset %s, want %d at %s", res.StatusCode, res.Header.Get("Upload-Offset"), http.StatusNoContent, length)
+	}
+}
@@ -0,0 +1,66 @@
+package pokedex
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/constants"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/profile"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+func writeSuccess(w http.ResponseWriter, data interface{}, status int) error {
+	response.Write(w, response.BuildSuccess(data, response.MetaInfo{HTTPStatus: status}), status)
+	return nil
+}
+
+func writeError(w http.ResponseWriter, err error, fieldName string) error {
+	body, status := response.BuildErrorAndStatus(err, fieldName)
+	response.Write(w, body, status)
+	return err
+}
+
+// writeConflict writes VersionConflictError with current record in Data
+func writeConflict(w http.ResponseWriter, current interface{}) error {
+	ce := response.VersionConflictError
+	ce.Field = "version"
+	ce.Data = current
+	return writeError(w, ce, "")
+}
+
+func uintParam(params httprouter.Params, name string) (uint, error) {
+	v, err := strconv.Atoi(params.ByName(name))
+	if err != nil {
+		return 0, err
+	}
+	if v <= 0 {
+		ce := response.InvalidParameterError
+		ce.Field = name
+		return 0, ce
+	}
+	return uint(v), nil
+}
+
+func isAdmin(user *currentuser.CurrentUser) bool {
+	return user != nil && (user.Role == constants.ROLE_ADM || user.Role == constants.ROLE_SUPER_ADM)
+}
+
+// canManage reports whether user may act on behalf of given profile's owner
+func canManage(user *currentuser.CurrentUser, p profile.Profile) bool {
+	if isAdmin(user) {
+		return true
+	}
+	return user != nil && user.ID != 0 && user.ID == p.UserID
+}
+
+func isInSliceString(v string, slice []string) bool {
+	for _, s := range slice {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
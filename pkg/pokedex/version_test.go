@@ -0,0 +1,83 @@
+package pokedex_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/api/response"
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+)
+
+// versioned is the part of a profile or household a conflict test reads
+type versioned struct {
+	Name    string `json:"name"`
+	Version uint   `json:"version"`
+}
+
+func TestUpdateChecksVersion(t *testing.T) {
+	db := pokedextest.DB(t)
+	pokedextest.LoadFixtures(t, db, "testdata/versions.yml")
+	srv := pokedextest.Server(t, db)
+
+	admin := pokedextest.User{ID: 7, Role: "ADM", Username: "admin", BranchID: 1}
+
+	cases := []struct {
+		name    string
+		url     string
+		stored  versioned
+		payload string
+		status  int
+		code    int
+		want    versioned
+	}{
+		{"stale profile", "/profiles/9404", versioned{"Lukas Santoso", 4}, `{"version": 3, "name": "Lukas"}`,
+			http.StatusConflict, response.VersionConflictError.Code, versioned{"Lukas Santoso", 4}},
+		{"profile without version", "/profiles/9404", versioned{"Lukas Santoso", 4}, `{"name": "Lukas"}`,
+			response.InvalidParameterError.HTTPCode, response.InvalidParameterError.Code, versioned{}},
+		{"current profile", "/profiles/9404", versioned{"Lukas Santoso", 4}, `{"version": 4, "name": "Lukas"}`,
+			http.StatusOK, 0, versioned{"Lukas", 5}},
+		{"stale household", "/households/9405", versioned{"Keluarga Santoso", 3}, `{"version": 1, "name": "Santoso"}`,
+			http.StatusConflict, response.VersionConflictError.Code, versioned{"Keluarga Santoso", 3}},
+		{"household without version", "/households/9405", versioned{"Keluarga Santoso", 3}, `{"name": "Santoso"}`,
+			response.InvalidParameterError.HTTPCode, response.InvalidParameterError.Code, versioned{}},
+		{"current household", "/households/9405", versioned{"Keluarga Santoso", 3}, `{"version": 3, "name": "Santoso"}`,
+			http.StatusOK, 0, versioned{"Santoso", 4}},
+	}
+	for _, c := range cases {
+		// every case starts from the stored record
+		table := "profiles"
+		if strings.HasPrefix(c.url, "/households") {
+			table = "households"
+		}
+		if _, err := db.Exec("UPDATE "+table+" SET name = ?, version = ? WHERE id = ?", c.stored.Name, c.stored.Version, c.url[strings.LastIndex(c.url, "/")+1:]); err != nil {
+			t.Fatal(err)
+		}
+
+		res, err := http.DefaultClient.Do(pokedextest.Request(t, "PATCH", srv.URL+c.url, strings.NewReader(c.payload), admin))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body struct {
+			Errors []response.ErrorInfo `json:"errors"`
+			Data   versioned            `json:"data"`
+		}
+		err = json.NewDecoder(res.Body).Decode(&body)
+		res.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+
+		if res.StatusCode != c.status {
+			t.Errorf("%s: status %d, want %d", c.name, res.StatusCode, c.status)
+			continue
+		}
+		if c.code != 0 && (len(body.Errors) != 1 || body.Errors[0].Code != c.code || body.Errors[0].Field != "version") {
+			t.Errorf("%s: errors %+v, want code %d on version", c.name, body.Errors, c.code)
+		}
+		if body.Data != c.want {
+			t.Errorf("%s: data %+v, want %+v", c.name, body.Data, c.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package pokedextest_test
+
+import (
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+)
+
+func TestRequestIsAuthorized(t *testing.T) {
+	t.Setenv("AUTH_TOKEN_SECRET", pokedextest.TokenSecret)
+
+	r := pokedextest.Request(t, "GET", "/profiles", nil, pokedextest.User{ID: 7, Role: "ADM", Username: "maria", BranchID: 2})
+	user, err := currentuser.FromRequest(r)
+	if err != nil {
+		t.Fatalf("FromRequest: %v", err)
+	}
+	if user.BranchID != 2 {
+		t.Errorf("branch %d, want 2", user.BranchID)
+	}
+
+	t.Setenv("AUTH_TOKEN_SECRET", "another-secret")
+	if _, err := currentuser.FromRequest(r); err == nil {
+		t.Error("token verified with another secret")
+	}
+}
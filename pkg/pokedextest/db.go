@@ -0,0 +1,199 @@
+// Package pokedextest runs integration tests against the MySQL database
+// configured by DATABASE_TEST_* variables. Start one with
+//
+//	docker-compose -f docker-compose.test.yml up -d
+//
+// Tests using DB are skipped when DATABASE_TEST_NAME is empty. Every DB is
+// a transaction rolled back when its test ends, so tests never see each
+// other's rows, but they must not run in parallel once they call Server.
+package pokedextest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/mysql"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	migrateOnce sync.Once
+	migrateErr  error
+)
+
+// Config returns connection settings of the test database
+func Config() (mysql.Config, error) {
+	cfg, err := mysql.ConfigFromEnv()
+	if err != nil {
+		return cfg, err
+	}
+
+	cfg.Name = os.Getenv("DATABASE_TEST_NAME")
+	cfg.Host = os.Getenv("DATABASE_TEST_HOST")
+	cfg.Username = os.Getenv("DATABASE_TEST_USERNAME")
+	cfg.Password = os.Getenv("DATABASE_TEST_PASSWORD")
+	if port := os.Getenv("DATABASE_TEST_PORT"); port != "" {
+		cfg.Port = port
+	}
+	return cfg, nil
+}
+
+// MigrationsDir returns MIGRATIONS_DIR, defaulting to db/migrations of this repository
+func MigrationsDir() string {
+	if dir := os.Getenv("MIGRATIONS_DIR"); dir != "" {
+		return dir
+	}
+
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "..", "..", "db", "migrations")
+}
+
+// DB returns a connection to the migrated test database inside a
+// transaction rolled back when t ends. Transactions begun on it become
+// savepoints, so code using mysql.WithTx works unchanged.
+func DB(t testing.TB) *sqlx.DB {
+	t.Helper()
+
+	if os.Getenv("DATABASE_TEST_NAME") == "" {
+		t.Skip("pokedextest: DATABASE_TEST_NAME is not set")
+	}
+
+	cfg, err := Config()
+	if err != nil {
+		t.Fatalf("pokedextest: %v", err)
+	}
+
+	migrateOnce.Do(func() { migrateErr = migrate(cfg) })
+	if migrateErr != nil {
+		t.Fatalf("pokedextest: %v", migrateErr)
+	}
+
+	raw, err := mysqldriver.MySQLDriver{}.Open(cfg.DSN())
+	if err != nil {
+		t.Fatalf("pokedextest: %v", err)
+	}
+
+	conn := &txConn{Conn: raw}
+	if err := conn.exec(context.Background(), "START TRANSACTION"); err != nil {
+		raw.Close()
+		t.Fatalf("pokedextest: %v", err)
+	}
+
+	db := sql.OpenDB(txConnector{conn: conn})
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+		conn.rollback()
+	})
+
+	return sqlx.NewDb(db, "mysql")
+}
+
+func migrate(cfg mysql.Config) error {
+	db, err := mysql.Open(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	_, err = mysql.Migrate(context.Background(), db, MigrationsDir())
+	return err
+}
+
+// txConnector always hands out the same connection so every query of a
+// test runs in its transaction
+type txConnector struct {
+	conn *txConn
+}
+
+func (c txConnector) Connect(context.Context) (driver.Conn, error) {
+	return c.conn, nil
+}
+
+func (c txConnector) Driver() driver.Driver {
+	return mysqldriver.MySQLDriver{}
+}
+
+// txConn is a connection inside a transaction, turning nested
+// transactions into savepoints and ignoring Close until rollback
+type txConn struct {
+	driver.Conn
+	savepoints int
+}
+
+func (c *txConn) exec(ctx context.Context, query string) error {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return fmt.Errorf("pokedextest: driver connection cannot exec")
+	}
+	_, err := execer.ExecContext(ctx, query, nil)
+	return err
+}
+
+func (c *txConn) rollback() error {
+	defer c.Conn.Close()
+	return c.exec(context.Background(), "ROLLBACK")
+}
+
+func (c *txConn) Close() error {
+	return nil
+}
+
+func (c *txConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *txConn) BeginTx(ctx context.Context, _ driver.TxOptions) (driver.Tx, error) {
+	c.savepoints++
+	sp := savepoint{conn: c, name: fmt.Sprintf("pokedextest_%d", c.savepoints)}
+	if err := c.exec(ctx, "SAVEPOINT "+sp.name); err != nil {
+		return nil, err
+	}
+	return sp, nil
+}
+
+func (c *txConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return execer.ExecContext(ctx, query, args)
+}
+
+func (c *txConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+	return queryer.QueryContext(ctx, query, args)
+}
+
+func (c *txConn) CheckNamedValue(nv *driver.NamedValue) error {
+	checker, ok := c.Conn.(driver.NamedValueChecker)
+	if !ok {
+		return driver.ErrSkip
+	}
+	return checker.CheckNamedValue(nv)
+}
+
+type savepoint struct {
+	conn *txConn
+	name string
+}
+
+func (sp savepoint) Commit() error {
+	return sp.conn.exec(context.Background(), "RELEASE SAVEPOINT "+sp.name)
+}
+
+func (sp savepoint) Rollback() error {
+	return sp.conn.exec(context.Background(), "ROLLBACK TO SAVEPOINT "+sp.name)
+}
@@ -0,0 +1,30 @@
+package pokedextest
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/mysql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// LoadFixtures inserts rows of given YAML fixture files into db, see
+// mysql.LoadFixtures for the file format
+func LoadFixtures(t testing.TB, db *sqlx.DB, paths ...string) {
+	t.Helper()
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			t.Fatalf("pokedextest: %v", err)
+		}
+
+		err = mysql.LoadFixtures(context.Background(), db, f)
+		f.Close()
+		if err != nil {
+			t.Fatalf("pokedextest: fixture %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package pokedextest
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/api"
+	"github.com/gkkkb/pokedex/pkg/log"
+	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/repository"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/route"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/julienschmidt/httprouter"
+)
+
+// Instance returns a pokedex instance querying db, keeping files in memory
+func Instance(t testing.TB, db *sqlx.DB) *pokedex.Pokedex {
+	t.Helper()
+
+	backend, err := storage.InitDriver(storage.DriverMemory)
+	if err != nil {
+		t.Fatalf("pokedextest: %v", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("pokedextest: %v", err)
+	}
+	private := storage.NewPrivateStorage(backend)
+	documents, err := storage.NewEncryptedStorage(private, base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatalf("pokedextest: %v", err)
+	}
+
+	replicas := mysql.NewReplicas(db, time.Second)
+	return &pokedex.Pokedex{
+		DB:        db,
+		Storage:   storage.NewImageStorage(backend),
+		Private:   private,
+		Documents: documents,
+		Replicas:  replicas,
+		Repo:      repository.New(db, replicas),
+		Logger:    log.Default(),
+	}
+}
+
+// Server serves every API route with handlers using Instance(t, db),
+// accepting tokens of Token. It is closed when t ends.
+func Server(t testing.TB, db *sqlx.DB) *httptest.Server {
+	t.Helper()
+
+	t.Setenv("AUTH_TOKEN_SECRET", TokenSecret)
+	pokedex.SetInstance(Instance(t, db))
+
+	router := httprouter.New()
+	api.StartAPIs(router, route.Route())
+
+	srv := httptest.NewServer(router)
+	t.Cleanup(srv.Close)
+	return srv
+}
@@ -0,0 +1,20 @@
+package profile
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrHouseholdNotFound is returned when a household does not exist
+var ErrHouseholdNotFound = errors.New("Household not found")
+
+// Household groups members living together
+type Household struct {
+	ID        uint      `db:"id" json:"id"`
+	BranchID  uint      `db:"branch_id" json:"branch_id"`
+	Name      string    `db:"name" json:"name"`
+	Address   string    `db:"address" json:"address"`
+	Version   uint      `db:"version" json:"version"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -0,0 +1,61 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrProfileNotFound is returned when a profile does not exist or has been deleted
+var ErrProfileNotFound = errors.New("Profile not found")
+
+// Profile contains a church member's profile
+type Profile struct {
+	ID          uint            `db:"id" json:"id"`
+	BranchID    uint            `db:"branch_id" json:"branch_id"`
+	UserID      uint            `db:"user_id" json:"user_id,omitempty"`
+	HouseholdID *uint           `db:"household_id" json:"household_id,omitempty"`
+	Name        string          `db:"name" json:"name"`
+	Gender      string          `db:"gender" json:"gender,omitempty"`
+	BirthDate   *time.Time      `db:"birth_date" json:"birth_date,omitempty"`
+	Phone       string          `db:"phone" json:"phone,omitempty"`
+	Email       string          `db:"email" json:"email,omitempty"`
+	Address     string          `db:"address" json:"address,omitempty"`
+	Photo       string          `db:"photo" json:"photo,omitempty"`
+	Visibility  FieldVisibility `db:"visibility" json:"visibility,omitempty"`
+	Version     uint            `db:"version" json:"version"`
+	CreatedAt   time.Time       `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time       `db:"updated_at" json:"updated_at"`
+
+	// GroupIDs holds groups the profile is a member of, loaded separately
+	GroupIDs []uint `db:"-" json:"-"`
+}
+
+// History contains a single profile field change
+type History struct {
+	ID        uint      `db:"id" json:"id"`
+	ProfileID uint      `db:"profile_id" json:"profile_id"`
+	Field     string    `db:"field" json:"field"`
+	OldValue  *string   `db:"old_value" json:"old_value"`
+	NewValue  *string   `db:"new_value" json:"new_value"`
+	ChangedBy uint      `db:"changed_by" json:"changed_by"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+}
+
+// Attendance contains a single attendance of a profile
+type Attendance struct {
+	ID         uint      `db:"id" json:"id"`
+	ProfileID  uint      `db:"profile_id" json:"profile_id"`
+	Event      string    `db:"event" json:"event"`
+	AttendedAt time.Time `db:"attended_at" json:"attended_at"`
+}
+
+// PhotoPrefix returns storage prefix of given profile's files
+func PhotoPrefix(profileID uint) string {
+	return fmt.Sprintf("profiles/%d", profileID)
+}
+
+// PrivateDocumentPrefix returns storage prefix of given profile's private documents
+func PrivateDocumentPrefix(profileID uint) string {
+	return fmt.Sprintf("private/profiles/%d", profileID)
+}
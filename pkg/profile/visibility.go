@@ -0,0 +1,156 @@
+package profile
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+
+	"github.com/gkkkb/pokedex/pkg/constants"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+)
+
+// Visibility represents who may see a profile field
+type Visibility string
+
+const (
+	// VisibilityPrivate fields are only visible to the profile owner
+	VisibilityPrivate Visibility = "private"
+	// VisibilityStaff fields are visible to the owner and church staff
+	VisibilityStaff Visibility = "staff"
+	// VisibilityGroup fields are visible to members sharing a group with the owner
+	VisibilityGroup Visibility = "group"
+	// VisibilityChurch fields are visible to every church member
+	VisibilityChurch Visibility = "church"
+)
+
+// Relation represents how a viewer relates to a profile
+type Relation int
+
+const (
+	// RelationChurch represents any logged in church member
+	RelationChurch Relation = iota
+	// RelationGroup represents a member sharing a group with the profile
+	RelationGroup
+	// RelationStaff represents church staff
+	RelationStaff
+	// RelationOwner represents the profile owner
+	RelationOwner
+)
+
+// ErrInvalidVisibility is returned when a visibility level or field is unknown
+var ErrInvalidVisibility = errors.New("Invalid visibility")
+
+// DefaultVisibility is applied to fields without an explicit visibility
+var DefaultVisibility = map[string]Visibility{
+	"phone":      VisibilityStaff,
+	"email":      VisibilityGroup,
+	"address":    VisibilityStaff,
+	"birth_date": VisibilityGroup,
+	"photo":      VisibilityChurch,
+}
+
+var visibilityRank = map[Visibility]Relation{
+	VisibilityChurch:  RelationChurch,
+	VisibilityGroup:   RelationGroup,
+	VisibilityStaff:   RelationStaff,
+	VisibilityPrivate: RelationOwner,
+}
+
+// FieldVisibility maps profile fields to their visibility
+type FieldVisibility map[string]Visibility
+
+// Validate checks every field and level is known
+func (fv FieldVisibility) Validate() error {
+	for field, v := range fv {
+		if _, ok := DefaultVisibility[field]; !ok {
+			return ErrInvalidVisibility
+		}
+		if _, ok := visibilityRank[v]; !ok {
+			return ErrInvalidVisibility
+		}
+	}
+	return nil
+}
+
+// Of returns visibility of given field
+func (fv FieldVisibility) Of(field string) Visibility {
+	if v, ok := fv[field]; ok {
+		return v
+	}
+	return DefaultVisibility[field]
+}
+
+// Value implements driver.Valuer
+func (fv FieldVisibility) Value() (driver.Value, error) {
+	if fv == nil {
+		return nil, nil
+	}
+	return json.Marshal(fv)
+}
+
+// Scan implements sql.Scanner
+func (fv *FieldVisibility) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*fv = nil
+		return nil
+	case []byte:
+		b = v
+	case string:
+		b = []byte(v)
+	default:
+		return errors.New("Unsupported visibility type")
+	}
+	return json.Unmarshal(b, fv)
+}
+
+// RelationOf returns the relation between user and p.
+// viewerGroupIDs are groups the user's own profile belongs to.
+func RelationOf(user *currentuser.CurrentUser, p Profile, viewerGroupIDs []uint) Relation {
+	if user == nil {
+		return RelationChurch
+	}
+	if user.ID != 0 && user.ID == p.UserID {
+		return RelationOwner
+	}
+	if user.Role == constants.ROLE_ADM || user.Role == constants.ROLE_SUPER_ADM {
+		return RelationStaff
+	}
+	for _, g := range p.GroupIDs {
+		for _, vg := range viewerGroupIDs {
+			if g == vg {
+				return RelationGroup
+			}
+		}
+	}
+	return RelationChurch
+}
+
+// CanSee reports whether a viewer with given relation may see field of p
+func (p Profile) CanSee(rel Relation, field string) bool {
+	return rel >= visibilityRank[p.Visibility.Of(field)]
+}
+
+// VisibleTo returns a copy of p with fields hidden from given relation cleared
+func (p Profile) VisibleTo(rel Relation) Profile {
+	if !p.CanSee(rel, "phone") {
+		p.Phone = ""
+	}
+	if !p.CanSee(rel, "email") {
+		p.Email = ""
+	}
+	if !p.CanSee(rel, "address") {
+		p.Address = ""
+	}
+	if !p.CanSee(rel, "birth_date") {
+		p.BirthDate = nil
+	}
+	if !p.CanSee(rel, "photo") {
+		p.Photo = ""
+	}
+	if rel != RelationOwner {
+		p.Visibility = nil
+	}
+	return p
+}
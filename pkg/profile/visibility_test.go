@@ -0,0 +1,111 @@
+package profile
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/constants"
+	"github.com/gkkkb/pokedex/pkg/currentuser"
+)
+
+func testProfile() Profile {
+	birth := time.Date(1990, 5, 17, 0, 0, 0, 0, time.UTC)
+	return Profile{
+		ID:        1,
+		UserID:    10,
+		Name:      "Maria",
+		BirthDate: &birth,
+		Phone:     "0812",
+		Email:     "maria@example.com",
+		Address:   "Jl. Merdeka 1",
+		Photo:     "maria.jpg",
+		Visibility: FieldVisibility{
+			"phone":   VisibilityPrivate,
+			"email":   VisibilityGroup,
+			"address": VisibilityStaff,
+			"photo":   VisibilityChurch,
+		},
+		GroupIDs: []uint{3, 4},
+	}
+}
+
+func TestRelationOf(t *testing.T) {
+	p := testProfile()
+
+	tests := []struct {
+		name     string
+		user     *currentuser.CurrentUser
+		groupIDs []uint
+		want     Relation
+	}{
+		{"no user", nil, nil, RelationChurch},
+		{"anonymous", &currentuser.CurrentUser{}, nil, RelationChurch},
+		{"owner", &currentuser.CurrentUser{ID: 10}, nil, RelationOwner},
+		{"admin", &currentuser.CurrentUser{ID: 20, Role: constants.ROLE_ADM}, nil, RelationStaff},
+		{"super admin", &currentuser.CurrentUser{ID: 21, Role: constants.ROLE_SUPER_ADM}, nil, RelationStaff},
+		{"group member", &currentuser.CurrentUser{ID: 30}, []uint{1, 4}, RelationGroup},
+		{"other group member", &currentuser.CurrentUser{ID: 31}, []uint{1, 2}, RelationChurch},
+		{"church member", &currentuser.CurrentUser{ID: 32}, nil, RelationChurch},
+	}
+	for _, tt := range tests {
+		if got := RelationOf(tt.user, p, tt.groupIDs); got != tt.want {
+			t.Errorf("%s: RelationOf() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVisibleTo(t *testing.T) {
+	p := testProfile()
+
+	tests := []struct {
+		rel                          Relation
+		phone, email, address, birth bool
+		photo, visibility            bool
+	}{
+		{RelationChurch, false, false, false, false, true, false},
+		{RelationGroup, false, true, false, true, true, false},
+		{RelationStaff, false, true, true, true, true, false},
+		{RelationOwner, true, true, true, true, true, true},
+	}
+	for _, tt := range tests {
+		got := p.VisibleTo(tt.rel)
+		if (got.Phone != "") != tt.phone {
+			t.Errorf("relation %v: phone visible = %v, want %v", tt.rel, got.Phone != "", tt.phone)
+		}
+		if (got.Email != "") != tt.email {
+			t.Errorf("relation %v: email visible = %v, want %v", tt.rel, got.Email != "", tt.email)
+		}
+		if (got.Address != "") != tt.address {
+			t.Errorf("relation %v: address visible = %v, want %v", tt.rel, got.Address != "", tt.address)
+		}
+		if (got.BirthDate != nil) != tt.birth {
+			t.Errorf("relation %v: birth_date visible = %v, want %v", tt.rel, got.BirthDate != nil, tt.birth)
+		}
+		if (got.Photo != "") != tt.photo {
+			t.Errorf("relation %v: photo visible = %v, want %v", tt.rel, got.Photo != "", tt.photo)
+		}
+		if (got.Visibility != nil) != tt.visibility {
+			t.Errorf("relation %v: visibility visible = %v, want %v", tt.rel, got.Visibility != nil, tt.visibility)
+		}
+		if got.Name != p.Name {
+			t.Errorf("relation %v: name = %q, want %q", tt.rel, got.Name, p.Name)
+		}
+	}
+
+	if p.Phone == "" {
+		t.Error("VisibleTo modified the original profile")
+	}
+}
+
+func TestVisibleToDefaults(t *testing.T) {
+	p := testProfile()
+	p.Visibility = nil
+
+	got := p.VisibleTo(RelationGroup)
+	if got.Phone != "" || got.Address != "" {
+		t.Errorf("staff fields visible to group by default: phone %q, address %q", got.Phone, got.Address)
+	}
+	if got.Email == "" || got.BirthDate == nil || got.Photo == "" {
+		t.Error("group and church fields hidden from group by default")
+	}
+}
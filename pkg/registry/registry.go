@@ -0,0 +1,27 @@
+// Package registry keeps scans of the church registry books, uploaded by
+// admins through resumable uploads and kept in private storage
+package registry
+
+import (
+	"errors"
+	"time"
+)
+
+// Prefix is the storage prefix of registry files
+const Prefix = "registry"
+
+// ErrFileNotFound is returned when a registry file does not exist
+var ErrFileNotFound = errors.New("Registry file not found")
+
+// File is an uploaded registry scan, of a member when ProfileID is set
+type File struct {
+	ID           uint      `db:"id" json:"id"`
+	BranchID     uint      `db:"branch_id" json:"branch_id"`
+	ProfileID    uint      `db:"profile_id" json:"profile_id,omitempty"`
+	UploadID     string    `db:"upload_id" json:"upload_id"`
+	Filename     string    `db:"filename" json:"-"`
+	OriginalName string    `db:"original_name" json:"original_name"`
+	Size         int64     `db:"size" json:"size"`
+	CreatedBy    uint      `db:"created_by" json:"created_by"`
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+}
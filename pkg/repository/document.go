@@ -0,0 +1,239 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"mime"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/api/request"
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// DocumentRepository queries profile documents and their versions.
+// Create and AddVersion also put the uploaded file into store.
+type DocumentRepository interface {
+	Create(ctx context.Context, store storage.StorageInterface, profileID uint, docType string, title string, upload document.Upload) (document.Document, error)
+	AddVersion(ctx context.Context, store storage.StorageInterface, profileID uint, documentID uint, upload document.Upload) (document.Version, error)
+	Find(ctx context.Context, profileID uint, documentID uint) (document.Document, error)
+	All(ctx context.Context, profileID uint) ([]document.Document, error)
+	Versions(ctx context.Context, documentID uint) ([]document.Version, error)
+	FindVersion(ctx context.Context, documentID uint, version uint) (document.Version, error)
+}
+
+type documentRepository struct {
+	db   *sqlx.DB
+	read Queryer
+}
+
+// NewDocumentRepository returns DocumentRepository writing to db and reading from read
+func NewDocumentRepository(db *sqlx.DB, read Queryer) DocumentRepository {
+	return documentRepository{db: db, read: read}
+}
+
+const (
+	documentColumns = "id, branch_id, profile_id, type, title, created_by, created_at, updated_at"
+	versionColumns  = "id, document_id, version, filename, original_name, content_type, size, uploaded_by, created_at"
+)
+
+// Create stores a new document of given profile with upload as its first
+// version. The document id is only known inside the transaction, so upload
+// is staged before it and moved under the document once committed.
+func (r documentRepository) Create(ctx context.Context, store storage.StorageInterface, profileID uint, docType string, title string, upload document.Upload) (document.Document, error) {
+	if !document.IsValidType(docType) {
+		return document.Document{}, document.ErrInvalidType
+	}
+
+	staging := document.StagingPrefix(profileID)
+	filename, err := putUpload(store, staging, upload)
+	if err != nil {
+		return document.Document{}, err
+	}
+	defer store.Delete(staging, filename)
+
+	var id int64
+	err = mysql.WithTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		// documents belong to the branch of their profile
+		p, err := NewProfileRepository(tx).Find(ctx, profileID)
+		if err != nil {
+			return err
+		}
+
+		res, err := tx.ExecContext(ctx, "INSERT INTO documents (branch_id, profile_id, type, title, created_by) VALUES (?, ?, ?, ?, ?)",
+			p.BranchID, profileID, docType, title, upload.UploadedBy)
+		if err != nil {
+			return err
+		}
+
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+
+		_, err = addVersion(ctx, tx, uint(id), filename, upload)
+		return err
+	})
+	if err != nil {
+		return document.Document{}, err
+	}
+
+	if err := store.Copy(staging, filename, document.Prefix(profileID, uint(id)), filename); err != nil {
+		// without its file the document is useless, drop it
+		mysql.WithTx(ctx, r.db, func(tx *sqlx.Tx) error {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM document_versions WHERE document_id = ?", id); err != nil {
+				return err
+			}
+			_, err := tx.ExecContext(ctx, "DELETE FROM documents WHERE id = ?", id)
+			return err
+		})
+		return document.Document{}, err
+	}
+
+	return r.Find(ctx, profileID, uint(id))
+}
+
+// AddVersion stores upload as the next version of given document. upload is
+// put before the transaction, which may be retried on deadlock.
+func (r documentRepository) AddVersion(ctx context.Context, store storage.StorageInterface, profileID uint, documentID uint, upload document.Upload) (document.Version, error) {
+	prefix := document.Prefix(profileID, documentID)
+	filename, err := putUpload(store, prefix, upload)
+	if err != nil {
+		return document.Version{}, err
+	}
+
+	var v document.Version
+	err = mysql.WithTx(ctx, r.db, func(tx *sqlx.Tx) error {
+		var id uint
+		branch, args := tenant.Filter(ctx, "branch_id")
+		err := tx.GetContext(ctx, &id, "SELECT id FROM documents WHERE id = ? AND profile_id = ? AND deleted_at IS NULL AND "+branch+" FOR UPDATE", append([]interface{}{documentID, profileID}, args...)...)
+		if err == sql.ErrNoRows {
+			return document.ErrDocumentNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		if v, err = addVersion(ctx, tx, documentID, filename, upload); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, "UPDATE documents SET updated_at = NOW() WHERE id = ?", documentID)
+		return err
+	})
+	if err != nil {
+		store.Delete(prefix, filename)
+	}
+	return v, err
+}
+
+// putUpload puts upload into store under a unique filename, which it returns
+func putUpload(store storage.StorageInterface, prefix string, upload document.Upload) (string, error) {
+	filename := request.CreateRequestID() + strings.ToLower(filepath.Ext(upload.OriginalName))
+	if err := store.Put(prefix, filename, upload.File); err != nil {
+		store.Delete(prefix, filename)
+		return "", err
+	}
+	return filename, nil
+}
+
+// addVersion records filename, already put into storage, as the next
+// version, the document row must already be locked by tx
+func addVersion(ctx context.Context, tx *sqlx.Tx, documentID uint, filename string, upload document.Upload) (document.Version, error) {
+	var next uint
+	if err := tx.GetContext(ctx, &next, "SELECT COALESCE(MAX(version), 0) + 1 FROM document_versions WHERE document_id = ?", documentID); err != nil {
+		return document.Version{}, err
+	}
+
+	v := document.Version{
+		DocumentID:   documentID,
+		Version:      next,
+		Filename:     filename,
+		OriginalName: upload.OriginalName,
+		ContentType:  mime.TypeByExtension(strings.ToLower(filepath.Ext(upload.OriginalName))),
+		Size:         upload.Size,
+		UploadedBy:   upload.UploadedBy,
+		CreatedAt:    time.Now(),
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO document_versions (document_id, version, filename, original_name, content_type, size, uploaded_by) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		v.DocumentID, v.Version, v.Filename, v.OriginalName, v.ContentType, v.Size, v.UploadedBy)
+	if err != nil {
+		return document.Version{}, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return document.Version{}, err
+	}
+	v.ID = uint(id)
+	return v, nil
+}
+
+// Find returns document of given profile along with its latest version
+func (r documentRepository) Find(ctx context.Context, profileID uint, documentID uint) (document.Document, error) {
+	var d document.Document
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := r.read.GetContext(ctx, &d, "SELECT "+documentColumns+" FROM documents WHERE id = ? AND profile_id = ? AND deleted_at IS NULL AND "+branch, append([]interface{}{documentID, profileID}, args...)...)
+	if err == sql.ErrNoRows {
+		return d, document.ErrDocumentNotFound
+	}
+	if err != nil {
+		return d, err
+	}
+
+	latest, err := r.FindVersion(ctx, documentID, 0)
+	if err != nil {
+		return d, err
+	}
+	d.Latest = &latest
+	return d, nil
+}
+
+// All returns documents of given profile along with their latest versions
+func (r documentRepository) All(ctx context.Context, profileID uint) ([]document.Document, error) {
+	docs := []document.Document{}
+	branch, args := tenant.Filter(ctx, "branch_id")
+	if err := r.read.SelectContext(ctx, &docs, "SELECT "+documentColumns+" FROM documents WHERE profile_id = ? AND deleted_at IS NULL AND "+branch+" ORDER BY id", append([]interface{}{profileID}, args...)...); err != nil {
+		return nil, err
+	}
+
+	for i := range docs {
+		latest, err := r.FindVersion(ctx, docs[i].ID, 0)
+		if err != nil {
+			return nil, err
+		}
+		docs[i].Latest = &latest
+	}
+	return docs, nil
+}
+
+// Versions returns every version of given document, newest first
+func (r documentRepository) Versions(ctx context.Context, documentID uint) ([]document.Version, error) {
+	versions := []document.Version{}
+	err := r.read.SelectContext(ctx, &versions, "SELECT "+versionColumns+" FROM document_versions WHERE document_id = ? ORDER BY version DESC", documentID)
+	return versions, err
+}
+
+// FindVersion returns given version of a document, or its latest version when version is 0
+func (r documentRepository) FindVersion(ctx context.Context, documentID uint, version uint) (document.Version, error) {
+	var (
+		v   document.Version
+		err error
+	)
+	if version == 0 {
+		err = r.read.GetContext(ctx, &v, "SELECT "+versionColumns+" FROM document_versions WHERE document_id = ? ORDER BY version DESC LIMIT 1", documentID)
+	} else {
+		err = r.read.GetContext(ctx, &v, "SELECT "+versionColumns+" FROM document_versions WHERE document_id = ? AND version = ?", documentID, version)
+	}
+
+	if err == sql.ErrNoRows {
+		return v, document.ErrDocumentNotFound
+	}
+	return v, err
+}
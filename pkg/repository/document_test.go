@@ -0,0 +1,99 @@
+package repository_test
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+	"github.com/gkkkb/pokedex/pkg/repository"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+)
+
+const profileID = 9101
+
+// putCounter counts Puts, a retried transaction must not put the upload again
+type putCounter struct {
+	storage.StorageInterface
+	puts int
+}
+
+func (s *putCounter) Put(filePrefix string, filename string, file io.Reader) error {
+	s.puts++
+	return s.StorageInterface.Put(filePrefix, filename, file)
+}
+
+func TestDocumentVersionsStoredOutsideTransaction(t *testing.T) {
+	db := pokedextest.DB(t)
+	pokedextest.LoadFixtures(t, db, "testdata/profiles.yml")
+	ctx := tenant.NewContext(context.Background(), 1)
+
+	mem, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	store := &putCounter{StorageInterface: mem}
+	repo := repository.NewDocumentRepository(db, db)
+
+	doc, err := repo.Create(ctx, store, profileID, document.TypeCertificate, "Baptism", document.Upload{File: strings.NewReader("first"), OriginalName: "baptism.pdf", Size: 5, UploadedBy: 7})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	v, err := repo.AddVersion(ctx, store, profileID, doc.ID, document.Upload{File: strings.NewReader("second"), OriginalName: "baptism.pdf", Size: 6, UploadedBy: 7})
+	if err != nil {
+		t.Fatalf("AddVersion: %v", err)
+	}
+
+	if store.puts != 2 {
+		t.Errorf("%d puts, want 2", store.puts)
+	}
+	if v.Version != 2 || v.Filename == doc.Latest.Filename {
+		t.Errorf("version %d filename %q, want version 2 with its own filename", v.Version, v.Filename)
+	}
+
+	for want, filename := range map[string]string{"first": doc.Latest.Filename, "second": v.Filename} {
+		f, err := store.Get(document.Prefix(profileID, doc.ID), filename)
+		if err != nil {
+			t.Fatalf("Get %s: %v", filename, err)
+		}
+		if b, _ := ioutil.ReadAll(f); string(b) != want {
+			t.Errorf("%s = %q, want %q", filename, b, want)
+		}
+	}
+
+	staged, _, err := store.List(document.StagingPrefix(profileID), "", 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(staged) != 0 {
+		t.Errorf("%d staged files left, want 0", len(staged))
+	}
+}
+
+func TestAddVersionOfMissingDocumentRemovesUpload(t *testing.T) {
+	db := pokedextest.DB(t)
+	pokedextest.LoadFixtures(t, db, "testdata/profiles.yml")
+	ctx := tenant.NewContext(context.Background(), 1)
+
+	store, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+
+	_, err = repository.NewDocumentRepository(db, db).AddVersion(ctx, store, profileID, 424242, document.Upload{File: strings.NewReader("x"), OriginalName: "x.pdf", Size: 1})
+	if err != document.ErrDocumentNotFound {
+		t.Fatalf("AddVersion error = %v, want %v", err, document.ErrDocumentNotFound)
+	}
+
+	infos, _, err := store.List(document.Prefix(profileID, 424242), "", 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(infos) != 0 {
+		t.Errorf("%d files left, want 0", len(infos))
+	}
+}
@@ -0,0 +1,63 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+)
+
+// HouseholdRepository queries households
+type HouseholdRepository interface {
+	Find(ctx context.Context, id uint) (profile.Household, error)
+	Update(ctx context.Context, h profile.Household) (profile.Household, error)
+}
+
+type householdRepository struct {
+	db Queryer
+}
+
+// NewHouseholdRepository returns HouseholdRepository querying db
+func NewHouseholdRepository(db Queryer) HouseholdRepository {
+	return householdRepository{db: db}
+}
+
+const householdColumns = "id, branch_id, name, address, version, created_at, updated_at"
+
+// Find returns household with given id
+func (r householdRepository) Find(ctx context.Context, id uint) (profile.Household, error) {
+	var h profile.Household
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := r.db.GetContext(ctx, &h, "SELECT "+householdColumns+" FROM households WHERE id = ? AND "+branch, append([]interface{}{id}, args...)...)
+	if err == sql.ErrNoRows {
+		return h, profile.ErrHouseholdNotFound
+	}
+	return h, err
+}
+
+// Update stores name and address of h when h.Version is still the stored
+// version, otherwise a ConflictError holding the stored household is returned
+func (r householdRepository) Update(ctx context.Context, h profile.Household) (profile.Household, error) {
+	branch, args := tenant.Filter(ctx, "branch_id")
+	res, err := r.db.ExecContext(ctx, "UPDATE households SET name = ?, address = ?, version = version + 1 WHERE id = ? AND version = ? AND "+branch,
+		append([]interface{}{h.Name, h.Address, h.ID, h.Version}, args...)...)
+	if err != nil {
+		return h, err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return h, err
+	}
+
+	// version always changes, so no affected row means a stale or missing household
+	current, err := r.Find(ctx, h.ID)
+	if err != nil {
+		return current, err
+	}
+	if n == 0 {
+		return current, &ConflictError{Current: current}
+	}
+	return current, nil
+}
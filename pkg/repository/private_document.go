@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+)
+
+// PrivateDocumentRepository queries private documents of profiles
+type PrivateDocumentRepository interface {
+	Create(ctx context.Context, d document.Private) (document.Private, error)
+	Find(ctx context.Context, profileID uint, filename string) (document.Private, error)
+	All(ctx context.Context, profileID uint) ([]document.Private, error)
+}
+
+type privateDocumentRepository struct {
+	db Queryer
+}
+
+// NewPrivateDocumentRepository returns PrivateDocumentRepository querying db
+func NewPrivateDocumentRepository(db Queryer) PrivateDocumentRepository {
+	return privateDocumentRepository{db: db}
+}
+
+const privateDocumentColumns = "id, branch_id, profile_id, filename, original_name, content_type, size, uploaded_by, created_at"
+
+// Create records d, already stored under profile.PrivateDocumentPrefix
+func (r privateDocumentRepository) Create(ctx context.Context, d document.Private) (document.Private, error) {
+	res, err := r.db.ExecContext(ctx, "INSERT INTO private_documents (branch_id, profile_id, filename, original_name, content_type, size, uploaded_by) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		d.BranchID, d.ProfileID, d.Filename, d.OriginalName, d.ContentType, d.Size, d.UploadedBy)
+	if err != nil {
+		return d, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return d, err
+	}
+	d.ID = uint(id)
+	return d, nil
+}
+
+// Find returns private document of given profile stored under filename
+func (r privateDocumentRepository) Find(ctx context.Context, profileID uint, filename string) (document.Private, error) {
+	var d document.Private
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := r.db.GetContext(ctx, &d, "SELECT "+privateDocumentColumns+" FROM private_documents WHERE profile_id = ? AND filename = ? AND "+branch, append([]interface{}{profileID, filename}, args...)...)
+	if err == sql.ErrNoRows {
+		return d, document.ErrPrivateDocumentNotFound
+	}
+	return d, err
+}
+
+// All returns private documents of given profile, newest first
+func (r privateDocumentRepository) All(ctx context.Context, profileID uint) ([]document.Private, error) {
+	docs := []document.Private{}
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := r.db.SelectContext(ctx, &docs, "SELECT "+privateDocumentColumns+" FROM private_documents WHERE profile_id = ? AND "+branch+" ORDER BY id DESC", append([]interface{}{profileID}, args...)...)
+	return docs, err
+}
@@ -0,0 +1,272 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/search"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// ProfileRepository queries profiles and their related records
+type ProfileRepository interface {
+	Find(ctx context.Context, id uint) (profile.Profile, error)
+	FindMany(ctx context.Context, ids []uint) ([]profile.Profile, error)
+	List(ctx context.Context, limit, offset int) ([]profile.Profile, error)
+	GroupIDs(ctx context.Context, profileID uint) ([]uint, error)
+	ViewerGroupIDs(ctx context.Context, userID uint) ([]uint, error)
+	Histories(ctx context.Context, profileID uint) ([]profile.History, error)
+	Attendances(ctx context.Context, profileID uint) ([]profile.Attendance, error)
+	Update(ctx context.Context, p profile.Profile, changedBy uint) (profile.Profile, error)
+	UpdatePhoto(ctx context.Context, profileID uint, photo string) error
+	Search(ctx context.Context, query string, limit int) ([]search.Result, error)
+	IndexName(ctx context.Context, profileID uint, name string) error
+	ReindexNames(ctx context.Context) (int, error)
+}
+
+type profileRepository struct {
+	db Queryer
+}
+
+const profileColumns = "id, branch_id, user_id, household_id, name, gender, birth_date, phone, email, address, photo, visibility, version, created_at, updated_at"
+
+// NewProfileRepository returns ProfileRepository querying db
+func NewProfileRepository(db Queryer) ProfileRepository {
+	return profileRepository{db: db}
+}
+
+// Find returns profile with given id along with its group ids
+func (r profileRepository) Find(ctx context.Context, id uint) (profile.Profile, error) {
+	var p profile.Profile
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := r.db.GetContext(ctx, &p, "SELECT "+profileColumns+" FROM profiles WHERE id = ? AND deleted_at IS NULL AND "+branch, append([]interface{}{id}, args...)...)
+	if err == sql.ErrNoRows {
+		return p, profile.ErrProfileNotFound
+	}
+	if err != nil {
+		return p, err
+	}
+
+	p.GroupIDs, err = r.GroupIDs(ctx, id)
+	return p, err
+}
+
+// FindMany returns existing profiles among given ids along with their
+// group ids, in the order of ids
+func (r profileRepository) FindMany(ctx context.Context, ids []uint) ([]profile.Profile, error) {
+	if len(ids) == 0 {
+		return []profile.Profile{}, nil
+	}
+
+	branch, branchArgs := tenant.Filter(ctx, "branch_id")
+	q, args, err := sqlx.In("SELECT "+profileColumns+" FROM profiles WHERE id IN (?) AND deleted_at IS NULL AND "+branch, append([]interface{}{ids}, branchArgs...)...)
+	if err != nil {
+		return nil, err
+	}
+	found := []profile.Profile{}
+	if err := r.db.SelectContext(ctx, &found, r.db.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	if err := r.loadGroupIDs(ctx, found); err != nil {
+		return nil, err
+	}
+
+	byID := make(map[uint]profile.Profile, len(found))
+	for _, p := range found {
+		byID[p.ID] = p
+	}
+	profiles := make([]profile.Profile, 0, len(found))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			profiles = append(profiles, p)
+		}
+	}
+	return profiles, nil
+}
+
+// List returns profiles ordered by name along with their group ids
+func (r profileRepository) List(ctx context.Context, limit, offset int) ([]profile.Profile, error) {
+	profiles := []profile.Profile{}
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := r.db.SelectContext(ctx, &profiles, "SELECT "+profileColumns+" FROM profiles WHERE deleted_at IS NULL AND "+branch+" ORDER BY name, id LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	if err != nil {
+		return nil, err
+	}
+	return profiles, r.loadGroupIDs(ctx, profiles)
+}
+
+// GroupIDs returns groups given profile is a member of
+func (r profileRepository) GroupIDs(ctx context.Context, profileID uint) ([]uint, error) {
+	ids := []uint{}
+	err := r.db.SelectContext(ctx, &ids, "SELECT group_id FROM group_members WHERE profile_id = ?", profileID)
+	return ids, err
+}
+
+// ViewerGroupIDs returns groups the profile of given user is a member of,
+// the groups compared by profile.RelationOf
+func (r profileRepository) ViewerGroupIDs(ctx context.Context, userID uint) ([]uint, error) {
+	ids := []uint{}
+	if userID == 0 {
+		return ids, nil
+	}
+	err := r.db.SelectContext(ctx, &ids, "SELECT gm.group_id FROM group_members gm JOIN profiles p ON p.id = gm.profile_id WHERE p.user_id = ? AND p.deleted_at IS NULL", userID)
+	return ids, err
+}
+
+// loadGroupIDs sets GroupIDs of every profile with a single query
+func (r profileRepository) loadGroupIDs(ctx context.Context, profiles []profile.Profile) error {
+	if len(profiles) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(profiles))
+	index := make(map[uint]int, len(profiles))
+	for i, p := range profiles {
+		ids[i] = p.ID
+		index[p.ID] = i
+		profiles[i].GroupIDs = []uint{}
+	}
+
+	q, args, err := sqlx.In("SELECT profile_id, group_id FROM group_members WHERE profile_id IN (?)", ids)
+	if err != nil {
+		return err
+	}
+	members := []struct {
+		ProfileID uint `db:"profile_id"`
+		GroupID   uint `db:"group_id"`
+	}{}
+	if err := r.db.SelectContext(ctx, &members, r.db.Rebind(q), args...); err != nil {
+		return err
+	}
+	for _, m := range members {
+		i := index[m.ProfileID]
+		profiles[i].GroupIDs = append(profiles[i].GroupIDs, m.GroupID)
+	}
+	return nil
+}
+
+// Histories returns change history of given profile
+func (r profileRepository) Histories(ctx context.Context, profileID uint) ([]profile.History, error) {
+	histories := []profile.History{}
+	err := r.db.SelectContext(ctx, &histories, "SELECT id, profile_id, field, old_value, new_value, changed_by, created_at FROM profile_histories WHERE profile_id = ? ORDER BY id", profileID)
+	return histories, err
+}
+
+// Attendances returns attendances of given profile
+func (r profileRepository) Attendances(ctx context.Context, profileID uint) ([]profile.Attendance, error) {
+	attendances := []profile.Attendance{}
+	err := r.db.SelectContext(ctx, &attendances, "SELECT id, profile_id, event, attended_at FROM attendances WHERE profile_id = ? ORDER BY attended_at", profileID)
+	return attendances, err
+}
+
+// UpdatePhoto sets photo filename of given profile
+func (r profileRepository) UpdatePhoto(ctx context.Context, profileID uint, photo string) error {
+	branch, args := tenant.Filter(ctx, "branch_id")
+	_, err := r.db.ExecContext(ctx, "UPDATE profiles SET photo = ?, version = version + 1 WHERE id = ? AND deleted_at IS NULL AND "+branch, append([]interface{}{photo, profileID}, args...)...)
+	return err
+}
+
+// Update stores editable fields of p when p.Version is still the stored
+// version, recording every changed field in profile histories. Otherwise a
+// ConflictError holding the stored profile is returned.
+func (r profileRepository) Update(ctx context.Context, p profile.Profile, changedBy uint) (profile.Profile, error) {
+	var updated profile.Profile
+	err := inTx(ctx, r.db, func(q Queryer) error {
+		var current profile.Profile
+		branch, args := tenant.Filter(ctx, "branch_id")
+		err := q.GetContext(ctx, &current, "SELECT "+profileColumns+" FROM profiles WHERE id = ? AND deleted_at IS NULL AND "+branch+" FOR UPDATE", append([]interface{}{p.ID}, args...)...)
+		if err == sql.ErrNoRows {
+			return profile.ErrProfileNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if current.Version != p.Version {
+			return &ConflictError{Current: current}
+		}
+
+		for _, c := range profileChanges(current, p) {
+			if _, err := q.ExecContext(ctx, "INSERT INTO profile_histories (profile_id, field, old_value, new_value, changed_by) VALUES (?, ?, ?, ?, ?)",
+				p.ID, c.field, c.old, c.new, changedBy); err != nil {
+				return err
+			}
+		}
+
+		if _, err := q.ExecContext(ctx, "UPDATE profiles SET household_id = ?, name = ?, gender = ?, birth_date = ?, phone = ?, email = ?, address = ?, visibility = ?, version = version + 1 WHERE id = ?",
+			p.HouseholdID, p.Name, p.Gender, p.BirthDate, p.Phone, p.Email, p.Address, p.Visibility, p.ID); err != nil {
+			return err
+		}
+
+		if p.Name != current.Name {
+			if err := NewProfileRepository(q).IndexName(ctx, p.ID, p.Name); err != nil {
+				return err
+			}
+		}
+
+		updated, err = NewProfileRepository(q).Find(ctx, p.ID)
+		return err
+	})
+	return updated, err
+}
+
+type fieldChange struct {
+	field    string
+	old, new *string
+}
+
+// profileChanges lists editable fields differing between old and new
+func profileChanges(old, new profile.Profile) []fieldChange {
+	fields := []struct {
+		name     string
+		old, new *string
+	}{
+		{"household_id", formatUint(old.HouseholdID), formatUint(new.HouseholdID)},
+		{"name", &old.Name, &new.Name},
+		{"gender", &old.Gender, &new.Gender},
+		{"birth_date", formatDate(old.BirthDate), formatDate(new.BirthDate)},
+		{"phone", &old.Phone, &new.Phone},
+		{"email", &old.Email, &new.Email},
+		{"address", &old.Address, &new.Address},
+		{"visibility", formatJSON(old.Visibility), formatJSON(new.Visibility)},
+	}
+
+	changes := []fieldChange{}
+	for _, f := range fields {
+		if f.old == nil && f.new == nil || f.old != nil && f.new != nil && *f.old == *f.new {
+			continue
+		}
+		changes = append(changes, fieldChange{field: f.name, old: f.old, new: f.new})
+	}
+	return changes
+}
+
+func formatUint(v *uint) *string {
+	if v == nil {
+		return nil
+	}
+	s := strconv.FormatUint(uint64(*v), 10)
+	return &s
+}
+
+func formatDate(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format("2006-01-02")
+	return &s
+}
+
+func formatJSON(v profile.FieldVisibility) *string {
+	if v == nil {
+		return nil
+	}
+	b, _ := json.Marshal(v)
+	s := string(b)
+	return &s
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"context"
+	"math"
+	"strings"
+
+	"github.com/gkkkb/pokedex/pkg/search"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	// searchCandidates caps rows fetched from MySQL before ranking
+	searchCandidates = 200
+	// candidateTrigrams is the share of query trigrams a name must contain to be ranked
+	candidateTrigrams = 0.3
+)
+
+// Search returns profiles whose name matches query by FULLTEXT or by
+// trigrams of its phonetic key, best match first
+func (r profileRepository) Search(ctx context.Context, query string, limit int) ([]search.Result, error) {
+	trigrams := search.Trigrams(query)
+	if len(trigrams) == 0 {
+		return []search.Result{}, nil
+	}
+	minHits := int(math.Ceil(float64(len(trigrams)) * candidateTrigrams))
+
+	branch, branchArgs := tenant.Filter(ctx, "p.branch_id")
+	args := []interface{}{query}
+	args = append(args, branchArgs...)
+	args = append(args, query, trigrams, minHits, searchCandidates)
+	q, args, err := sqlx.In(`/* profile.search */ SELECT p.id, p.name, MATCH(p.name) AGAINST (? IN NATURAL LANGUAGE MODE) AS text_score
+		FROM profiles p
+		WHERE p.deleted_at IS NULL AND `+branch+` AND (
+			MATCH(p.name) AGAINST (? IN NATURAL LANGUAGE MODE)
+			OR p.id IN (SELECT profile_id FROM profile_name_trigrams WHERE trigram IN (?) GROUP BY profile_id HAVING COUNT(*) >= ?)
+		)
+		ORDER BY text_score DESC
+		LIMIT ?`, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []search.Candidate{}
+	if err := r.db.SelectContext(ctx, &candidates, r.db.Rebind(q), args...); err != nil {
+		return nil, err
+	}
+	return search.Rank(query, candidates, limit), nil
+}
+
+// IndexName replaces name trigrams of given profile, it must be called
+// whenever a profile name is written
+func (r profileRepository) IndexName(ctx context.Context, profileID uint, name string) error {
+	if _, err := r.db.ExecContext(ctx, "DELETE FROM profile_name_trigrams WHERE profile_id = ?", profileID); err != nil {
+		return err
+	}
+
+	trigrams := search.Trigrams(name)
+	if len(trigrams) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(trigrams))
+	args := make([]interface{}, 0, 2*len(trigrams))
+	for _, t := range trigrams {
+		values = append(values, "(?, ?)")
+		args = append(args, t, profileID)
+	}
+
+	_, err := r.db.ExecContext(ctx, "INSERT INTO profile_name_trigrams (trigram, profile_id) VALUES "+strings.Join(values, ", "), args...)
+	return err
+}
+
+// ReindexNames rebuilds name trigrams of every profile of the branch of ctx,
+// returning how many were indexed
+func (r profileRepository) ReindexNames(ctx context.Context) (int, error) {
+	profiles := []struct {
+		ID   uint   `db:"id"`
+		Name string `db:"name"`
+	}{}
+	branch, args := tenant.Filter(ctx, "branch_id")
+	if err := r.db.SelectContext(ctx, &profiles, "SELECT id, name FROM profiles WHERE deleted_at IS NULL AND "+branch, args...); err != nil {
+		return 0, err
+	}
+
+	for i, p := range profiles {
+		if err := r.IndexName(ctx, p.ID, p.Name); err != nil {
+			return i, err
+		}
+	}
+	return len(profiles), nil
+}
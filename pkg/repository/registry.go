@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/gkkkb/pokedex/pkg/registry"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+)
+
+// RegistryRepository queries registry files
+type RegistryRepository interface {
+	Create(ctx context.Context, f registry.File) (registry.File, error)
+	Find(ctx context.Context, id uint) (registry.File, error)
+	All(ctx context.Context, limit int, offset int) ([]registry.File, error)
+	ForProfile(ctx context.Context, profileID uint) ([]registry.File, error)
+}
+
+type registryRepository struct {
+	db Queryer
+}
+
+// NewRegistryRepository returns RegistryRepository querying db
+func NewRegistryRepository(db Queryer) RegistryRepository {
+	return registryRepository{db: db}
+}
+
+const registryColumns = "id, branch_id, profile_id, upload_id, filename, original_name, size, created_by, created_at"
+
+// Create records f, already stored under registry.Prefix
+func (r registryRepository) Create(ctx context.Context, f registry.File) (registry.File, error) {
+	res, err := r.db.ExecContext(ctx, "INSERT INTO registry_files (branch_id, profile_id, upload_id, filename, original_name, size, created_by) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		f.BranchID, f.ProfileID, f.UploadID, f.Filename, f.OriginalName, f.Size, f.CreatedBy)
+	if err != nil {
+		return f, err
+	}
+
+	id, err := res.LastInsertId()
+	if err != nil {
+		return f, err
+	}
+	f.ID = uint(id)
+	return f, nil
+}
+
+// Find returns registry file with given id
+func (r registryRepository) Find(ctx context.Context, id uint) (registry.File, error) {
+	var f registry.File
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := r.db.GetContext(ctx, &f, "SELECT "+registryColumns+" FROM registry_files WHERE id = ? AND "+branch, append([]interface{}{id}, args...)...)
+	if err == sql.ErrNoRows {
+		return f, registry.ErrFileNotFound
+	}
+	return f, err
+}
+
+// All returns registry files, newest first
+func (r registryRepository) All(ctx context.Context, limit int, offset int) ([]registry.File, error) {
+	files := []registry.File{}
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := r.db.SelectContext(ctx, &files, "SELECT "+registryColumns+" FROM registry_files WHERE "+branch+" ORDER BY id DESC LIMIT ? OFFSET ?", append(args, limit, offset)...)
+	return files, err
+}
+
+// ForProfile returns registry files uploaded for given profile, oldest first
+func (r registryRepository) ForProfile(ctx context.Context, profileID uint) ([]registry.File, error) {
+	files := []registry.File{}
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := r.db.SelectContext(ctx, &files, "SELECT "+registryColumns+" FROM registry_files WHERE profile_id = ? AND "+branch+" ORDER BY id", append([]interface{}{profileID}, args...)...)
+	return files, err
+}
@@ -0,0 +1,70 @@
+// Package repository holds database queries of every entity. Each query
+// takes the request context so cancellation reaches MySQL, and each
+// repository is an interface so handlers can be tested against fakes.
+package repository
+
+import (
+	"context"
+
+	"github.com/gkkkb/pokedex/pkg/mysql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Queryer is implemented by both *sqlx.DB and *sqlx.Tx
+type Queryer interface {
+	sqlx.ExtContext
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+}
+
+// ConflictError is returned when updating a record whose version changed
+// since the client read it, Current holds the stored record
+type ConflictError struct {
+	Current interface{}
+}
+
+func (e *ConflictError) Error() string {
+	return "Record has been modified"
+}
+
+// Repositories groups every repository
+type Repositories struct {
+	Profiles         ProfileRepository
+	Households       HouseholdRepository
+	Documents        DocumentRepository
+	Registry         RegistryRepository
+	PrivateDocuments PrivateDocumentRepository
+
+	// ReadOnly reads from replicas, for reports and exports that tolerate
+	// replication lag. Writes still go to primary.
+	ReadOnly *Repositories
+}
+
+// New returns repositories querying db, with ReadOnly reading from replicas
+func New(db *sqlx.DB, replicas *mysql.Replicas) *Repositories {
+	read := replicas.ReadOnly()
+	return &Repositories{
+		Profiles:         NewProfileRepository(db),
+		Households:       NewHouseholdRepository(db),
+		Documents:        NewDocumentRepository(db, db),
+		Registry:         NewRegistryRepository(db),
+		PrivateDocuments: NewPrivateDocumentRepository(db),
+		ReadOnly: &Repositories{
+			Profiles:         NewProfileRepository(read),
+			Households:       NewHouseholdRepository(read),
+			Documents:        NewDocumentRepository(db, read),
+			Registry:         NewRegistryRepository(read),
+			PrivateDocuments: NewPrivateDocumentRepository(read),
+		},
+	}
+}
+
+// inTx runs fn inside a transaction of db, or directly on db when it
+// already is a transaction or a read-only connection
+func inTx(ctx context.Context, db Queryer, fn func(q Queryer) error) error {
+	if d, ok := db.(*sqlx.DB); ok {
+		return mysql.WithTx(ctx, d, func(tx *sqlx.Tx) error { return fn(tx) })
+	}
+	return fn(db)
+}
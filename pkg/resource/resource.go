@@ -3,6 +3,8 @@ package resource
 import (
 	"context"
 	"time"
+
+	"github.com/gkkkb/pokedex/pkg/api/request"
 )
 
 // Resources contains request resources
@@ -12,11 +14,21 @@ type Resources struct {
 	StartTime time.Time
 }
 
+// Job contains resources of a background job run, in place of Resources
+type Job struct {
+	ID        string
+	Name      string
+	StartTime time.Time
+}
+
 type key int
 
 // Key is resources context key
 const Key key = 0
 
+// JobKey is job context key
+const JobKey key = 1
+
 // NewContext returns context containing given CurrentUser
 func NewContext(ctx context.Context, rID string, action string, startTime time.Time) context.Context {
 	return context.WithValue(ctx, Key, &Resources{
@@ -26,9 +38,32 @@ func NewContext(ctx context.Context, rID string, action string, startTime time.T
 	})
 }
 
-// FromContext returns Resources contained in given context
+// FromContext returns Resources contained in given context, nil outside requests
 func FromContext(ctx context.Context) *Resources {
+	if ctx == nil {
+		return nil
+	}
 	res, _ := ctx.Value(Key).(*Resources)
 
 	return res
 }
+
+// NewJobContext returns context of a new run of given background job,
+// identified by a fresh job id
+func NewJobContext(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, JobKey, &Job{
+		ID:        request.CreateRequestID(),
+		Name:      name,
+		StartTime: time.Now(),
+	})
+}
+
+// JobFromContext returns Job contained in given context, nil outside background jobs
+func JobFromContext(ctx context.Context) *Job {
+	if ctx == nil {
+		return nil
+	}
+	job, _ := ctx.Value(JobKey).(*Job)
+
+	return job
+}
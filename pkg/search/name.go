@@ -0,0 +1,114 @@
+// Package search matches member names despite spelling variants. Names are
+// reduced to a phonetic key following old and new Indonesian spellings
+// (Djoko/Joko, Soekarno/Sukarno) and common western variants
+// (Johannes/Yohanes, Christina/Cristina), then compared by trigrams so
+// typos still match.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+var diacritics = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ä", "a", "ã", "a", "å", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "ö", "o", "õ", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ñ", "n", "ç", "c",
+)
+
+// spellings are applied in a single pass, earlier pairs winning at the same position
+var spellings = strings.NewReplacer(
+	"oe", "u",
+	"dj", "y",
+	"tj", "k",
+	"sj", "sy",
+	"nj", "ny",
+	"ch", "k",
+	"kh", "k",
+	"ph", "f",
+	"th", "t",
+	"gh", "g",
+	"c", "k",
+	"q", "k",
+	"x", "ks",
+	"j", "y",
+	"v", "f",
+)
+
+// Normalize lowercases name, strips diacritics and punctuation and
+// collapses whitespace
+func Normalize(name string) string {
+	name = diacritics.Replace(strings.ToLower(name))
+
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || unicode.IsDigit(r))
+	})
+	return strings.Join(words, " ")
+}
+
+// Phonetic returns the phonetic key of name, equal for spelling variants
+func Phonetic(name string) string {
+	words := strings.Fields(Normalize(name))
+	for i, w := range words {
+		words[i] = phoneticWord(w)
+	}
+	return strings.Join(words, " ")
+}
+
+func phoneticWord(w string) string {
+	w = spellings.Replace(w)
+	if len(w) > 1 {
+		w = strings.TrimSuffix(w, "h")
+	}
+
+	// collapse doubled letters, Johannes and Yohanes spell the same
+	b := make([]byte, 0, len(w))
+	for i := 0; i < len(w); i++ {
+		if i > 0 && w[i] == w[i-1] {
+			continue
+		}
+		b = append(b, w[i])
+	}
+	return string(b)
+}
+
+// Trigrams returns the distinct trigrams of the phonetic key of name,
+// each word padded with two leading and one trailing space
+func Trigrams(name string) []string {
+	seen := map[string]bool{}
+	trigrams := []string{}
+	for _, w := range strings.Fields(Phonetic(name)) {
+		padded := "  " + w + " "
+		for i := 0; i+3 <= len(padded); i++ {
+			t := padded[i : i+3]
+			if !seen[t] {
+				seen[t] = true
+				trigrams = append(trigrams, t)
+			}
+		}
+	}
+	return trigrams
+}
+
+// Similarity returns the share of trigrams a and b have in common, from 0 to 1
+func Similarity(a, b []string) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+
+	set := map[string]bool{}
+	for _, t := range a {
+		set[t] = true
+	}
+
+	common := 0
+	for _, t := range b {
+		if set[t] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(a)+len(b)-common)
+}
@@ -0,0 +1,97 @@
+package search_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/search"
+)
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		name string
+		want string
+	}{
+		{"Yohanes", "yohanes"},
+		{"  Maria   MAGDALENA ", "maria magdalena"},
+		{"José Pérez-Núñez", "jose perez nunez"},
+		{"O'Brien, Jr.", "o brien jr"},
+		{"Yusuf 2", "yusuf 2"},
+		{"", ""},
+	}
+	for _, c := range cases {
+		if got := search.Normalize(c.name); got != c.want {
+			t.Errorf("Normalize(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestPhoneticSpellingVariants(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want string
+	}{
+		{"Yohanes", "Johannes", "yohanes"},
+		{"Cristina", "Christina", "kristina"},
+		{"Djoko", "Joko", "yoko"},
+		{"Soekarno", "Sukarno", "sukarno"},
+		{"Tjahjono", "Cahyono", "kahyono"},
+		{"Maria Josephine", "MARIA JOSEFINE", "maria yosefine"},
+	}
+	for _, c := range cases {
+		a, b := search.Phonetic(c.a), search.Phonetic(c.b)
+		if a != c.want || b != c.want {
+			t.Errorf("Phonetic(%q) = %q, Phonetic(%q) = %q, want both %q", c.a, a, c.b, b, c.want)
+		}
+	}
+}
+
+func TestPhoneticKeepsDistinctNames(t *testing.T) {
+	cases := [][2]string{
+		{"Yohanes", "Yonathan"},
+		{"Maria", "Mario"},
+		{"Budi", "Budiman"},
+	}
+	for _, c := range cases {
+		if search.Phonetic(c[0]) == search.Phonetic(c[1]) {
+			t.Errorf("%q and %q share the phonetic key %q", c[0], c[1], search.Phonetic(c[0]))
+		}
+	}
+}
+
+func TestTrigrams(t *testing.T) {
+	cases := []struct {
+		name string
+		want []string
+	}{
+		{"Joko", []string{"  y", " yo", "yok", "oko", "ko "}},
+		{"Djoko", []string{"  y", " yo", "yok", "oko", "ko "}},
+		{"Ani", []string{"  a", " an", "ani", "ni "}},
+		{"Ani Ani", []string{"  a", " an", "ani", "ni "}},
+		{"", []string{}},
+	}
+	for _, c := range cases {
+		if got := search.Trigrams(c.name); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Trigrams(%q) = %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	cases := []struct {
+		a, b string
+		min  float64
+		max  float64
+	}{
+		{"Yohanes", "Johannes", 1, 1},
+		{"Kristina", "Kristna", 0.4, 0.99},
+		{"Yohanes", "Budi", 0, 0},
+		{"", "Budi", 0, 0},
+	}
+	for _, c := range cases {
+		got := search.Similarity(search.Trigrams(c.a), search.Trigrams(c.b))
+		if got < c.min || got > c.max {
+			t.Errorf("Similarity(%q, %q) = %.2f, want between %.2f and %.2f", c.a, c.b, got, c.min, c.max)
+		}
+	}
+}
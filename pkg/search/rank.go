@@ -0,0 +1,121 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// minScore drops candidates sharing too few trigrams with the query
+	minScore = 0.2
+	// wordSimilarity is the trigram similarity a name word needs to match a query word
+	wordSimilarity = 0.4
+)
+
+// Candidate is a profile the database found for a query
+type Candidate struct {
+	ID        uint    `db:"id"`
+	Name      string  `db:"name"`
+	TextScore float64 `db:"text_score"`
+}
+
+// Highlight marks a matched word of a name, in rune offsets
+type Highlight struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
+
+// Result is a ranked search result
+type Result struct {
+	ID         uint        `json:"id"`
+	Name       string      `json:"name"`
+	Score      float64     `json:"score"`
+	Highlights []Highlight `json:"highlights"`
+}
+
+// Rank scores candidates against query and returns the best limit of them.
+// Every query word is scored by its most similar name word, so extra names
+// don't push a member down, and FULLTEXT relevance is added on top.
+func Rank(query string, candidates []Candidate, limit int) []Result {
+	queryWords := strings.Fields(Phonetic(query))
+
+	results := []Result{}
+	for _, c := range candidates {
+		highlights, score := match(c.Name, queryWords)
+		if c.TextScore > 0 {
+			score += c.TextScore / (c.TextScore + 1) / 2
+		}
+
+		if score < minScore {
+			continue
+		}
+		results = append(results, Result{ID: c.ID, Name: c.Name, Score: score, Highlights: highlights})
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+	if limit > 0 && len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// match returns words of name matching a query word along with the mean
+// similarity of every query word to its closest name word
+func match(name string, queryWords []string) ([]Highlight, float64) {
+	highlights := []Highlight{}
+	best := make([]float64, len(queryWords))
+
+	runes := []rune(name)
+	for start := 0; start < len(runes); {
+		if unicode.IsSpace(runes[start]) {
+			start++
+			continue
+		}
+
+		end := start
+		for end < len(runes) && !unicode.IsSpace(runes[end]) {
+			end++
+		}
+
+		word := Phonetic(string(runes[start:end]))
+		matched := false
+		for i, q := range queryWords {
+			sim := wordSimilarityOf(word, q)
+			if sim > best[i] {
+				best[i] = sim
+			}
+			if sim >= wordSimilarity {
+				matched = true
+			}
+		}
+		if matched {
+			highlights = append(highlights, Highlight{Start: start, End: end})
+		}
+		start = end
+	}
+
+	if len(queryWords) == 0 {
+		return highlights, 0
+	}
+
+	var sum float64
+	for _, b := range best {
+		sum += b
+	}
+	return highlights, sum / float64(len(queryWords))
+}
+
+// wordSimilarityOf returns 1 for equal phonetic words or a name word
+// starting with the query word, their trigram similarity otherwise
+func wordSimilarityOf(word, query string) float64 {
+	if word == "" || query == "" {
+		return 0
+	}
+	if word == query || len(query) >= 3 && strings.HasPrefix(word, query) {
+		return 1
+	}
+	return Similarity(Trigrams(word), Trigrams(query))
+}
@@ -0,0 +1,81 @@
+package search_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/search"
+)
+
+func TestRank(t *testing.T) {
+	candidates := []search.Candidate{
+		{ID: 1, Name: "Yohanes Susanto"},
+		{ID: 2, Name: "Christina"},
+		{ID: 3, Name: "Budi Hartono"},
+		{ID: 4, Name: "Djoko"},
+		{ID: 5, Name: "Sukarno Wijaya"},
+	}
+
+	cases := []struct {
+		query string
+		want  []uint
+	}{
+		{"Johannes", []uint{1}},
+		{"Cristina", []uint{2}},
+		{"Joko", []uint{4}},
+		{"Soekarno", []uint{5}},
+		{"Yohanis", []uint{1}},
+		{"Kristna", []uint{2}},
+		{"Susanto Yohanes", []uint{1}},
+		{"Zakaria", nil},
+	}
+	for _, c := range cases {
+		var got []uint
+		for _, r := range search.Rank(c.query, candidates, 10) {
+			got = append(got, r.ID)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Rank(%q) = %v, want %v", c.query, got, c.want)
+		}
+	}
+}
+
+func TestRankOrdersAndLimits(t *testing.T) {
+	candidates := []search.Candidate{
+		{ID: 1, Name: "Yohana"},
+		{ID: 2, Name: "Yohanes"},
+		{ID: 3, Name: "Yohanes Budi", TextScore: 3},
+	}
+
+	results := search.Rank("Yohanes", candidates, 2)
+	if len(results) != 2 || results[0].ID != 3 || results[1].ID != 2 {
+		t.Fatalf("Rank = %+v, want 3 then 2", results)
+	}
+	if results[1].Score != 1 {
+		t.Errorf("exact single word score %.2f, want 1", results[1].Score)
+	}
+}
+
+func TestRankHighlights(t *testing.T) {
+	cases := []struct {
+		name  string
+		query string
+		want  []search.Highlight
+	}{
+		{"Yohanes Susanto", "Johannes", []search.Highlight{{Start: 0, End: 7}}},
+		{"Budi  Yohanes", "yohanes", []search.Highlight{{Start: 6, End: 13}}},
+		// offsets count runes, not bytes
+		{"Ñoño José Pérez", "Jose Perez", []search.Highlight{{Start: 5, End: 9}, {Start: 10, End: 15}}},
+		{"Renée Cristína", "Christina", []search.Highlight{{Start: 6, End: 14}}},
+	}
+	for _, c := range cases {
+		results := search.Rank(c.query, []search.Candidate{{ID: 1, Name: c.name}}, 1)
+		if len(results) != 1 {
+			t.Errorf("Rank(%q) of %q found nothing", c.query, c.name)
+			continue
+		}
+		if got := results[0].Highlights; !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Rank(%q) of %q highlights %+v, want %+v", c.query, c.name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package seed
+
+var maleNames = []string{
+	"Yohanes", "Andreas", "Budi", "Daniel", "Yosua", "Samuel", "Timotius", "Petrus",
+	"Paulus", "Stefanus", "Markus", "Lukas", "Matius", "Yakobus", "Filipus", "Bartolomeus",
+	"Agus", "Hendra", "Yudi", "Eko", "Joko", "Slamet", "Bambang", "Wahyu",
+	"Rudi", "Dedi", "Fransiskus", "Kristian", "Gabriel", "Mikael", "Rafael", "Natanael",
+	"Imanuel", "Yonathan", "Elia", "Yeremia", "Yusuf", "Benyamin", "Gideon", "Ruben",
+	"Adi", "Arif", "Bayu", "Dimas", "Fajar", "Galih", "Hadi", "Irwan",
+	"Kevin", "Michael", "Christopher", "Vincent", "Felix", "Aditya", "Bonifasius", "Ignatius",
+}
+
+var femaleNames = []string{
+	"Maria", "Kristina", "Debora", "Ester", "Rut", "Hana", "Sara", "Rebeka",
+	"Lidia", "Priskila", "Magdalena", "Elisabet", "Yohana", "Marta", "Naomi", "Miriam",
+	"Sri", "Dewi", "Wulan", "Ratna", "Siti", "Indah", "Ayu", "Putri",
+	"Lestari", "Kartika", "Anastasia", "Veronika", "Agnes", "Theresia", "Katarina", "Monika",
+	"Stefani", "Angelina", "Grace", "Felicia", "Natalia", "Yosefina", "Fransiska", "Lusia",
+	"Rina", "Nia", "Tika", "Yuli", "Evi", "Fitri", "Lia", "Mega",
+	"Clara", "Jessica", "Michelle", "Olivia", "Cecilia", "Benedikta", "Caroline", "Tabita",
+}
+
+var familyNames = []string{
+	"Simanjuntak", "Siahaan", "Hutapea", "Sitompul", "Nainggolan", "Pardede", "Siregar", "Manurung",
+	"Tambunan", "Panjaitan", "Sinaga", "Situmorang", "Wijaya", "Gunawan", "Santoso", "Halim",
+	"Tanuwidjaja", "Kusuma", "Setiawan", "Hartono", "Susanto", "Pratama", "Saputra", "Nugroho",
+	"Lumban Tobing", "Rumahorbo", "Manuputty", "Pattinama", "Latuheru", "Wattimena", "Rumbewas", "Mandagi",
+	"Sondakh", "Lumenta", "Pangemanan", "Wenas", "Tumbelaka", "Soekarno", "Djojohadikusumo", "Tjahjadi",
+}
+
+// spellingVariants lists other spellings members actually use, so demo
+// data exercises fuzzy name search
+var spellingVariants = map[string][]string{
+	"Yohanes":     {"Johannes", "Johanes", "Yohannes"},
+	"Kristina":    {"Christina", "Cristina", "Kristin"},
+	"Kristian":    {"Christian", "Cristian"},
+	"Yosua":       {"Joshua", "Josua"},
+	"Yusuf":       {"Joseph", "Yosef"},
+	"Yakobus":     {"Jacobus", "Jakobus"},
+	"Matius":      {"Matheus", "Mattheus"},
+	"Stefanus":    {"Stephanus", "Steven"},
+	"Elisabet":    {"Elizabeth", "Elisabeth"},
+	"Theresia":    {"Teresia", "Theresa"},
+	"Katarina":    {"Catharina", "Katharina"},
+	"Fitri":       {"Fitriah"},
+	"Joko":        {"Djoko"},
+	"Yudi":        {"Judi"},
+	"Santoso":     {"Santosa"},
+	"Soekarno":    {"Sukarno"},
+	"Tjahjadi":    {"Cahyadi"},
+	"Tanuwidjaja": {"Tanuwijaya"},
+}
+
+var groupNames = []string{
+	"Komsel", "Paduan Suara", "Pemuda", "Remaja", "Sekolah Minggu", "Wanita",
+	"Pria", "Lansia", "Doa Syafaat", "Multimedia", "Penyambut Jemaat", "Diakonia",
+}
+
+var areas = []string{
+	"Menteng", "Kemang", "Kelapa Gading", "Pluit", "Cibubur", "Bintaro",
+	"Serpong", "Depok", "Bekasi", "Tangerang", "Cempaka Putih", "Rawamangun",
+}
+
+var streets = []string{
+	"Jl. Merdeka", "Jl. Sudirman", "Jl. Diponegoro", "Jl. Gatot Subroto", "Jl. Pemuda",
+	"Jl. Kenanga", "Jl. Melati", "Jl. Mawar", "Jl. Anggrek", "Jl. Flamboyan",
+	"Jl. Cempaka", "Jl. Dahlia", "Jl. Kebon Jeruk", "Jl. Taman Sari", "Jl. Pahlawan",
+}
+
+var events = []string{"Ibadah Raya", "Ibadah Raya", "Ibadah Raya", "Persekutuan Doa", "Komsel"}
@@ -0,0 +1,314 @@
+// Package seed fills a database with fake but realistic members so the
+// service can be demoed, load tested and developed without production data.
+package seed
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/repository"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+// Config sets volumes of generated data
+type Config struct {
+	// BranchID is the church branch every generated row belongs to
+	BranchID uint
+	Profiles int
+	// HouseholdSize is the average number of members living together
+	HouseholdSize int
+	Groups        int
+	// GroupsPerMember is the most groups a member joins
+	GroupsPerMember int
+	// AttendanceWeeks is how many past weeks of attendance are generated
+	AttendanceWeeks int
+	// PhotoRatio is the share of members given a photo, from 0 to 1
+	PhotoRatio float64
+	// Seed makes generated data reproducible
+	Seed int64
+}
+
+// Report counts generated rows
+type Report struct {
+	Profiles    int `json:"profiles"`
+	Households  int `json:"households"`
+	Groups      int `json:"groups"`
+	Memberships int `json:"memberships"`
+	Attendances int `json:"attendances"`
+	Photos      int `json:"photos"`
+}
+
+type generator struct {
+	cfg      Config
+	rand     *rand.Rand
+	groupIDs []uint
+	report   Report
+}
+
+// Run generates data of cfg into db, writing photos into store
+func Run(ctx context.Context, db *sqlx.DB, store storage.StorageInterface, cfg Config) (Report, error) {
+	g := &generator{cfg: cfg, rand: rand.New(rand.NewSource(cfg.Seed))}
+	if g.cfg.BranchID == 0 {
+		g.cfg.BranchID = tenant.Default()
+	}
+	if g.cfg.HouseholdSize < 1 {
+		g.cfg.HouseholdSize = 1
+	}
+
+	if err := mysql.WithTx(ctx, db, g.groups(ctx)); err != nil {
+		return g.report, err
+	}
+
+	for g.report.Profiles < cfg.Profiles {
+		var photos []uint
+		before := g.report
+		err := mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+			// WithTx retries deadlocked transactions from the start
+			g.report = before
+
+			var err error
+			photos, err = g.household(ctx, tx)
+			return err
+		})
+		if err != nil {
+			return g.report, err
+		}
+
+		for _, id := range photos {
+			if err := g.photo(ctx, db, store, id); err != nil {
+				return g.report, err
+			}
+		}
+	}
+	return g.report, nil
+}
+
+func (g *generator) groups(ctx context.Context) func(tx *sqlx.Tx) error {
+	return func(tx *sqlx.Tx) error {
+		g.groupIDs, g.report.Groups = nil, 0
+		for i := 0; i < g.cfg.Groups; i++ {
+			name := fmt.Sprintf("%s %s", g.pick(groupNames), g.pick(areas))
+			res, err := tx.ExecContext(ctx, "INSERT INTO `groups` (branch_id, name) VALUES (?, ?)", g.cfg.BranchID, name)
+			if err != nil {
+				return err
+			}
+
+			id, err := res.LastInsertId()
+			if err != nil {
+				return err
+			}
+			g.groupIDs = append(g.groupIDs, uint(id))
+			g.report.Groups++
+		}
+		return nil
+	}
+}
+
+// household inserts a household with its members, returning members to be given a photo
+func (g *generator) household(ctx context.Context, tx *sqlx.Tx) ([]uint, error) {
+	family := g.pick(familyNames)
+	address := fmt.Sprintf("%s No. %d, %s", g.pick(streets), 1+g.rand.Intn(200), g.pick(areas))
+
+	res, err := tx.ExecContext(ctx, "INSERT INTO households (branch_id, name, address) VALUES (?, ?, ?)", g.cfg.BranchID, "Keluarga "+family, address)
+	if err != nil {
+		return nil, err
+	}
+	householdID, err := res.LastInsertId()
+	if err != nil {
+		return nil, err
+	}
+	g.report.Households++
+
+	size := 1 + g.rand.Intn(2*g.cfg.HouseholdSize)
+	if remaining := g.cfg.Profiles - g.report.Profiles; size > remaining {
+		size = remaining
+	}
+
+	profiles := repository.NewProfileRepository(tx)
+	photos := []uint{}
+	for i := 0; i < size; i++ {
+		p := g.member(family, address, i)
+		hid := uint(householdID)
+		p.HouseholdID = &hid
+
+		res, err := tx.ExecContext(ctx, "INSERT INTO profiles (branch_id, household_id, name, gender, birth_date, phone, email, address) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			g.cfg.BranchID, p.HouseholdID, p.Name, p.Gender, p.BirthDate, p.Phone, p.Email, p.Address)
+		if err != nil {
+			return nil, err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return nil, err
+		}
+		p.ID = uint(id)
+		g.report.Profiles++
+
+		if err := profiles.IndexName(ctx, p.ID, p.Name); err != nil {
+			return nil, err
+		}
+		if err := g.memberships(ctx, tx, p.ID); err != nil {
+			return nil, err
+		}
+		if err := g.attendances(ctx, tx, p.ID); err != nil {
+			return nil, err
+		}
+
+		if g.rand.Float64() < g.cfg.PhotoRatio {
+			photos = append(photos, p.ID)
+		}
+	}
+	return photos, nil
+}
+
+// member returns the i-th member of a household, the first two being parents
+func (g *generator) member(family string, address string, i int) profile.Profile {
+	gender := "M"
+	if i == 1 || i > 1 && g.rand.Intn(2) == 0 {
+		gender = "F"
+	}
+
+	first := g.pick(maleNames)
+	if gender == "F" {
+		first = g.pick(femaleNames)
+	}
+
+	name := g.variant(first) + " " + g.variant(family)
+	if g.rand.Float64() < 0.1 {
+		// single names are common, especially among older Javanese members
+		name = g.variant(first)
+	}
+
+	age := 25 + g.rand.Intn(50)
+	if i > 1 {
+		age = g.rand.Intn(25)
+	}
+	birth := time.Now().AddDate(-age, -g.rand.Intn(12), -g.rand.Intn(28)).Truncate(24 * time.Hour)
+
+	login := strings.ToLower(strings.Replace(name, " ", ".", -1))
+	return profile.Profile{
+		Name:      name,
+		Gender:    gender,
+		BirthDate: &birth,
+		Phone:     fmt.Sprintf("+628%d%08d", 11+g.rand.Intn(88), g.rand.Intn(100000000)),
+		Email:     fmt.Sprintf("%s%d@example.com", login, g.rand.Intn(1000)),
+		Address:   address,
+	}
+}
+
+func (g *generator) memberships(ctx context.Context, tx *sqlx.Tx, profileID uint) error {
+	if len(g.groupIDs) == 0 || g.cfg.GroupsPerMember < 1 {
+		return nil
+	}
+
+	joined := map[uint]bool{}
+	for n := g.rand.Intn(g.cfg.GroupsPerMember + 1); n > 0; n-- {
+		groupID := g.groupIDs[g.rand.Intn(len(g.groupIDs))]
+		if joined[groupID] {
+			continue
+		}
+		joined[groupID] = true
+
+		if _, err := tx.ExecContext(ctx, "INSERT INTO group_members (group_id, profile_id) VALUES (?, ?)", groupID, profileID); err != nil {
+			return err
+		}
+		g.report.Memberships++
+	}
+	return nil
+}
+
+// attendances inserts weekly attendances, each member attending at their own rate
+func (g *generator) attendances(ctx context.Context, tx *sqlx.Tx, profileID uint) error {
+	rate := 0.3 + 0.65*g.rand.Float64()
+	sunday := lastSunday(time.Now())
+
+	values := []string{}
+	args := []interface{}{}
+	for week := 0; week < g.cfg.AttendanceWeeks; week++ {
+		if g.rand.Float64() >= rate {
+			continue
+		}
+
+		at := sunday.AddDate(0, 0, -7*week).Add(time.Duration(7+2*g.rand.Intn(4)) * time.Hour)
+		values = append(values, "(?, ?, ?)")
+		args = append(args, profileID, g.pick(events), at)
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	if _, err := tx.ExecContext(ctx, "INSERT INTO attendances (profile_id, event, attended_at) VALUES "+strings.Join(values, ", "), args...); err != nil {
+		return err
+	}
+	g.report.Attendances += len(values)
+	return nil
+}
+
+// photo stores a generated avatar as the photo of given profile
+func (g *generator) photo(ctx context.Context, db *sqlx.DB, store storage.StorageInterface, profileID uint) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, g.avatar(256)); err != nil {
+		return err
+	}
+
+	filename := uuid.New().String() + ".png"
+	if err := store.Put(profile.PhotoPrefix(profileID), filename, &buf); err != nil {
+		return err
+	}
+
+	if err := repository.NewProfileRepository(db).UpdatePhoto(ctx, profileID, filename); err != nil {
+		return err
+	}
+	g.report.Photos++
+	return nil
+}
+
+// avatar draws a head and shoulders silhouette over a random background
+func (g *generator) avatar(size int) image.Image {
+	bg := color.RGBA{uint8(80 + g.rand.Intn(150)), uint8(80 + g.rand.Intn(150)), uint8(80 + g.rand.Intn(150)), 255}
+	fg := color.RGBA{bg.R / 2, bg.G / 2, bg.B / 2, 255}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	head, body := size/5, size/2
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			dx, hy, by := x-size/2, y-size*2/5, y-size*11/10
+			if dx*dx+hy*hy < head*head || dx*dx+by*by < body*body {
+				img.Set(x, y, fg)
+			} else {
+				img.Set(x, y, bg)
+			}
+		}
+	}
+	return img
+}
+
+func (g *generator) pick(values []string) string {
+	return values[g.rand.Intn(len(values))]
+}
+
+// variant returns name or, sometimes, another spelling of it
+func (g *generator) variant(name string) string {
+	variants := spellingVariants[name]
+	if len(variants) == 0 || g.rand.Float64() >= 0.3 {
+		return name
+	}
+	return variants[g.rand.Intn(len(variants))]
+}
+
+func lastSunday(t time.Time) time.Time {
+	t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	return t.AddDate(0, 0, -int(t.Weekday()))
+}
@@ -1,22 +1,30 @@
 package storage
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"io"
 	"log"
-	"math/rand"
 	"mime"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/minio/minio-go"
 )
 
+// amzMetaPrefix marks user metadata headers of S3 objects
+const amzMetaPrefix = "x-amz-meta-"
+
+// s3MaxKeys is the most keys S3 returns per listing request
+const s3MaxKeys = 1000
+
 type AWS2 struct {
 	client *minio.Client
 	opt    Option
+	cdn    *CDN
 }
 
 type Option struct {
@@ -26,6 +34,7 @@ type Option struct {
 	Secure   bool
 	Bucket   string
 	CdnHosts string
+	ACL      string
 }
 
 func InitAWS2() (StorageInterface, error) {
@@ -36,6 +45,7 @@ func InitAWS2() (StorageInterface, error) {
 		Secure:   false,
 		Bucket:   os.Getenv("RIAKCS_BUCKET"),
 		CdnHosts: os.Getenv("CDN_HOSTS"),
+		ACL:      "public-read",
 	}
 	client, err := minio.NewV2(awsOpt.Host, awsOpt.Key, awsOpt.Secret, awsOpt.Secure)
 	if err != nil {
@@ -57,16 +67,48 @@ func InitAWS2() (StorageInterface, error) {
 		}
 	}
 
-	return AWS2{client: client, opt: awsOpt}, err
+	scheme := "http"
+	if awsOpt.Secure {
+		scheme = "https"
+	}
+	cdn := NewCDN(awsOpt.CdnHosts, fmt.Sprintf("%s://%s", scheme, awsOpt.Host), os.Getenv("CDN_PROBE_PATH"))
+
+	interval, err := time.ParseDuration(os.Getenv("CDN_PROBE_INTERVAL"))
+	if err != nil {
+		interval = 30 * time.Second
+	}
+	go cdn.Run(context.Background(), interval)
+
+	return AWS2{client: client, opt: awsOpt, cdn: cdn}, nil
+}
+
+// Private returns a copy of aws storing objects without public read access
+func (aws AWS2) Private() StorageInterface {
+	aws.opt.ACL = "private"
+	return aws
 }
 
 func (aws AWS2) Get(filePrefix string, filename string) (io.Reader, error) {
-	if filename == "" {
-		return nil, errors.New("file not found")
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return nil, err
 	}
 
-	var objectName = filepath.Join(filePrefix, filename)
-	return aws.client.GetObject(aws.opt.Bucket, objectName, minio.GetObjectOptions{})
+	obj, err := aws.client.GetObject(aws.opt.Bucket, name, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	// GetObject is lazy, stat it so a missing object fails here like Local
+	if _, err := obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, ErrFileNotFound
+		}
+		return nil, err
+	}
+
+	return obj, nil
 }
 
 func (aws AWS2) GetPath(filePrefix string, filename string) (string, error) {
@@ -74,29 +116,173 @@ func (aws AWS2) GetPath(filePrefix string, filename string) (string, error) {
 		return "", nil
 	}
 
-	hosts := strings.Split(aws.opt.CdnHosts, ",")
-	host := hosts[random(0, len(hosts))]
-	fileURL := fmt.Sprintf("%s/%s", host, filepath.Join(aws.opt.Bucket, filePrefix, filename))
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	fileURL := fmt.Sprintf("%s/%s", aws.cdn.Host(name), path.Join(aws.opt.Bucket, name))
 
 	return fileURL, nil
 }
 
 func (aws AWS2) Delete(filePrefix string, filename string) error {
-	if filename == "" {
-		return errors.New("file not found")
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return err
 	}
 
-	err := aws.client.RemoveObject(aws.opt.Bucket, filepath.Join(filePrefix, filename))
-	return err
+	return aws.client.RemoveObject(aws.opt.Bucket, name)
 }
 
 func (aws AWS2) Put(filePrefix string, filename string, file io.Reader) error {
+	return aws.PutWithMetadata(filePrefix, filename, file, nil)
+}
+
+func (aws AWS2) PutWithMetadata(filePrefix string, filename string, file io.Reader, metadata map[string]string) error {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return err
+	}
+
 	ext := filepath.Ext(filename)
 	ctype := mime.TypeByExtension(ext)
-	_, err := aws.client.PutObject(aws.opt.Bucket, filepath.Join(filePrefix, filename), file, -1, minio.PutObjectOptions{ContentType: ctype, UserMetadata: map[string]string{"x-amz-acl": "public-read"}})
+	_, err = aws.client.PutObject(aws.opt.Bucket, name, file, -1, minio.PutObjectOptions{ContentType: ctype, UserMetadata: aws.userMetadata(metadata)})
 	return err
 }
 
-func random(min, max int) int {
-	return rand.Intn(max-min) + min
+// userMetadata returns headers stored with every object: the ACL, which
+// makes objects readable through the CDN, and given user metadata
+func (aws AWS2) userMetadata(metadata map[string]string) map[string]string {
+	userMetadata := map[string]string{"x-amz-acl": aws.opt.ACL}
+	for k, v := range metadata {
+		userMetadata[amzMetaPrefix+k] = v
+	}
+	return userMetadata
+}
+
+func (aws AWS2) Stat(filePrefix string, filename string) (FileInfo, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	obj, err := aws.client.StatObject(aws.opt.Bucket, name, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return FileInfo{}, ErrFileNotFound
+		}
+		return FileInfo{}, err
+	}
+	return objectInfo(obj), nil
+}
+
+func (aws AWS2) List(filePrefix string, marker string, limit int) ([]FileInfo, string, error) {
+	if err := validPrefix(filePrefix); err != nil {
+		return nil, "", err
+	}
+
+	// the marker is sent as start-after, so each page is listed from where
+	// the previous one ended rather than from the start of the prefix
+	core := minio.Core{Client: aws.client}
+	infos := []FileInfo{}
+	token := ""
+	for limit <= 0 || len(infos) < limit {
+		maxKeys := s3MaxKeys
+		if limit > 0 && limit-len(infos) < maxKeys {
+			maxKeys = limit - len(infos)
+		}
+
+		res, err := core.ListObjectsV2(aws.opt.Bucket, listPrefix(filePrefix), token, false, "", maxKeys, marker)
+		if err != nil {
+			return nil, "", err
+		}
+		for _, obj := range res.Contents {
+			infos = append(infos, objectInfo(obj))
+		}
+
+		if !res.IsTruncated {
+			return infos, "", nil
+		}
+		token = res.NextContinuationToken
+	}
+	return infos, infos[len(infos)-1].Name, nil
+}
+
+func (aws AWS2) Copy(srcPrefix string, srcFilename string, dstPrefix string, dstFilename string) error {
+	src, err := objectName(srcPrefix, srcFilename)
+	if err != nil {
+		return err
+	}
+	dst, err := objectName(dstPrefix, dstFilename)
+	if err != nil {
+		return err
+	}
+
+	// passing headers replaces every header of the copy, so the ACL, content
+	// type and user metadata of the source are all given again
+	info, err := aws.Stat(srcPrefix, srcFilename)
+	if err != nil {
+		return err
+	}
+	headers := aws.userMetadata(info.Metadata)
+	if info.ContentType != "" {
+		headers["Content-Type"] = info.ContentType
+	}
+
+	dstInfo, err := minio.NewDestinationInfo(aws.opt.Bucket, dst, nil, headers)
+	if err != nil {
+		return err
+	}
+	return aws.client.CopyObject(dstInfo, minio.NewSourceInfo(aws.opt.Bucket, src, nil))
+}
+
+// objectInfo converts minio.ObjectInfo to FileInfo
+func objectInfo(obj minio.ObjectInfo) FileInfo {
+	var metadata map[string]string
+	for k := range obj.Metadata {
+		key := strings.ToLower(k)
+		if !strings.HasPrefix(key, amzMetaPrefix) {
+			continue
+		}
+		if metadata == nil {
+			metadata = map[string]string{}
+		}
+		metadata[strings.TrimPrefix(key, amzMetaPrefix)] = obj.Metadata.Get(k)
+	}
+
+	return FileInfo{
+		Name:        obj.Key,
+		Size:        obj.Size,
+		ContentType: obj.ContentType,
+		ModTime:     obj.LastModified,
+		Checksum:    strings.Trim(obj.ETag, "\""),
+		Metadata:    metadata,
+	}
+}
+
+func (aws AWS2) PresignedGetURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := aws.client.PresignedGetObject(aws.opt.Bucket, name, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (aws AWS2) PresignedPutURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	u, err := aws.client.PresignedPutObject(aws.opt.Bucket, name, expiry)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
 }
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CDN picks the host serving an object. The same object always maps to the
+// same healthy host (rendezvous hashing), so browser caches hit and only
+// objects of a failing host move elsewhere. Without healthy host the origin
+// is used.
+type CDN struct {
+	hosts     []string
+	origin    string
+	probePath string
+
+	mu      *sync.RWMutex
+	healthy map[string]bool
+}
+
+// NewCDN returns CDN over comma separated hosts, every host assumed healthy
+// until probed. probePath is requested on each host by Probe.
+func NewCDN(hosts string, origin string, probePath string) *CDN {
+	c := &CDN{origin: origin, probePath: probePath, mu: &sync.RWMutex{}, healthy: map[string]bool{}}
+	for _, h := range strings.Split(hosts, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		c.hosts = append(c.hosts, h)
+		c.healthy[h] = true
+	}
+	return c
+}
+
+// Host returns host serving given object name
+func (c *CDN) Host(name string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var (
+		best      string
+		bestScore uint64
+	)
+	for _, h := range c.hosts {
+		if !c.healthy[h] {
+			continue
+		}
+
+		sum := md5.Sum([]byte(h + "/" + name))
+		if score := binary.BigEndian.Uint64(sum[:8]); best == "" || score > bestScore {
+			best, bestScore = h, score
+		}
+	}
+
+	if best == "" {
+		return c.origin
+	}
+	return best
+}
+
+// Probe requests probePath on every host and marks those failing unhealthy
+func (c *CDN) Probe(ctx context.Context, client *http.Client) {
+	for _, h := range c.hosts {
+		healthy := c.probe(ctx, client, h)
+
+		c.mu.Lock()
+		c.healthy[h] = healthy
+		c.mu.Unlock()
+	}
+}
+
+// Run probes hosts every interval until ctx is done
+func (c *CDN) Run(ctx context.Context, interval time.Duration) {
+	client := &http.Client{Timeout: 5 * time.Second}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		c.Probe(ctx, client)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *CDN) probe(ctx context.Context, client *http.Client, host string) bool {
+	req, err := http.NewRequest(http.MethodHead, host+"/"+strings.TrimPrefix(c.probePath, "/"), nil)
+	if err != nil {
+		return false
+	}
+
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+
+	return resp.StatusCode < http.StatusInternalServerError
+}
@@ -0,0 +1,142 @@
+package storage_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/storage"
+)
+
+func objectNames(n int) []string {
+	names := make([]string, n)
+	for i := range names {
+		names[i] = fmt.Sprintf("profiles/%d/photo.jpg", i)
+	}
+	return names
+}
+
+func TestCDNHostIsStable(t *testing.T) {
+	cases := []struct {
+		name  string
+		hosts string
+	}{
+		{"same hosts", "http://a.cdn,http://b.cdn,http://c.cdn"},
+		{"reordered hosts", "http://c.cdn, http://a.cdn ,http://b.cdn"},
+	}
+
+	cdn := storage.NewCDN("http://a.cdn,http://b.cdn,http://c.cdn", "http://origin", "")
+	for _, c := range cases {
+		other := storage.NewCDN(c.hosts, "http://origin", "")
+		for _, name := range objectNames(100) {
+			if got, want := other.Host(name), cdn.Host(name); got != want {
+				t.Errorf("%s: %s on %s, want %s", c.name, name, got, want)
+			}
+			if cdn.Host(name) != cdn.Host(name) {
+				t.Errorf("%s: %s moves between calls", c.name, name)
+			}
+		}
+	}
+}
+
+func TestCDNRemovingHostOnlyMovesItsObjects(t *testing.T) {
+	before := storage.NewCDN("http://a.cdn,http://b.cdn,http://c.cdn", "http://origin", "")
+	after := storage.NewCDN("http://a.cdn,http://c.cdn", "http://origin", "")
+
+	moved := 0
+	for _, name := range objectNames(300) {
+		was, is := before.Host(name), after.Host(name)
+		switch {
+		case was == "http://b.cdn":
+			moved++
+			if is == "http://b.cdn" || is == "http://origin" {
+				t.Errorf("%s of the removed host moved to %s", name, is)
+			}
+		case was != is:
+			t.Errorf("%s moved from %s to %s", name, was, is)
+		}
+	}
+	if moved == 0 {
+		t.Error("no object was served by the removed host")
+	}
+}
+
+func TestCDNSkipsUnhealthyHosts(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer failing.Close()
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	down.Close()
+
+	cases := []struct {
+		name  string
+		hosts []string
+		want  []string
+	}{
+		{"some healthy", []string{healthy.URL, failing.URL, down.URL}, []string{healthy.URL}},
+		{"none healthy", []string{failing.URL, down.URL}, []string{"http://origin"}},
+		{"no hosts", nil, []string{"http://origin"}},
+	}
+	for _, c := range cases {
+		cdn := storage.NewCDN(strings.Join(c.hosts, ","), "http://origin", "/healthz")
+		cdn.Probe(context.Background(), &http.Client{Timeout: time.Second})
+
+		for _, name := range objectNames(50) {
+			if got := cdn.Host(name); !contains(c.want, got) {
+				t.Errorf("%s: %s on %s, want one of %v", c.name, name, got, c.want)
+			}
+		}
+	}
+}
+
+func TestAWS2GetPathFallsBackToOrigin(t *testing.T) {
+	s3 := httptest.NewServer(&fakeS3{})
+	defer s3.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	host := strings.TrimPrefix(s3.URL, "http://")
+	t.Setenv("RIAKCS_HOST", host)
+	t.Setenv("RIAKCS_BUCKET", "bucket")
+	t.Setenv("CDN_HOSTS", failing.URL)
+	t.Setenv("CDN_PROBE_INTERVAL", "10ms")
+
+	store, err := storage.InitAWS2()
+	if err != nil {
+		t.Fatalf("InitAWS2: %v", err)
+	}
+
+	want := "http://" + host + "/bucket/profiles/1/photo.jpg"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		got, err := store.GetPath("profiles/1", "photo.jpg")
+		if err != nil {
+			t.Fatalf("GetPath: %v", err)
+		}
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("GetPath = %s once the only CDN host fails, want %s", got, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func contains(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,393 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Metadata stored with every encrypted object
+const (
+	// encryptionKeyMetadata holds the wrapped data key
+	encryptionKeyMetadata = "encryption-key"
+	// chunkSizeMetadata holds the plaintext size of the chunks an object
+	// is sealed in, objects without it are sealed whole
+	chunkSizeMetadata = "encryption-chunk-size"
+	// plainSizeMetadata and plainChecksumMetadata describe the plaintext,
+	// reported by Stat and List in place of the ciphertext ones
+	plainSizeMetadata     = "plain-size"
+	plainChecksumMetadata = "plain-checksum"
+)
+
+// sealOverhead is how much larger than its plaintext an object sealed by
+// seal is, the nonce and the GCM tag
+const sealOverhead = 12 + 16
+
+// chunkSize is the plaintext size of every chunk sealed by sealChunks but
+// the last, and maxChunkSize the largest accepted when reading
+const (
+	chunkSize    = 64 << 10
+	maxChunkSize = 16 << 20
+)
+
+var (
+	// ErrPrivateFile is returned when asking a public URL of an encrypted file
+	ErrPrivateFile = errors.New("file is private")
+	// ErrInvalidMasterKey is returned when the master key is not 32 bytes of base64
+	ErrInvalidMasterKey = errors.New("invalid master key")
+	// ErrNotEncrypted is returned when reading a file without wrapped data key
+	ErrNotEncrypted = errors.New("file is not encrypted")
+	// ErrCorruptedFile is returned while reading an encrypted file whose
+	// chunks were altered, reordered or truncated
+	ErrCorruptedFile = errors.New("encrypted file is corrupted")
+)
+
+// EncryptedStorage wraps a StorageInterface with client-side envelope
+// encryption: every object is sealed with its own AES-256-GCM data key,
+// stored next to it in metadata wrapped by the master key. Objects are
+// sealed and opened in chunks, so files of any size stream through the app
+// with bounded memory. Encrypted files have no public URL.
+type EncryptedStorage struct {
+	StorageInterface
+	master cipher.AEAD
+}
+
+// NewEncryptedStorage returns store wrapped with envelope encryption using a
+// base64 encoded 32 bytes master key. store should come from
+// NewPrivateStorage so objects are not readable through the bucket either.
+func NewEncryptedStorage(store StorageInterface, masterKey string) (StorageInterface, error) {
+	if masterKey == "" {
+		return nil, ErrMissingMasterKey
+	}
+
+	key, err := base64.StdEncoding.DecodeString(masterKey)
+	if err != nil || len(key) != 32 {
+		return nil, ErrInvalidMasterKey
+	}
+
+	master, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	return EncryptedStorage{StorageInterface: store, master: master}, nil
+}
+
+func (s EncryptedStorage) GetPath(filePrefix string, filename string) (string, error) {
+	return "", ErrPrivateFile
+}
+
+func (s EncryptedStorage) PresignedGetURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	return "", ErrPrivateFile
+}
+
+func (s EncryptedStorage) PresignedPutURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	return "", ErrPrivateFile
+}
+
+func (s EncryptedStorage) Put(filePrefix string, filename string, file io.Reader) error {
+	return s.PutWithMetadata(filePrefix, filename, file, nil)
+}
+
+// PutWithMetadata seals file chunk by chunk into a temporary file, so the
+// plaintext size and checksum are known before the object is stored
+func (s EncryptedStorage) PutWithMetadata(filePrefix string, filename string, file io.Reader, metadata map[string]string) error {
+	dataKey := make([]byte, 32)
+	if _, err := rand.Read(dataKey); err != nil {
+		return err
+	}
+
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := ioutil.TempFile("", "encrypted-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(sealed.Name())
+	defer sealed.Close()
+
+	sum := md5.New()
+	size, err := sealChunks(data, sealed, io.TeeReader(file, sum))
+	if err != nil {
+		return err
+	}
+	if _, err := sealed.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	wrapped, err := seal(s.master, dataKey)
+	if err != nil {
+		return err
+	}
+
+	meta := normalizeMetadata(metadata)
+	if meta == nil {
+		meta = map[string]string{}
+	}
+	meta[encryptionKeyMetadata] = base64.StdEncoding.EncodeToString(wrapped)
+	meta[chunkSizeMetadata] = strconv.Itoa(chunkSize)
+	meta[plainSizeMetadata] = strconv.FormatInt(size, 10)
+	meta[plainChecksumMetadata] = hex.EncodeToString(sum.Sum(nil))
+
+	return s.StorageInterface.PutWithMetadata(filePrefix, filename, sealed, meta)
+}
+
+// Get returns a reader opening the object chunk by chunk as it is read,
+// failing with ErrCorruptedFile on the first chunk that does not open
+func (s EncryptedStorage) Get(filePrefix string, filename string) (io.Reader, error) {
+	info, err := s.StorageInterface.Stat(filePrefix, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	encoded, ok := info.Metadata[encryptionKeyMetadata]
+	if !ok {
+		return nil, ErrNotEncrypted
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, err
+	}
+
+	dataKey, err := open(s.master, wrapped)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := newGCM(dataKey)
+	if err != nil {
+		return nil, err
+	}
+
+	size := 0
+	if v, ok := info.Metadata[chunkSizeMetadata]; ok {
+		if size, err = strconv.Atoi(v); err != nil || size <= 0 || size > maxChunkSize {
+			return nil, ErrCorruptedFile
+		}
+	}
+
+	f, err := s.StorageInterface.Get(filePrefix, filename)
+	if err != nil {
+		return nil, err
+	}
+	if size > 0 {
+		return newChunkReader(data, f, size), nil
+	}
+
+	// objects stored before chunking are sealed whole
+	if c, ok := f.(io.Closer); ok {
+		defer c.Close()
+	}
+	sealed, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	plain, err := open(data, sealed)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(plain), nil
+}
+
+func (s EncryptedStorage) Stat(filePrefix string, filename string) (FileInfo, error) {
+	info, err := s.StorageInterface.Stat(filePrefix, filename)
+	if err != nil {
+		return info, err
+	}
+	return plainInfo(info), nil
+}
+
+func (s EncryptedStorage) List(filePrefix string, marker string, limit int) ([]FileInfo, string, error) {
+	infos, next, err := s.StorageInterface.List(filePrefix, marker, limit)
+	for i := range infos {
+		infos[i] = plainInfo(infos[i])
+	}
+	return infos, next, err
+}
+
+// plainInfo returns info describing the plaintext of an encrypted object,
+// without encryption metadata. Objects stored before the plaintext was
+// described get their size derived from the ciphertext and no checksum.
+func plainInfo(info FileInfo) FileInfo {
+	if _, ok := info.Metadata[encryptionKeyMetadata]; !ok {
+		return info
+	}
+
+	meta := normalizeMetadata(info.Metadata)
+	if size, err := strconv.ParseInt(meta[plainSizeMetadata], 10, 64); err == nil {
+		info.Size = size
+		info.Checksum = meta[plainChecksumMetadata]
+	} else {
+		info.Size -= sealOverhead
+		info.Checksum = ""
+	}
+
+	for _, k := range []string{encryptionKeyMetadata, chunkSizeMetadata, plainSizeMetadata, plainChecksumMetadata} {
+		delete(meta, k)
+	}
+	if len(meta) == 0 {
+		meta = nil
+	}
+	info.Metadata = meta
+	return info
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts plain, prefixing the result with a random nonce
+func seal(aead cipher.AEAD, plain []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return aead.Seal(nonce, nonce, plain, nil), nil
+}
+
+// open decrypts data sealed by seal
+func open(aead cipher.AEAD, sealed []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, ErrNotEncrypted
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// sealChunks seals src into dst in chunks of chunkSize, returning the
+// plaintext size. The nonce of a chunk is its index along with whether it
+// is the last one, so chunks cannot be reordered, dropped or cut off
+// without failing to open.
+func sealChunks(aead cipher.AEAD, dst io.Writer, src io.Reader) (int64, error) {
+	r := bufio.NewReader(src)
+	chunk := make([]byte, chunkSize)
+
+	var size int64
+	for index := uint64(0); ; index++ {
+		n, err := io.ReadFull(r, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return size, err
+		}
+		size += int64(n)
+
+		last, err := atEOF(r, n < len(chunk))
+		if err != nil {
+			return size, err
+		}
+
+		if _, err := dst.Write(aead.Seal(nil, chunkNonce(index, last), chunk[:n], nil)); err != nil {
+			return size, err
+		}
+		if last {
+			return size, nil
+		}
+	}
+}
+
+// chunkReader opens chunks sealed by sealChunks as they are read
+type chunkReader struct {
+	aead   cipher.AEAD
+	src    *bufio.Reader
+	closer io.Closer
+	sealed []byte
+	plain  []byte
+	index  uint64
+	done   bool
+}
+
+func newChunkReader(aead cipher.AEAD, src io.Reader, size int) *chunkReader {
+	closer, _ := src.(io.Closer)
+	return &chunkReader{
+		aead:   aead,
+		src:    bufio.NewReader(src),
+		closer: closer,
+		sealed: make([]byte, size+aead.Overhead()),
+	}
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.plain) == 0 {
+		if r.done {
+			return 0, io.EOF
+		}
+		if err := r.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, r.plain)
+	r.plain = r.plain[n:]
+	return n, nil
+}
+
+func (r *chunkReader) next() error {
+	n, err := io.ReadFull(r.src, r.sealed)
+	if err == io.EOF {
+		return ErrCorruptedFile
+	}
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return err
+	}
+
+	last, err := atEOF(r.src, n < len(r.sealed))
+	if err != nil {
+		return err
+	}
+
+	plain, err := r.aead.Open(r.sealed[:0], chunkNonce(r.index, last), r.sealed[:n], nil)
+	if err != nil {
+		return ErrCorruptedFile
+	}
+	r.plain = plain
+	r.index++
+	r.done = last
+	return nil
+}
+
+func (r *chunkReader) Close() error {
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+// atEOF reports whether r has nothing left, which short already tells
+func atEOF(r *bufio.Reader, short bool) (bool, error) {
+	if short {
+		return true, nil
+	}
+	_, err := r.Peek(1)
+	if err == io.EOF {
+		return true, nil
+	}
+	return false, err
+}
+
+// chunkNonce returns the nonce of the chunk at index, its last byte
+// marking the last chunk
+func chunkNonce(index uint64, last bool) []byte {
+	nonce := make([]byte, 12)
+	binary.BigEndian.PutUint64(nonce[3:11], index)
+	if last {
+		nonce[11] = 1
+	}
+	return nonce
+}
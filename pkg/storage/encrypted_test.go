@@ -0,0 +1,137 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"io/ioutil"
+	"testing"
+)
+
+func encryptedMemory(t *testing.T) (EncryptedStorage, StorageInterface) {
+	t.Helper()
+
+	mem, err := InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	store, err := NewEncryptedStorage(mem, base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatalf("NewEncryptedStorage: %v", err)
+	}
+	return store.(EncryptedStorage), mem
+}
+
+func TestEncryptedChunks(t *testing.T) {
+	store, _ := encryptedMemory(t)
+
+	for _, size := range []int{0, 1, chunkSize - 1, chunkSize, chunkSize + 1, 3*chunkSize + 5} {
+		plain := bytes.Repeat([]byte("0123456789"), size/10+1)[:size]
+		if err := store.Put("chunks", "file.bin", bytes.NewReader(plain)); err != nil {
+			t.Fatalf("size %d: Put: %v", size, err)
+		}
+
+		f, err := store.Get("chunks", "file.bin")
+		if err != nil {
+			t.Fatalf("size %d: Get: %v", size, err)
+		}
+		got, err := ioutil.ReadAll(f)
+		if err != nil {
+			t.Fatalf("size %d: read: %v", size, err)
+		}
+		if !bytes.Equal(got, plain) {
+			t.Errorf("size %d: read %d bytes differing from the plaintext", size, len(got))
+		}
+
+		info, err := store.Stat("chunks", "file.bin")
+		if err != nil {
+			t.Fatalf("size %d: Stat: %v", size, err)
+		}
+		sum := md5.Sum(plain)
+		if info.Size != int64(size) || info.Checksum != hex.EncodeToString(sum[:]) {
+			t.Errorf("size %d: Stat size %d checksum %s, want the plaintext ones", size, info.Size, info.Checksum)
+		}
+		if len(info.Metadata) != 0 {
+			t.Errorf("size %d: Stat leaks metadata %v", size, info.Metadata)
+		}
+	}
+}
+
+func TestEncryptedChunksTampered(t *testing.T) {
+	store, mem := encryptedMemory(t)
+
+	plain := bytes.Repeat([]byte{1}, 2*chunkSize+5)
+	if err := store.Put("chunks", "file.bin", bytes.NewReader(plain)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	info, err := mem.Stat("chunks", "file.bin")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	sealed := mustReadAll(t, mem, "chunks", "file.bin")
+	segment := chunkSize + 16
+
+	swapped := append(append(append([]byte{}, sealed[segment:2*segment]...), sealed[:segment]...), sealed[2*segment:]...)
+	flipped := append([]byte{}, sealed...)
+	flipped[10] ^= 1
+
+	for name, content := range map[string][]byte{
+		"last chunk dropped": sealed[:2*segment],
+		"chunks swapped":     swapped,
+		"byte flipped":       flipped,
+		"cut mid chunk":      sealed[:segment+100],
+	} {
+		if err := mem.PutWithMetadata("chunks", "tampered.bin", bytes.NewReader(content), info.Metadata); err != nil {
+			t.Fatalf("%s: PutWithMetadata: %v", name, err)
+		}
+		f, err := store.Get("chunks", "tampered.bin")
+		if err != nil {
+			t.Fatalf("%s: Get: %v", name, err)
+		}
+		if _, err := ioutil.ReadAll(f); err != ErrCorruptedFile {
+			t.Errorf("%s: read error %v, want %v", name, err, ErrCorruptedFile)
+		}
+	}
+}
+
+func TestEncryptedSealedWhole(t *testing.T) {
+	store, mem := encryptedMemory(t)
+
+	// objects stored before chunking hold a single sealed plaintext
+	dataKey := bytes.Repeat([]byte{9}, 32)
+	data, err := newGCM(dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := seal(data, []byte("sealed whole"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrapped, err := seal(store.master, dataKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := map[string]string{encryptionKeyMetadata: base64.StdEncoding.EncodeToString(wrapped)}
+	if err := mem.PutWithMetadata("chunks", "old.txt", bytes.NewReader(sealed), metadata); err != nil {
+		t.Fatalf("PutWithMetadata: %v", err)
+	}
+
+	if got := mustReadAll(t, store, "chunks", "old.txt"); string(got) != "sealed whole" {
+		t.Errorf("read %q, want %q", got, "sealed whole")
+	}
+}
+
+func mustReadAll(t *testing.T, store StorageInterface, filePrefix, filename string) []byte {
+	t.Helper()
+
+	f, err := store.Get(filePrefix, filename)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("read: %v", err)
+	}
+	return b
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+
+	"github.com/disintegration/imaging"
+)
+
+// Variant is a resized copy generated for every image put into ImageStorage
+type Variant struct {
+	Name   string
+	Width  int
+	Height int
+	Crop   bool
+}
+
+// Variants generated alongside each stored image
+var Variants = []Variant{
+	{Name: "thumbnail", Width: 150, Height: 150, Crop: true},
+	{Name: "medium", Width: 800, Height: 800},
+}
+
+// MaxImagePixels limits width times height of images decoded by
+// ImageStorage, so a small file cannot expand into gigabytes of pixels
+var MaxImagePixels = 50 * 1000 * 1000
+
+var (
+	// ErrImageTooLarge is returned for an image exceeding MaxImagePixels
+	ErrImageTooLarge = errors.New("image dimensions too large")
+	// ErrUnknownVariant is returned for a variant missing from Variants
+	ErrUnknownVariant = errors.New("unknown image variant")
+)
+
+var imageFormats = map[string]imaging.Format{
+	".jpg":  imaging.JPEG,
+	".jpeg": imaging.JPEG,
+	".png":  imaging.PNG,
+}
+
+// ImageStorage wraps a StorageInterface so stored images are re-encoded
+// upright without EXIF data (which may carry GPS location), and resized
+// Variants are stored next to them under VariantName
+type ImageStorage struct {
+	StorageInterface
+}
+
+// NewImageStorage returns store wrapped with the image pipeline
+func NewImageStorage(store StorageInterface) StorageInterface {
+	return ImageStorage{StorageInterface: store}
+}
+
+// VariantName returns filename of given variant of an image
+func VariantName(filename string, variant string) string {
+	ext := filepath.Ext(filename)
+	return strings.TrimSuffix(filename, ext) + "_" + variant + ext
+}
+
+// GetVariantPath returns the URL of given variant of an image put through
+// ImageStorage into store
+func GetVariantPath(store StorageInterface, filePrefix string, filename string, variant string) (string, error) {
+	if !IsVariant(variant) {
+		return "", ErrUnknownVariant
+	}
+	if filename == "" {
+		return store.GetPath(filePrefix, filename)
+	}
+	if !IsImage(filename) {
+		return "", ErrUnknownVariant
+	}
+	return store.GetPath(filePrefix, VariantName(filename, variant))
+}
+
+// IsVariant reports whether name is one of Variants
+func IsVariant(name string) bool {
+	for _, v := range Variants {
+		if v.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// IsImage reports whether filename is processed by ImageStorage
+func IsImage(filename string) bool {
+	_, ok := imageFormats[strings.ToLower(filepath.Ext(filename))]
+	return ok
+}
+
+func (s ImageStorage) Put(filePrefix string, filename string, file io.Reader) error {
+	return s.PutWithMetadata(filePrefix, filename, file, nil)
+}
+
+func (s ImageStorage) PutWithMetadata(filePrefix string, filename string, file io.Reader, metadata map[string]string) error {
+	format, ok := imageFormats[strings.ToLower(filepath.Ext(filename))]
+	if !ok {
+		return s.StorageInterface.PutWithMetadata(filePrefix, filename, file, metadata)
+	}
+
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	// check dimensions from the header before allocating any pixel
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || int64(cfg.Width)*int64(cfg.Height) > int64(MaxImagePixels) {
+		return ErrImageTooLarge
+	}
+
+	img, err := imaging.Decode(bytes.NewReader(content), imaging.AutoOrientation(true))
+	if err != nil {
+		return err
+	}
+
+	if err := s.putImage(filePrefix, filename, img, format, metadata); err != nil {
+		return err
+	}
+
+	for _, v := range Variants {
+		var resized image.Image
+		if v.Crop {
+			resized = imaging.Fill(img, v.Width, v.Height, imaging.Center, imaging.Lanczos)
+		} else {
+			resized = imaging.Fit(img, v.Width, v.Height, imaging.Lanczos)
+		}
+
+		if err := s.putImage(filePrefix, VariantName(filename, v.Name), resized, format, metadata); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s ImageStorage) Delete(filePrefix string, filename string) error {
+	if err := s.StorageInterface.Delete(filePrefix, filename); err != nil {
+		return err
+	}
+
+	if !IsImage(filename) {
+		return nil
+	}
+
+	for _, v := range Variants {
+		if err := s.StorageInterface.Delete(filePrefix, VariantName(filename, v.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s ImageStorage) Copy(srcPrefix string, srcFilename string, dstPrefix string, dstFilename string) error {
+	if err := s.StorageInterface.Copy(srcPrefix, srcFilename, dstPrefix, dstFilename); err != nil {
+		return err
+	}
+
+	if !IsImage(srcFilename) {
+		return nil
+	}
+
+	for _, v := range Variants {
+		if err := s.StorageInterface.Copy(srcPrefix, VariantName(srcFilename, v.Name), dstPrefix, VariantName(dstFilename, v.Name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s ImageStorage) putImage(filePrefix string, filename string, img image.Image, format imaging.Format, metadata map[string]string) error {
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, img, format, imaging.JPEGQuality(85)); err != nil {
+		return err
+	}
+
+	return s.StorageInterface.PutWithMetadata(filePrefix, filename, &buf, metadata)
+}
@@ -0,0 +1,84 @@
+package storage_test
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/storage"
+)
+
+func pngOf(t *testing.T, width, height int) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatalf("png.Encode: %v", err)
+	}
+	return &buf
+}
+
+func TestImageStorageVariants(t *testing.T) {
+	mem, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	store := storage.NewImageStorage(mem)
+
+	if err := store.Put("profiles/1", "photo.png", pngOf(t, 1000, 500)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	sizes := map[string]image.Point{"thumbnail": {150, 150}, "medium": {800, 400}}
+	for variant, want := range sizes {
+		r, err := store.Get("profiles/1", storage.VariantName("photo.png", variant))
+		if err != nil {
+			t.Fatalf("Get %s: %v", variant, err)
+		}
+		cfg, _, err := image.DecodeConfig(r)
+		if err != nil {
+			t.Fatalf("DecodeConfig %s: %v", variant, err)
+		}
+		if cfg.Width != want.X || cfg.Height != want.Y {
+			t.Errorf("%s is %dx%d, want %dx%d", variant, cfg.Width, cfg.Height, want.X, want.Y)
+		}
+
+		p, err := storage.GetVariantPath(store, "profiles/1", "photo.png", variant)
+		if err != nil {
+			t.Fatalf("GetVariantPath %s: %v", variant, err)
+		}
+		if !strings.HasSuffix(p, "profiles/1/photo_"+variant+".png") {
+			t.Errorf("GetVariantPath %s = %q", variant, p)
+		}
+	}
+
+	if _, err := storage.GetVariantPath(store, "profiles/1", "photo.png", "huge"); err != storage.ErrUnknownVariant {
+		t.Errorf("GetVariantPath of unknown variant error = %v, want %v", err, storage.ErrUnknownVariant)
+	}
+	if _, err := storage.GetVariantPath(store, "profiles/1", "notes.txt", "thumbnail"); err != storage.ErrUnknownVariant {
+		t.Errorf("GetVariantPath of non image error = %v, want %v", err, storage.ErrUnknownVariant)
+	}
+}
+
+func TestImageStorageRejectsOversizedImage(t *testing.T) {
+	defer func(max int) { storage.MaxImagePixels = max }(storage.MaxImagePixels)
+	storage.MaxImagePixels = 100 * 100
+
+	mem, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	store := storage.NewImageStorage(mem)
+
+	if err := store.Put("profiles/1", "bomb.png", pngOf(t, 101, 100)); err != storage.ErrImageTooLarge {
+		t.Errorf("Put error = %v, want %v", err, storage.ErrImageTooLarge)
+	}
+	if _, err := store.Get("profiles/1", "bomb.png"); err != storage.ErrFileNotFound {
+		t.Errorf("Get of rejected image error = %v, want %v", err, storage.ErrFileNotFound)
+	}
+	if err := store.Put("profiles/1", "fits.png", pngOf(t, 100, 100)); err != nil {
+		t.Errorf("Put of image within limit: %v", err)
+	}
+}
@@ -1,71 +1,304 @@
 package storage
 
 import (
-	"errors"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"mime"
 	"os"
+	"path"
 	"path/filepath"
+	"time"
 )
 
+// localMetadataDir keeps user metadata and checksums of files, skipped by List
+const localMetadataDir = ".metadata"
+
 type Local struct {
 	directory string
 	host      string
+	signer    URLSigner
 }
 
 func InitLocal() (StorageInterface, error) {
-	directory := fmt.Sprintf("%s/%s/upload", os.Getenv("GOPATH"), os.Getenv("BASE_PROJ_DIR"))
+	directory := os.Getenv("LOCAL_STORAGE_DIR")
+	if directory == "" {
+		directory = fmt.Sprintf("%s/%s/upload", os.Getenv("GOPATH"), os.Getenv("BASE_PROJ_DIR"))
+	}
 	host := os.Getenv("HOST")
 
 	os.MkdirAll(directory, os.ModePerm)
 
-	return Local{directory: directory, host: host}, nil
+	return Local{directory: directory, host: host, signer: NewURLSigner(host)}, nil
 }
 
 func (local Local) GetPath(filePrefix string, filename string) (string, error) {
 	if filename == "" {
-		return "", errors.New("file not found")
+		return "", nil
+	}
+
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
 	}
-	path := filepath.Join(local.host, "upload", filename)
 
-	return path, nil
+	return fmt.Sprintf("%s/%s", local.host, path.Join("upload", name)), nil
 }
 
 func (local Local) Get(filePrefix string, filename string) (io.Reader, error) {
-	if filename == "" {
-		return nil, errors.New("file not found")
+	p, err := local.path(filePrefix, filename)
+	if err != nil {
+		return nil, err
 	}
-	path := filepath.Join(local.directory, filename)
 
-	return os.Open(path)
+	f, err := os.Open(p)
+	if os.IsNotExist(err) {
+		return nil, ErrFileNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
 }
 
 func (local Local) Delete(filePrefix string, filename string) error {
-	if filename == "" {
-		return errors.New("file not found")
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return err
 	}
-	path := filepath.Join(local.directory, filename)
 
-	return os.RemoveAll(path)
+	os.Remove(local.metadataFile(name))
+	os.Remove(local.checksumFile(name))
+	if err := os.Remove(filepath.Join(local.directory, filepath.FromSlash(name))); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
 }
 
 func (local Local) Put(filePrefix string, filename string, file io.Reader) error {
-	path := filepath.Join(local.directory, filename)
-	os.MkdirAll(filepath.Dir(path), os.ModePerm)
+	return local.PutWithMetadata(filePrefix, filename, file, nil)
+}
 
-	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE, 0666)
+// write stores file along with its checksum, computed while it is written
+// so Stat and List never read contents
+func (local Local) write(filePrefix string, filename string, file io.Reader) error {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return err
+	}
+	p := filepath.Join(local.directory, filepath.FromSlash(name))
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+
+	f, err := os.OpenFile(p, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
 	if err != nil {
 		return err
 	}
 	defer f.Close()
-	io.Copy(f, file)
 
-	if fileInfo, err := os.Stat(path); fileInfo.Size() > 10000000 {
+	h := md5.New()
+	if _, err := io.Copy(f, io.TeeReader(file, h)); err != nil {
+		os.Remove(p)
+		return err
+	}
+	return local.writeChecksum(name, hex.EncodeToString(h.Sum(nil)))
+}
+
+func (local Local) writeChecksum(name string, checksum string) error {
+	p := local.checksumFile(name)
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	return ioutil.WriteFile(p, []byte(checksum), 0666)
+}
+
+// path returns location of given file inside local.directory
+func (local Local) path(filePrefix string, filename string) (string, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(local.directory, filepath.FromSlash(name)), nil
+}
+
+func (local Local) PresignedGetURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	return local.signer.Sign("GET", name, expiry), nil
+}
+
+func (local Local) PresignedPutURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	return local.signer.Sign("PUT", name, expiry), nil
+}
+
+func (local Local) PutWithMetadata(filePrefix string, filename string, file io.Reader, metadata map[string]string) error {
+	if err := local.write(filePrefix, filename, file); err != nil {
+		return err
+	}
+
+	p, err := local.metadataPath(filePrefix, filename)
+	if err != nil {
+		return err
+	}
+
+	if len(metadata) == 0 {
+		os.Remove(p)
+		return nil
+	}
+
+	b, err := json.Marshal(normalizeMetadata(metadata))
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(p), os.ModePerm)
+	return ioutil.WriteFile(p, b, 0666)
+}
+
+func (local Local) Stat(filePrefix string, filename string) (FileInfo, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	return local.stat(name)
+}
+
+func (local Local) List(filePrefix string, marker string, limit int) ([]FileInfo, string, error) {
+	if err := validPrefix(filePrefix); err != nil {
+		return nil, "", err
+	}
+
+	prefix := listPrefix(filePrefix)
+	root := filepath.Join(local.directory, filepath.FromSlash(prefix))
+	metaDir := filepath.Join(local.directory, localMetadataDir)
+
+	infos := []FileInfo{}
+	err := filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
 		if err != nil {
-			return errors.New("file not found")
+			return err
+		}
+		if fi.IsDir() {
+			if p == metaDir {
+				return filepath.SkipDir
+			}
+			return nil
 		}
-		defer local.Delete(filePrefix, filename)
-		return errors.New("file too large")
+
+		rel, err := filepath.Rel(local.directory, p)
+		if err != nil {
+			return err
+		}
+		if name := filepath.ToSlash(rel); name > marker {
+			infos = append(infos, FileInfo{Name: name})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
 	}
-	return nil
+
+	// only files of the page are described
+	infos, next := paginate(infos, marker, limit)
+	for i := range infos {
+		if infos[i], err = local.stat(infos[i].Name); err != nil {
+			return nil, "", err
+		}
+	}
+	return infos, next, nil
+}
+
+func (local Local) Copy(srcPrefix string, srcFilename string, dstPrefix string, dstFilename string) error {
+	info, err := local.Stat(srcPrefix, srcFilename)
+	if err != nil {
+		return err
+	}
+
+	f, err := local.Get(srcPrefix, srcFilename)
+	if err != nil {
+		return err
+	}
+	defer f.(io.Closer).Close()
+
+	return local.PutWithMetadata(dstPrefix, dstFilename, f, info.Metadata)
+}
+
+func (local Local) stat(name string) (FileInfo, error) {
+	p := filepath.Join(local.directory, filepath.FromSlash(name))
+
+	fi, err := os.Stat(p)
+	if os.IsNotExist(err) {
+		return FileInfo{}, ErrFileNotFound
+	}
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	checksum, err := local.checksum(name)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	info := FileInfo{
+		Name:        name,
+		Size:        fi.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(name)),
+		ModTime:     fi.ModTime(),
+		Checksum:    checksum,
+	}
+
+	if b, err := ioutil.ReadFile(local.metadataFile(name)); err == nil {
+		json.Unmarshal(b, &info.Metadata)
+	}
+	return info, nil
+}
+
+// metadataPath returns location of the metadata kept for given file
+func (local Local) metadataPath(filePrefix string, filename string) (string, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	return local.metadataFile(name), nil
+}
+
+func (local Local) metadataFile(name string) string {
+	return filepath.Join(local.directory, localMetadataDir, filepath.FromSlash(name)+".json")
+}
+
+func (local Local) checksumFile(name string) string {
+	return filepath.Join(local.directory, localMetadataDir, filepath.FromSlash(name)+".md5")
+}
+
+// checksum returns the checksum kept for given file. Files written before
+// checksums were kept get theirs computed once.
+func (local Local) checksum(name string) (string, error) {
+	if b, err := ioutil.ReadFile(local.checksumFile(name)); err == nil {
+		return string(b), nil
+	}
+
+	f, err := os.Open(filepath.Join(local.directory, filepath.FromSlash(name)))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := md5.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	checksum := hex.EncodeToString(h.Sum(nil))
+	return checksum, local.writeChecksum(name, checksum)
 }
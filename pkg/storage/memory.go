@@ -0,0 +1,185 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Memory keeps files in process memory, for tests and local runs
+type Memory struct {
+	mu     *sync.RWMutex
+	files  map[string]memoryFile
+	host   string
+	signer URLSigner
+}
+
+type memoryFile struct {
+	data     []byte
+	metadata map[string]string
+	modTime  time.Time
+}
+
+func InitMemory() (StorageInterface, error) {
+	host := os.Getenv("HOST")
+	return Memory{mu: &sync.RWMutex{}, files: map[string]memoryFile{}, host: host, signer: NewURLSigner(host)}, nil
+}
+
+func (mem Memory) GetPath(filePrefix string, filename string) (string, error) {
+	if filename == "" {
+		return "", nil
+	}
+
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s/%s", mem.host, path.Join("memory", name)), nil
+}
+
+func (mem Memory) Get(filePrefix string, filename string) (io.Reader, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	f, ok := mem.files[name]
+	if !ok {
+		return nil, ErrFileNotFound
+	}
+	return bytes.NewReader(f.data), nil
+}
+
+func (mem Memory) Delete(filePrefix string, filename string) error {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return err
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	delete(mem.files, name)
+	return nil
+}
+
+func (mem Memory) Put(filePrefix string, filename string, file io.Reader) error {
+	return mem.PutWithMetadata(filePrefix, filename, file, nil)
+}
+
+func (mem Memory) PutWithMetadata(filePrefix string, filename string, file io.Reader, metadata map[string]string) error {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return err
+	}
+
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		return err
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	mem.files[name] = memoryFile{data: b, metadata: normalizeMetadata(metadata), modTime: time.Now()}
+	return nil
+}
+
+func (mem Memory) PresignedGetURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	return mem.signer.Sign("GET", name, expiry), nil
+}
+
+func (mem Memory) PresignedPutURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return "", err
+	}
+
+	return mem.signer.Sign("PUT", name, expiry), nil
+}
+
+func (mem Memory) Stat(filePrefix string, filename string) (FileInfo, error) {
+	name, err := objectName(filePrefix, filename)
+	if err != nil {
+		return FileInfo{}, err
+	}
+
+	mem.mu.RLock()
+	defer mem.mu.RUnlock()
+
+	f, ok := mem.files[name]
+	if !ok {
+		return FileInfo{}, ErrFileNotFound
+	}
+	return f.info(name), nil
+}
+
+func (mem Memory) List(filePrefix string, marker string, limit int) ([]FileInfo, string, error) {
+	if err := validPrefix(filePrefix); err != nil {
+		return nil, "", err
+	}
+	prefix := listPrefix(filePrefix)
+
+	mem.mu.RLock()
+	infos := []FileInfo{}
+	for name, f := range mem.files {
+		if strings.HasPrefix(name, prefix) {
+			infos = append(infos, f.info(name))
+		}
+	}
+	mem.mu.RUnlock()
+
+	infos, next := paginate(infos, marker, limit)
+	return infos, next, nil
+}
+
+func (mem Memory) Copy(srcPrefix string, srcFilename string, dstPrefix string, dstFilename string) error {
+	src, err := objectName(srcPrefix, srcFilename)
+	if err != nil {
+		return err
+	}
+	dst, err := objectName(dstPrefix, dstFilename)
+	if err != nil {
+		return err
+	}
+
+	mem.mu.Lock()
+	defer mem.mu.Unlock()
+
+	f, ok := mem.files[src]
+	if !ok {
+		return ErrFileNotFound
+	}
+	mem.files[dst] = memoryFile{data: f.data, metadata: normalizeMetadata(f.metadata), modTime: time.Now()}
+	return nil
+}
+
+func (f memoryFile) info(name string) FileInfo {
+	sum := md5.Sum(f.data)
+	return FileInfo{
+		Name:        name,
+		Size:        int64(len(f.data)),
+		ContentType: mime.TypeByExtension(path.Ext(name)),
+		ModTime:     f.modTime,
+		Checksum:    hex.EncodeToString(sum[:]),
+		Metadata:    normalizeMetadata(f.metadata),
+	}
+}
@@ -0,0 +1,118 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignedPathPrefix is where the app serves URLs signed by URLSigner
+const SignedPathPrefix = "/_storage/"
+
+// ErrInvalidSignature is returned when a signed URL is forged or expired
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// URLSigner signs local URLs with HMAC so Local and Memory can hand out
+// presigned URLs served by the app itself
+type URLSigner struct {
+	key  []byte
+	host string
+}
+
+// NewURLSigner returns URLSigner keyed with STORAGE_SIGNING_KEY
+func NewURLSigner(host string) URLSigner {
+	return URLSigner{key: []byte(os.Getenv("STORAGE_SIGNING_KEY")), host: host}
+}
+
+// Sign returns a URL allowing given method on object name until expiry passes
+func (s URLSigner) Sign(method string, name string, expiry time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(expiry).Unix(), 10)
+
+	q := url.Values{}
+	q.Set("expires", expires)
+	q.Set("signature", s.signature(method, name, expires))
+
+	return fmt.Sprintf("%s%s?%s", s.host, path.Join(SignedPathPrefix, name), q.Encode())
+}
+
+// Verify checks signature and expiry of a signed request for object name
+func (s URLSigner) Verify(method string, name string, q url.Values) error {
+	if len(s.key) == 0 {
+		return ErrInvalidSignature
+	}
+
+	expires := q.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+
+	want := s.signature(method, name, expires)
+	if !hmac.Equal([]byte(want), []byte(q.Get("signature"))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (s URLSigner) signature(method string, name string, expires string) string {
+	mac := hmac.New(sha256.New, s.key)
+	io.WriteString(mac, strings.Join([]string{method, name, expires}, "\n"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedHandler serves GET and PUT requests to URLs signed by signer against
+// store, rejecting PUT bodies larger than maxPutSize
+func SignedHandler(store StorageInterface, signer URLSigner, maxPutSize int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, SignedPathPrefix)
+		if err := signer.Verify(r.Method, name, r.URL.Query()); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			f, err := store.Get("", name)
+			if err == ErrFileNotFound {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			if c, ok := f.(io.Closer); ok {
+				defer c.Close()
+			}
+			io.Copy(w, f)
+		case http.MethodPut:
+			if r.ContentLength > maxPutSize {
+				http.Error(w, ErrFileTooLarge.Error(), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err := store.Put("", name, http.MaxBytesReader(w, r.Body, maxPutSize)); err != nil {
+				var tooLarge *http.MaxBytesError
+				if errors.As(err, &tooLarge) {
+					store.Delete("", name)
+					http.Error(w, ErrFileTooLarge.Error(), http.StatusRequestEntityTooLarge)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusOK)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	})
+}
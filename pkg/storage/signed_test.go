@@ -0,0 +1,83 @@
+package storage_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/storage"
+)
+
+func TestSignedHandler(t *testing.T) {
+	t.Setenv("STORAGE_SIGNING_KEY", "signing-key")
+
+	store, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	handler := storage.SignedHandler(store, storage.NewURLSigner(""), 8)
+
+	putURL, err := store.PresignedPutURL("profiles/1", "photo.txt", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignedPutURL: %v", err)
+	}
+	getURL, err := store.PresignedGetURL("profiles/1", "photo.txt", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignedGetURL: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, putURL, strings.NewReader("small")))
+	if w.Code != http.StatusOK {
+		t.Fatalf("PUT status = %d, want %d: %s", w.Code, http.StatusOK, w.Body)
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, getURL, nil))
+	if body, _ := ioutil.ReadAll(w.Body); string(body) != "small" {
+		t.Errorf("GET body = %q, want %q", body, "small")
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, putURL, nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("GET with PUT signature status = %d, want %d", w.Code, http.StatusForbidden)
+	}
+}
+
+func TestSignedHandlerLimitsPutSize(t *testing.T) {
+	t.Setenv("STORAGE_SIGNING_KEY", "signing-key")
+
+	store, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	handler := storage.SignedHandler(store, storage.NewURLSigner(""), 8)
+
+	putURL, err := store.PresignedPutURL("profiles/1", "large.txt", time.Minute)
+	if err != nil {
+		t.Fatalf("PresignedPutURL: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPut, putURL, strings.NewReader("far too large")))
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("PUT with Content-Length status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	// a chunked body has no Content-Length to check up front
+	req := httptest.NewRequest(http.MethodPut, putURL, ioutil.NopCloser(strings.NewReader("far too large")))
+	req.ContentLength = -1
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("chunked PUT status = %d, want %d", w.Code, http.StatusRequestEntityTooLarge)
+	}
+
+	if _, err := store.Get("profiles/1", "large.txt"); err != storage.ErrFileNotFound {
+		t.Errorf("Get of rejected upload error = %v, want %v", err, storage.ErrFileNotFound)
+	}
+}
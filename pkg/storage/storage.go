@@ -1,12 +1,165 @@
 package storage
 
 import (
+	"errors"
 	"io"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrFileNotFound is returned when a file is missing or filename is empty
+	ErrFileNotFound = errors.New("file not found")
+	// ErrFileTooLarge is returned when a file exceeds the size limit of its purpose
+	ErrFileTooLarge = errors.New("file too large")
+	// ErrInvalidPath is returned when a prefix or filename escapes its directory
+	ErrInvalidPath = errors.New("invalid file path")
+	// ErrUnknownDriver is returned by InitDriver for an unsupported driver
+	ErrUnknownDriver = errors.New("unknown storage driver")
+	// ErrMissingMasterKey is returned by NewEncryptedStorage without master key
+	ErrMissingMasterKey = errors.New("DOCUMENT_MASTER_KEY is not set, generate one with: openssl rand -base64 32")
+)
+
+// Storage drivers accepted by InitDriver
+const (
+	DriverLocal  = "local"
+	DriverMemory = "memory"
+	DriverS3     = "s3"
 )
 
 type StorageInterface interface {
 	Get(string, string) (io.Reader, error)
 	GetPath(string, string) (string, error)
 	Put(string, string, io.Reader) error
+	PutWithMetadata(string, string, io.Reader, map[string]string) error
 	Delete(string, string) error
+	Stat(string, string) (FileInfo, error)
+	List(string, string, int) ([]FileInfo, string, error)
+	Copy(string, string, string, string) error
+	PresignedGetURL(string, string, time.Duration) (string, error)
+	PresignedPutURL(string, string, time.Duration) (string, error)
+}
+
+// FileInfo describes a stored file
+type FileInfo struct {
+	// Name is the full object name, filePrefix included
+	Name        string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+	// Checksum is the hex MD5 of the content, or the ETag of multipart S3 objects
+	Checksum string
+	Metadata map[string]string
+}
+
+// InitDriver returns the storage backend of given driver. Public and private
+// storage should share one backend, wrapped with NewImageStorage and
+// NewPrivateStorage, so its connections and CDN probes are started once.
+func InitDriver(driver string) (StorageInterface, error) {
+	switch driver {
+	case DriverLocal:
+		return InitLocal()
+	case DriverMemory:
+		return InitMemory()
+	case DriverS3:
+		return InitAWS2()
+	}
+	return nil, ErrUnknownDriver
+}
+
+// NewPrivateStorage returns store without public read access. Objects are
+// not encrypted and can be streamed, wrap it with NewEncryptedStorage for
+// sensitive documents.
+func NewPrivateStorage(store StorageInterface) StorageInterface {
+	if p, ok := store.(interface{ Private() StorageInterface }); ok {
+		store = p.Private()
+	}
+	return PrivateStorage{StorageInterface: store}
+}
+
+// PrivateStorage wraps a StorageInterface whose objects have no public URL
+// and must be streamed through the app
+type PrivateStorage struct {
+	StorageInterface
+}
+
+func (s PrivateStorage) GetPath(filePrefix string, filename string) (string, error) {
+	return "", ErrPrivateFile
+}
+
+func (s PrivateStorage) PresignedGetURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	return "", ErrPrivateFile
+}
+
+func (s PrivateStorage) PresignedPutURL(filePrefix string, filename string, expiry time.Duration) (string, error) {
+	return "", ErrPrivateFile
+}
+
+// objectName joins filePrefix and filename into a slash separated object
+// name, rejecting absolute paths and any ".." segment
+func objectName(filePrefix string, filename string) (string, error) {
+	if filename == "" {
+		return "", ErrFileNotFound
+	}
+
+	for _, p := range []string{filePrefix, filename} {
+		p = strings.Replace(p, "\\", "/", -1)
+		if strings.HasPrefix(p, "/") {
+			return "", ErrInvalidPath
+		}
+		for _, segment := range strings.Split(p, "/") {
+			if segment == ".." {
+				return "", ErrInvalidPath
+			}
+		}
+	}
+
+	return path.Join(filePrefix, filename), nil
+}
+
+// validPrefix checks filePrefix does not escape its directory
+func validPrefix(filePrefix string) error {
+	if filePrefix == "" {
+		return nil
+	}
+	_, err := objectName(filePrefix, "_")
+	return err
+}
+
+// listPrefix returns filePrefix as a directory-like object name prefix
+func listPrefix(filePrefix string) string {
+	if filePrefix == "" {
+		return ""
+	}
+	return strings.TrimSuffix(filePrefix, "/") + "/"
+}
+
+// paginate sorts infos by name and returns at most limit of them after
+// marker, along with the marker of the next page ("" on the last page)
+func paginate(infos []FileInfo, marker string, limit int) ([]FileInfo, string) {
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+
+	start := sort.Search(len(infos), func(i int) bool { return infos[i].Name > marker })
+	infos = infos[start:]
+
+	if limit <= 0 || len(infos) <= limit {
+		return infos, ""
+	}
+	return infos[:limit], infos[limit-1].Name
+}
+
+// normalizeMetadata returns a copy of metadata with lower cased keys, the
+// way S3 returns user metadata
+func normalizeMetadata(metadata map[string]string) map[string]string {
+	if len(metadata) == 0 {
+		return nil
+	}
+
+	c := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		c[strings.ToLower(k)] = v
+	}
+	return c
 }
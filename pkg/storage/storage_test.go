@@ -0,0 +1,243 @@
+package storage_test
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/storage/storagetest"
+)
+
+func TestLocal(t *testing.T) {
+	t.Setenv("LOCAL_STORAGE_DIR", t.TempDir())
+
+	store, err := storage.InitLocal()
+	if err != nil {
+		t.Fatalf("InitLocal: %v", err)
+	}
+	storagetest.Run(t, store)
+}
+
+func TestMemory(t *testing.T) {
+	store, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	storagetest.Run(t, store)
+}
+
+func TestImageStorage(t *testing.T) {
+	store, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	storagetest.Run(t, storage.NewImageStorage(store))
+}
+
+// TestAWS2 runs against the empty bucket named by RIAKCS_TEST_BUCKET,
+// reached with the other RIAKCS_* settings
+func TestAWS2(t *testing.T) {
+	bucket := os.Getenv("RIAKCS_TEST_BUCKET")
+	if bucket == "" {
+		t.Skip("RIAKCS_TEST_BUCKET is not set")
+	}
+	t.Setenv("RIAKCS_BUCKET", bucket)
+
+	store, err := storage.InitAWS2()
+	if err != nil {
+		t.Fatalf("InitAWS2: %v", err)
+	}
+	storagetest.Run(t, store)
+}
+
+func TestPrivateStorage(t *testing.T) {
+	mem, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	storagetest.RunPrivate(t, storage.NewPrivateStorage(mem))
+}
+
+func TestEncryptedStorage(t *testing.T) {
+	mem, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	store, err := storage.NewEncryptedStorage(storage.NewPrivateStorage(mem), base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{7}, 32)))
+	if err != nil {
+		t.Fatalf("NewEncryptedStorage: %v", err)
+	}
+	storagetest.RunPrivate(t, store)
+}
+
+func TestLocalChecksum(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("LOCAL_STORAGE_DIR", dir)
+
+	store, err := storage.InitLocal()
+	if err != nil {
+		t.Fatalf("InitLocal: %v", err)
+	}
+
+	sum := md5.Sum([]byte("written"))
+	if err := store.Put("files", "put.txt", strings.NewReader("written")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	// Stat reports the checksum kept on Put without reading the file
+	if err := ioutil.WriteFile(filepath.Join(dir, "files", "put.txt"), []byte("changed"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	info, err := store.Stat("files", "put.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("checksum %s, want the one kept on Put %x", info.Checksum, sum)
+	}
+
+	// files written before checksums were kept get theirs computed
+	legacy := md5.Sum([]byte("legacy"))
+	if err := ioutil.WriteFile(filepath.Join(dir, "files", "legacy.txt"), []byte("legacy"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	infos, _, err := store.List("files", "", 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(infos) != 2 || infos[0].Name != "files/legacy.txt" || infos[0].Checksum != hex.EncodeToString(legacy[:]) {
+		t.Errorf("List = %+v, want files/legacy.txt with checksum %x first", infos, legacy)
+	}
+}
+
+func TestLocalDeleteKeepsDirectories(t *testing.T) {
+	t.Setenv("LOCAL_STORAGE_DIR", t.TempDir())
+
+	store, err := storage.InitLocal()
+	if err != nil {
+		t.Fatalf("InitLocal: %v", err)
+	}
+	if err := store.Put("profiles/1", "photo.jpg", strings.NewReader("photo")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	// a file name naming a directory must not delete what is inside
+	store.Delete("profiles", "1")
+	if _, err := store.Stat("profiles/1", "photo.jpg"); err != nil {
+		t.Errorf("Stat after deleting its directory: %v", err)
+	}
+	if err := store.Delete("profiles/1", "missing.jpg"); err != nil {
+		t.Errorf("Delete of a missing file: %v", err)
+	}
+}
+
+// fakeS3 lists keys of a bucket with ListObjectsV2, counting keys served
+type fakeS3 struct {
+	keys   []string
+	served int
+}
+
+func (s *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	switch {
+	case r.Method == "HEAD":
+		return
+	case q.Has("location"):
+		fmt.Fprint(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+		return
+	case q.Get("list-type") != "2":
+		http.Error(w, "unexpected request", http.StatusNotImplemented)
+		return
+	}
+
+	after := q.Get("start-after")
+	if token := q.Get("continuation-token"); token != "" {
+		after = token
+	}
+	maxKeys := 1000
+	fmt.Sscan(q.Get("max-keys"), &maxKeys)
+
+	type object struct {
+		Key          string
+		Size         int64
+		ETag         string
+		LastModified string
+	}
+	res := struct {
+		XMLName               xml.Name `xml:"ListBucketResult"`
+		Contents              []object
+		IsTruncated           bool
+		NextContinuationToken string
+	}{}
+	start := sort.SearchStrings(s.keys, after)
+	if start < len(s.keys) && s.keys[start] == after {
+		start++
+	}
+	for _, k := range s.keys[start:] {
+		if strings.HasPrefix(k, q.Get("prefix")) {
+			if len(res.Contents) == maxKeys {
+				res.IsTruncated = true
+				break
+			}
+			res.Contents = append(res.Contents, object{Key: k, Size: 4, ETag: `"etag"`, LastModified: "2026-01-02T03:04:05.000Z"})
+			res.NextContinuationToken = k
+		}
+	}
+	s.served += len(res.Contents)
+	xml.NewEncoder(w).Encode(res)
+}
+
+func TestAWS2ListResumesFromMarker(t *testing.T) {
+	s3 := &fakeS3{}
+	for i := 0; i < 25; i++ {
+		s3.keys = append(s3.keys, fmt.Sprintf("files/%02d", i))
+	}
+	srv := httptest.NewServer(s3)
+	defer srv.Close()
+
+	t.Setenv("RIAKCS_HOST", strings.TrimPrefix(srv.URL, "http://"))
+	t.Setenv("RIAKCS_BUCKET", "bucket")
+	t.Setenv("CDN_HOSTS", "")
+	store, err := storage.InitAWS2()
+	if err != nil {
+		t.Fatalf("InitAWS2: %v", err)
+	}
+
+	listed := []string{}
+	marker := ""
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("List does not end")
+		}
+		infos, next, err := store.List("files", marker, 10)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		for _, info := range infos {
+			listed = append(listed, info.Name)
+		}
+		if next == "" {
+			break
+		}
+		marker = next
+	}
+
+	if strings.Join(listed, ",") != strings.Join(s3.keys, ",") {
+		t.Errorf("listed %v, want %v", listed, s3.keys)
+	}
+	// every page starts after the marker instead of listing from the start
+	if s3.served != len(s3.keys) {
+		t.Errorf("S3 served %d keys for %d listed", s3.served, len(s3.keys))
+	}
+}
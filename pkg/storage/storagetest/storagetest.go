@@ -0,0 +1,320 @@
+// Package storagetest implements a conformance suite for storage.StorageInterface.
+// Every implementation should call Run from its own tests.
+package storagetest
+
+import (
+	"bytes"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/storage"
+)
+
+// Run checks store behaves like every other StorageInterface implementation.
+// store must be empty and writable.
+func Run(t *testing.T, store storage.StorageInterface) {
+	run(t, store, false)
+}
+
+// RunPrivate checks a store without public URLs, such as EncryptedStorage,
+// whose GetPath and presigned URL methods return storage.ErrPrivateFile.
+// store must be empty and writable.
+func RunPrivate(t *testing.T, store storage.StorageInterface) {
+	run(t, store, true)
+}
+
+func run(t *testing.T, store storage.StorageInterface, private bool) {
+	t.Run("PutGet", func(t *testing.T) { testPutGet(t, store) })
+	t.Run("Overwrite", func(t *testing.T) { testOverwrite(t, store) })
+	t.Run("PrefixIsolation", func(t *testing.T) { testPrefixIsolation(t, store) })
+	t.Run("Delete", func(t *testing.T) { testDelete(t, store) })
+	t.Run("EmptyFilename", func(t *testing.T) { testEmptyFilename(t, store, private) })
+	t.Run("Stat", func(t *testing.T) { testStat(t, store) })
+	t.Run("List", func(t *testing.T) { testList(t, store) })
+	t.Run("Copy", func(t *testing.T) { testCopy(t, store) })
+	t.Run("PathTraversal", func(t *testing.T) { testPathTraversal(t, store, private) })
+	if private {
+		t.Run("PrivateURL", func(t *testing.T) { testPrivateURL(t, store) })
+		return
+	}
+	t.Run("GetPath", func(t *testing.T) { testGetPath(t, store) })
+	t.Run("PresignedURL", func(t *testing.T) { testPresignedURL(t, store) })
+}
+
+func testPutGet(t *testing.T, store storage.StorageInterface) {
+	want := []byte("conformance content")
+	if err := store.Put("conformance", "put-get.txt", bytes.NewReader(want)); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	defer store.Delete("conformance", "put-get.txt")
+
+	got := mustRead(t, store, "conformance", "put-get.txt")
+	if !bytes.Equal(got, want) {
+		t.Errorf("Get = %q, want %q", got, want)
+	}
+}
+
+func testOverwrite(t *testing.T, store storage.StorageInterface) {
+	if err := store.Put("conformance", "overwrite.txt", strings.NewReader("a longer first version")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	defer store.Delete("conformance", "overwrite.txt")
+
+	if err := store.Put("conformance", "overwrite.txt", strings.NewReader("short")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+
+	if got := string(mustRead(t, store, "conformance", "overwrite.txt")); got != "short" {
+		t.Errorf("Get after overwrite = %q, want %q", got, "short")
+	}
+}
+
+func testPrefixIsolation(t *testing.T, store storage.StorageInterface) {
+	if err := store.Put("conformance/a", "same.txt", strings.NewReader("a")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	defer store.Delete("conformance/a", "same.txt")
+
+	if err := store.Put("conformance/b", "same.txt", strings.NewReader("b")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	defer store.Delete("conformance/b", "same.txt")
+
+	if got := string(mustRead(t, store, "conformance/a", "same.txt")); got != "a" {
+		t.Errorf("Get(conformance/a) = %q, want %q", got, "a")
+	}
+	if got := string(mustRead(t, store, "conformance/b", "same.txt")); got != "b" {
+		t.Errorf("Get(conformance/b) = %q, want %q", got, "b")
+	}
+	if _, err := store.Get("", "same.txt"); err == nil {
+		t.Error("Get without prefix found a prefixed file")
+	}
+}
+
+func testDelete(t *testing.T, store storage.StorageInterface) {
+	if err := store.Put("conformance", "delete.txt", strings.NewReader("x")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	if err := store.Delete("conformance", "delete.txt"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Get("conformance", "delete.txt"); err != storage.ErrFileNotFound {
+		t.Errorf("Get after Delete error = %v, want %v", err, storage.ErrFileNotFound)
+	}
+	if err := store.Delete("conformance", "delete.txt"); err != nil {
+		t.Errorf("Delete of missing file = %v, want nil", err)
+	}
+}
+
+func testEmptyFilename(t *testing.T, store storage.StorageInterface, private bool) {
+	if _, err := store.Get("conformance", ""); err != storage.ErrFileNotFound {
+		t.Errorf("Get error = %v, want %v", err, storage.ErrFileNotFound)
+	}
+	if err := store.Delete("conformance", ""); err != storage.ErrFileNotFound {
+		t.Errorf("Delete error = %v, want %v", err, storage.ErrFileNotFound)
+	}
+	if err := store.Put("conformance", "", strings.NewReader("x")); err != storage.ErrFileNotFound {
+		t.Errorf("Put error = %v, want %v", err, storage.ErrFileNotFound)
+	}
+	if private {
+		return
+	}
+	if p, err := store.GetPath("conformance", ""); p != "" || err != nil {
+		t.Errorf("GetPath = %q, %v, want empty path and nil error", p, err)
+	}
+}
+
+func testGetPath(t *testing.T, store storage.StorageInterface) {
+	p, err := store.GetPath("conformance", "photo.jpg")
+	if err != nil {
+		t.Fatalf("GetPath: %v", err)
+	}
+	if !strings.HasSuffix(p, "conformance/photo.jpg") {
+		t.Errorf("GetPath = %q, want suffix %q", p, "conformance/photo.jpg")
+	}
+}
+
+func testStat(t *testing.T, store storage.StorageInterface) {
+	content := "stat content"
+	if err := store.PutWithMetadata("conformance", "stat.txt", strings.NewReader(content), map[string]string{"Uploader": "42"}); err != nil {
+		t.Fatalf("PutWithMetadata: %v", err)
+	}
+	defer store.Delete("conformance", "stat.txt")
+
+	info, err := store.Stat("conformance", "stat.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+
+	sum := md5.Sum([]byte(content))
+	if info.Name != "conformance/stat.txt" {
+		t.Errorf("Name = %q, want %q", info.Name, "conformance/stat.txt")
+	}
+	if info.Size != int64(len(content)) {
+		t.Errorf("Size = %d, want %d", info.Size, len(content))
+	}
+	if !strings.HasPrefix(info.ContentType, "text/plain") {
+		t.Errorf("ContentType = %q, want text/plain", info.ContentType)
+	}
+	if info.ModTime.IsZero() {
+		t.Error("ModTime is zero")
+	}
+	if info.Checksum != hex.EncodeToString(sum[:]) {
+		t.Errorf("Checksum = %q, want %q", info.Checksum, hex.EncodeToString(sum[:]))
+	}
+	if info.Metadata["uploader"] != "42" {
+		t.Errorf("Metadata = %v, want uploader 42", info.Metadata)
+	}
+
+	if _, err := store.Stat("conformance", "missing.txt"); err != storage.ErrFileNotFound {
+		t.Errorf("Stat of missing file error = %v, want %v", err, storage.ErrFileNotFound)
+	}
+}
+
+func testList(t *testing.T, store storage.StorageInterface) {
+	names := []string{"a.txt", "b.txt", "c.txt", "nested/d.txt"}
+	for _, name := range names {
+		if err := store.Put("conformance/list", name, strings.NewReader(name)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		defer store.Delete("conformance/list", name)
+	}
+	if err := store.Put("conformance/listing", "other.txt", strings.NewReader("x")); err != nil {
+		t.Fatalf("Put: %v", err)
+	}
+	defer store.Delete("conformance/listing", "other.txt")
+
+	var got []string
+	marker := ""
+	for i := 0; i < len(names)+1; i++ {
+		infos, next, err := store.List("conformance/list", marker, 3)
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if len(infos) > 3 {
+			t.Fatalf("List returned %d files, want at most 3", len(infos))
+		}
+		for _, info := range infos {
+			got = append(got, info.Name)
+		}
+		if next == "" {
+			break
+		}
+		marker = next
+	}
+
+	want := []string{"conformance/list/a.txt", "conformance/list/b.txt", "conformance/list/c.txt", "conformance/list/nested/d.txt"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("List = %v, want %v", got, want)
+	}
+
+	if _, _, err := store.List("../conformance", "", 10); err != storage.ErrInvalidPath {
+		t.Errorf("List error = %v, want %v", err, storage.ErrInvalidPath)
+	}
+}
+
+func testCopy(t *testing.T, store storage.StorageInterface) {
+	if err := store.PutWithMetadata("conformance", "copy-src.txt", strings.NewReader("copied"), map[string]string{"kind": "letter"}); err != nil {
+		t.Fatalf("PutWithMetadata: %v", err)
+	}
+	defer store.Delete("conformance", "copy-src.txt")
+
+	if err := store.Copy("conformance", "copy-src.txt", "conformance/copies", "copy-dst.txt"); err != nil {
+		t.Fatalf("Copy: %v", err)
+	}
+	defer store.Delete("conformance/copies", "copy-dst.txt")
+
+	if got := string(mustRead(t, store, "conformance/copies", "copy-dst.txt")); got != "copied" {
+		t.Errorf("Get of copy = %q, want %q", got, "copied")
+	}
+	if got := string(mustRead(t, store, "conformance", "copy-src.txt")); got != "copied" {
+		t.Errorf("Get of source = %q, want %q", got, "copied")
+	}
+
+	info, err := store.Stat("conformance/copies", "copy-dst.txt")
+	if err != nil {
+		t.Fatalf("Stat: %v", err)
+	}
+	if info.Metadata["kind"] != "letter" {
+		t.Errorf("Metadata of copy = %v, want kind letter", info.Metadata)
+	}
+
+	if err := store.Copy("conformance", "missing.txt", "conformance", "copy-missing.txt"); err == nil {
+		t.Error("Copy of missing file succeeded")
+	}
+}
+
+func testPresignedURL(t *testing.T, store storage.StorageInterface) {
+	if u, err := store.PresignedGetURL("conformance", "photo.jpg", time.Minute); u == "" || err != nil {
+		t.Errorf("PresignedGetURL = %q, %v, want URL and nil error", u, err)
+	}
+	if u, err := store.PresignedPutURL("conformance", "photo.jpg", time.Minute); u == "" || err != nil {
+		t.Errorf("PresignedPutURL = %q, %v, want URL and nil error", u, err)
+	}
+}
+
+func testPathTraversal(t *testing.T, store storage.StorageInterface, private bool) {
+	cases := []struct{ prefix, filename string }{
+		{"conformance", "../escape.txt"},
+		{"conformance", "a/../../escape.txt"},
+		{"../conformance", "escape.txt"},
+		{"conformance", "/etc/passwd"},
+		{"/conformance", "escape.txt"},
+		{"conformance", "..\\escape.txt"},
+	}
+
+	for _, c := range cases {
+		if err := store.Put(c.prefix, c.filename, strings.NewReader("x")); err != storage.ErrInvalidPath {
+			t.Errorf("Put(%q, %q) error = %v, want %v", c.prefix, c.filename, err, storage.ErrInvalidPath)
+		}
+		if _, err := store.Get(c.prefix, c.filename); err != storage.ErrInvalidPath {
+			t.Errorf("Get(%q, %q) error = %v, want %v", c.prefix, c.filename, err, storage.ErrInvalidPath)
+		}
+		if err := store.Delete(c.prefix, c.filename); err != storage.ErrInvalidPath {
+			t.Errorf("Delete(%q, %q) error = %v, want %v", c.prefix, c.filename, err, storage.ErrInvalidPath)
+		}
+		if private {
+			continue
+		}
+		if _, err := store.GetPath(c.prefix, c.filename); err != storage.ErrInvalidPath {
+			t.Errorf("GetPath(%q, %q) error = %v, want %v", c.prefix, c.filename, err, storage.ErrInvalidPath)
+		}
+		if _, err := store.PresignedPutURL(c.prefix, c.filename, time.Minute); err != storage.ErrInvalidPath {
+			t.Errorf("PresignedPutURL(%q, %q) error = %v, want %v", c.prefix, c.filename, err, storage.ErrInvalidPath)
+		}
+	}
+}
+
+func testPrivateURL(t *testing.T, store storage.StorageInterface) {
+	if p, err := store.GetPath("conformance", "private.pdf"); p != "" || err != storage.ErrPrivateFile {
+		t.Errorf("GetPath = %q, %v, want empty path and %v", p, err, storage.ErrPrivateFile)
+	}
+	if u, err := store.PresignedGetURL("conformance", "private.pdf", time.Minute); u != "" || err != storage.ErrPrivateFile {
+		t.Errorf("PresignedGetURL = %q, %v, want empty URL and %v", u, err, storage.ErrPrivateFile)
+	}
+	if u, err := store.PresignedPutURL("conformance", "private.pdf", time.Minute); u != "" || err != storage.ErrPrivateFile {
+		t.Errorf("PresignedPutURL = %q, %v, want empty URL and %v", u, err, storage.ErrPrivateFile)
+	}
+}
+
+func mustRead(t *testing.T, store storage.StorageInterface, filePrefix, filename string) []byte {
+	r, err := store.Get(filePrefix, filename)
+	if err != nil {
+		t.Fatalf("Get(%q, %q): %v", filePrefix, filename, err)
+	}
+
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read %q: %v", filename, err)
+	}
+	return b
+}
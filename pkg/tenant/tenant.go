@@ -0,0 +1,76 @@
+// Package tenant scopes data to a church branch. The active branch of a
+// request is put into its context by api.newHandle, and every repository
+// query limits its rows to that branch. Contexts never scoped see nothing,
+// background jobs and internal routes seeing every branch are marked with
+// Unscoped.
+package tenant
+
+import (
+	"context"
+	"os"
+	"strconv"
+)
+
+// All is the branch of contexts allowed to see every branch, such as super
+// admins without a chosen branch and background jobs
+const All uint = 0
+
+// None is the branch of contexts never scoped, matching no branch so a
+// forgotten scope fails closed instead of seeing every branch
+const None = ^uint(0)
+
+// Header lets a super admin choose the active branch of a request
+const Header = "GKKKB-Branch-ID"
+
+type key int
+
+// Key is tenant context key
+const Key key = 0
+
+// NewContext returns context scoped to given branch
+func NewContext(ctx context.Context, branchID uint) context.Context {
+	return context.WithValue(ctx, Key, branchID)
+}
+
+// Unscoped returns context allowed to see every branch, for background
+// jobs and internal routes acting on behalf of no user
+func Unscoped(ctx context.Context) context.Context {
+	return NewContext(ctx, All)
+}
+
+// Lookup returns branch the context is scoped to, reporting whether it is
+func Lookup(ctx context.Context) (uint, bool) {
+	branchID, ok := ctx.Value(Key).(uint)
+	return branchID, ok
+}
+
+// FromContext returns branch the context is scoped to, None when it was
+// never scoped
+func FromContext(ctx context.Context) uint {
+	branchID, ok := Lookup(ctx)
+	if !ok {
+		return None
+	}
+	return branchID
+}
+
+// Filter returns a condition limiting column to the branch of ctx along with
+// its arguments. The condition always holds for All and never for None.
+func Filter(ctx context.Context, column string) (string, []interface{}) {
+	branchID := FromContext(ctx)
+	return "(? = 0 OR " + column + " = ?)", []interface{}{branchID, branchID}
+}
+
+// Default returns branch of tokens issued before branches existed,
+// DEFAULT_BRANCH_ID or 1
+func Default() uint {
+	if id, err := strconv.Atoi(os.Getenv("DEFAULT_BRANCH_ID")); err == nil && id > 0 {
+		return uint(id)
+	}
+	return 1
+}
+
+// Allows reports whether a context scoped to active may access a record of given branch
+func Allows(active, branchID uint) bool {
+	return active == All || active == branchID
+}
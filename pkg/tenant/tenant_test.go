@@ -0,0 +1,39 @@
+package tenant_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/tenant"
+)
+
+func TestFromContext(t *testing.T) {
+	cases := []struct {
+		name string
+		ctx  context.Context
+		want uint
+	}{
+		{"never scoped", context.Background(), tenant.None},
+		{"unscoped", tenant.Unscoped(context.Background()), tenant.All},
+		{"branch", tenant.NewContext(context.Background(), 2), 2},
+	}
+	for _, c := range cases {
+		if got := tenant.FromContext(c.ctx); got != c.want {
+			t.Errorf("%s: branch %d, want %d", c.name, got, c.want)
+		}
+	}
+}
+
+func TestNeverScopedFailsClosed(t *testing.T) {
+	ctx := context.Background()
+	for _, branchID := range []uint{1, 2} {
+		if tenant.Allows(tenant.FromContext(ctx), branchID) {
+			t.Errorf("context never scoped allows branch %d", branchID)
+		}
+	}
+
+	_, args := tenant.Filter(ctx, "branch_id")
+	if args[0] == tenant.All {
+		t.Error("context never scoped is filtered as every branch")
+	}
+}
@@ -0,0 +1,167 @@
+package transfer
+
+import (
+	"context"
+	"fmt"
+	"path"
+
+	"github.com/gkkkb/pokedex/pkg/audit"
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/log"
+	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/repository"
+	"github.com/gkkkb/pokedex/pkg/storage"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Import creates a member of given branch from a verified package along
+// with its history and attendances. A transfer is imported once per issuer
+// key, ErrAlreadyImported is returned for a package imported before. The
+// photo and documents are stored once the member is committed; when that
+// fails the member is discarded so the package can be imported again.
+func Import(ctx context.Context, db *sqlx.DB, repos *repository.Repositories, store storage.StorageInterface, documentStore storage.StorageInterface, pkg *Package, branchID, importedBy uint) (profile.Profile, error) {
+	src := pkg.Profile
+
+	var profileID uint
+	err := mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "INSERT INTO profiles (branch_id, name, gender, birth_date, phone, email, address, visibility) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+			branchID, src.Name, src.Gender, src.BirthDate, src.Phone, src.Email, src.Address, src.Visibility)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		profileID = uint(id)
+
+		// the unique key also rejects a concurrent import of the same package
+		// churches are told apart by the key that signed the package, not
+		// by the name they give themselves
+		_, err = tx.ExecContext(ctx, "INSERT INTO transfer_imports (branch_id, issuer_key, issuer_church, transfer_id, profile_id, imported_by) VALUES (?, ?, ?, ?, ?, ?)",
+			branchID, pkg.Manifest.Issuer.PublicKey, pkg.Manifest.Issuer.Church, pkg.Manifest.TransferID, profileID, importedBy)
+		if mysql.IsDuplicate(err) {
+			return ErrAlreadyImported
+		}
+		if err != nil {
+			return err
+		}
+
+		// changes were made by users of the issuing church, unknown here
+		for _, h := range pkg.Histories {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO profile_histories (profile_id, field, old_value, new_value, changed_by, created_at) VALUES (?, ?, ?, ?, 0, ?)",
+				profileID, h.Field, h.OldValue, h.NewValue, h.CreatedAt); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT INTO profile_histories (profile_id, field, old_value, new_value, changed_by) VALUES (?, ?, ?, ?, ?)",
+			profileID, "church", pkg.Manifest.Issuer.Church, Church(), importedBy); err != nil {
+			return err
+		}
+
+		for _, a := range pkg.Attendances {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO attendances (profile_id, event, attended_at) VALUES (?, ?, ?)", profileID, a.Event, a.AttendedAt); err != nil {
+				return err
+			}
+		}
+
+		if err := repository.NewProfileRepository(tx).IndexName(ctx, profileID, src.Name); err != nil {
+			return err
+		}
+
+		return audit.Record(ctx, tx, importedBy, "transfer-imported", "profile", profileID,
+			fmt.Sprintf("transfer %d of %s", pkg.Manifest.TransferID, pkg.Manifest.Issuer.Church))
+	})
+	if err != nil {
+		return profile.Profile{}, err
+	}
+
+	if err := importFiles(ctx, repos, store, documentStore, pkg, profileID, importedBy); err != nil {
+		if derr := discard(ctx, db, profileID); derr != nil {
+			logger.Error(ctx, derr, "discarding import failed", log.Fields{"profile_id": profileID})
+		}
+		return profile.Profile{}, err
+	}
+
+	return repos.Profiles.Find(ctx, profileID)
+}
+
+func importFiles(ctx context.Context, repos *repository.Repositories, store storage.StorageInterface, documentStore storage.StorageInterface, pkg *Package, profileID uint, importedBy uint) error {
+	if pkg.Profile.Photo != "" {
+		if err := importPhoto(ctx, repos, store, pkg, profileID, path.Base(pkg.Profile.Photo)); err != nil {
+			return err
+		}
+	}
+
+	for _, d := range pkg.Documents {
+		if err := importDocument(ctx, repos, documentStore, pkg, profileID, d, importedBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// discard deletes the rows of a member whose files could not be imported,
+// along with its import record. Files already stored are left to filegc.
+func discard(ctx context.Context, db *sqlx.DB, profileID uint) error {
+	return mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		queries := []string{
+			"DELETE v FROM document_versions v JOIN documents d ON d.id = v.document_id WHERE d.profile_id = ?",
+			"DELETE FROM documents WHERE profile_id = ?",
+			"DELETE FROM attendances WHERE profile_id = ?",
+			"DELETE FROM profile_histories WHERE profile_id = ?",
+			"DELETE FROM profile_name_trigrams WHERE profile_id = ?",
+			"DELETE FROM transfer_imports WHERE profile_id = ?",
+			"DELETE FROM profiles WHERE id = ?",
+		}
+		for _, q := range queries {
+			if _, err := tx.ExecContext(ctx, q, profileID); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func importPhoto(ctx context.Context, repos *repository.Repositories, store storage.StorageInterface, pkg *Package, profileID uint, photo string) error {
+	rc, err := pkg.Open(photoEntry(photo))
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	if err := store.Put(profile.PhotoPrefix(profileID), photo, rc); err != nil {
+		return err
+	}
+	return repos.Profiles.UpdatePhoto(ctx, profileID, photo)
+}
+
+// importDocument recreates d with its versions, oldest first so they keep
+// their order. Each version is put into documentStore before the
+// transaction recording it, so deadlock retries never read rc again.
+func importDocument(ctx context.Context, repos *repository.Repositories, documentStore storage.StorageInterface, pkg *Package, profileID uint, d PackageDocument, importedBy uint) error {
+	var documentID uint
+	for i := len(d.Versions) - 1; i >= 0; i-- {
+		v := d.Versions[i]
+		rc, err := pkg.Open(v.Entry)
+		if err != nil {
+			return err
+		}
+
+		upload := document.Upload{File: rc, OriginalName: v.OriginalName, Size: v.Size, UploadedBy: importedBy}
+		if documentID == 0 {
+			var created document.Document
+			created, err = repos.Documents.Create(ctx, documentStore, profileID, d.Type, d.Title, upload)
+			documentID = created.ID
+		} else {
+			_, err = repos.Documents.AddVersion(ctx, documentStore, profileID, documentID, upload)
+		}
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
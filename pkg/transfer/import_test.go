@@ -0,0 +1,156 @@
+package transfer_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/gkkkb/pokedex"
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+	"github.com/gkkkb/pokedex/pkg/transfer"
+)
+
+const memberID = 9501
+
+func TestImportRejectsPackageImportedBefore(t *testing.T) {
+	db := pokedextest.DB(t)
+	ctx := tenant.NewContext(context.Background(), 1)
+
+	instance := pokedextest.Instance(t, db)
+
+	pkg := &transfer.Package{
+		Manifest: transfer.Manifest{Issuer: transfer.Issuer{Church: "GKKK Bandung", PublicKey: "a2V5LW9mLWJhbmR1bmc="}, TransferID: 42},
+		Profile:  profile.Profile{Name: "Maria"},
+	}
+
+	if _, err := transfer.Import(ctx, db, instance.Repo, instance.Storage, instance.Documents, pkg, 1, 7); err != nil {
+		t.Fatalf("first Import: %v", err)
+	}
+	if _, err := transfer.Import(ctx, db, instance.Repo, instance.Storage, instance.Documents, pkg, 1, 7); err != transfer.ErrAlreadyImported {
+		t.Fatalf("second Import error = %v, want %v", err, transfer.ErrAlreadyImported)
+	}
+
+	// the same key under another name is the same church
+	pkg.Manifest.Issuer.Church = "GKKK Medan"
+	if _, err := transfer.Import(ctx, db, instance.Repo, instance.Storage, instance.Documents, pkg, 1, 7); err != transfer.ErrAlreadyImported {
+		t.Fatalf("Import under another name error = %v, want %v", err, transfer.ErrAlreadyImported)
+	}
+
+	var profiles int
+	if err := db.Get(&profiles, "SELECT COUNT(*) FROM profiles WHERE name = ?", "Maria"); err != nil {
+		t.Fatalf("count profiles: %v", err)
+	}
+	if profiles != 1 {
+		t.Errorf("%d profiles imported, want 1", profiles)
+	}
+
+	// the same transfer id signed by another key is another transfer, even
+	// when the church claims the same name
+	pkg.Manifest.Issuer = transfer.Issuer{Church: "GKKK Bandung", PublicKey: "a2V5LW9mLW1lZGFu"}
+	if _, err := transfer.Import(ctx, db, instance.Repo, instance.Storage, instance.Documents, pkg, 1, 7); err != nil {
+		t.Errorf("Import signed by another key: %v", err)
+	}
+}
+
+// failingPuts fails every Put, as a storage outage would
+type failingPuts struct {
+	storage.StorageInterface
+}
+
+func (s failingPuts) Put(filePrefix string, filename string, file io.Reader) error {
+	return errors.New("storage is down")
+}
+
+func TestImportDocuments(t *testing.T) {
+	db := pokedextest.DB(t)
+	pokedextest.LoadFixtures(t, db, "testdata/profiles.yml")
+	ctx := tenant.NewContext(context.Background(), 1)
+
+	instance := pokedextest.Instance(t, db)
+	pkg := packageWithDocument(t, ctx, instance)
+
+	// a member whose files cannot be stored is discarded, the package stays importable
+	if _, err := transfer.Import(ctx, db, instance.Repo, instance.Storage, failingPuts{instance.Documents}, pkg, 1, 7); err == nil {
+		t.Fatal("Import with failing storage succeeded")
+	}
+
+	imported, err := transfer.Import(ctx, db, instance.Repo, instance.Storage, instance.Documents, pkg, 1, 7)
+	if err != nil {
+		t.Fatalf("Import: %v", err)
+	}
+
+	var profiles int
+	if err := db.Get(&profiles, "SELECT COUNT(*) FROM profiles WHERE name = ?", "Paulus"); err != nil {
+		t.Fatalf("count profiles: %v", err)
+	}
+	if profiles != 2 {
+		t.Errorf("%d profiles named Paulus, want the source and one import", profiles)
+	}
+
+	docs, err := instance.Repo.Documents.All(ctx, imported.ID)
+	if err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(docs) != 1 || docs[0].Title != "Baptism" {
+		t.Fatalf("imported documents %+v, want Baptism", docs)
+	}
+
+	versions, err := instance.Repo.Documents.Versions(ctx, docs[0].ID)
+	if err != nil {
+		t.Fatalf("Versions: %v", err)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("%d versions imported, want 2", len(versions))
+	}
+	for i, want := range []string{"second", "first"} {
+		f, err := instance.Documents.Get(document.Prefix(imported.ID, docs[0].ID), versions[i].Filename)
+		if err != nil {
+			t.Fatalf("Get version %d: %v", versions[i].Version, err)
+		}
+		content, _ := ioutil.ReadAll(f)
+		if string(content) != want {
+			t.Errorf("version %d content %q, want %q", versions[i].Version, content, want)
+		}
+	}
+}
+
+// packageWithDocument returns the verified package of a transfer of the
+// fixture member holding a document of two versions
+func packageWithDocument(t *testing.T, ctx context.Context, instance *pokedex.Pokedex) *transfer.Package {
+	t.Helper()
+
+	doc, err := instance.Repo.Documents.Create(ctx, instance.Documents, memberID, document.TypeCertificate, "Baptism", document.Upload{File: strings.NewReader("first"), OriginalName: "baptism.pdf", Size: 5, UploadedBy: 7})
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := instance.Repo.Documents.AddVersion(ctx, instance.Documents, memberID, doc.ID, document.Upload{File: strings.NewReader("second"), OriginalName: "baptism.pdf", Size: 6, UploadedBy: 7}); err != nil {
+		t.Fatalf("AddVersion: %v", err)
+	}
+
+	public, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packager := transfer.Packager{Repos: instance.Repo, Store: instance.Storage, Documents: instance.Documents, Key: key, Church: "GKKK Bandung"}
+
+	var buf bytes.Buffer
+	if err := packager.Write(ctx, transfer.Transfer{ID: 43, ProfileID: memberID, DestinationChurch: "GKKK Jakarta"}, &buf); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	pkg, err := transfer.ReadPackage(bytes.NewReader(buf.Bytes()), int64(buf.Len()), []ed25519.PublicKey{public})
+	if err != nil {
+		t.Fatalf("ReadPackage: %v", err)
+	}
+	return pkg
+}
@@ -0,0 +1,42 @@
+package transfer
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"os"
+	"strings"
+)
+
+// ErrNoSigningKey is returned when packaging a transfer without a valid TRANSFER_SIGNING_KEY
+var ErrNoSigningKey = errors.New("Transfer signing key not configured")
+
+// SigningKey returns key signing packages of this church, from the base64
+// ed25519 seed in TRANSFER_SIGNING_KEY
+func SigningKey() (ed25519.PrivateKey, error) {
+	seed, err := base64.StdEncoding.DecodeString(os.Getenv("TRANSFER_SIGNING_KEY"))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, ErrNoSigningKey
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// TrustedKeys returns public keys of churches whose packages may be
+// imported, from comma separated base64 keys in TRANSFER_TRUSTED_KEYS.
+// Malformed keys are skipped.
+func TrustedKeys() []ed25519.PublicKey {
+	keys := []ed25519.PublicKey{}
+	for _, v := range strings.Split(os.Getenv("TRANSFER_TRUSTED_KEYS"), ",") {
+		key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(v))
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			continue
+		}
+		keys = append(keys, ed25519.PublicKey(key))
+	}
+	return keys
+}
+
+// Church returns name of this church signing its packages, from TRANSFER_CHURCH_NAME
+func Church() string {
+	return os.Getenv("TRANSFER_CHURCH_NAME")
+}
@@ -0,0 +1,381 @@
+package transfer
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/document"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/repository"
+	"github.com/gkkkb/pokedex/pkg/storage"
+)
+
+// PackageFormat is the version of the package layout written by Packager
+const PackageFormat = 1
+
+// A transfer package is a zip archive holding
+//
+//	manifest.json     Manifest, listing every other entry with its checksum
+//	manifest.sig      ed25519 signature of manifest.json by the issuer
+//	profile.json      the member's profile
+//	history.json      profile change history
+//	attendances.json  attendances
+//	documents.json    documents along with their versions
+//	files/...         the profile photo
+//	documents/...     every document version, under its document id
+const (
+	manifestEntry  = "manifest.json"
+	signatureEntry = "manifest.sig"
+)
+
+var (
+	// ErrInvalidPackage is returned for a package that is malformed or
+	// whose content does not match its signed manifest
+	ErrInvalidPackage = errors.New("Invalid transfer package")
+	// ErrUntrustedPackage is returned for a package signed by a church
+	// outside TRANSFER_TRUSTED_KEYS
+	ErrUntrustedPackage = errors.New("Untrusted transfer package")
+)
+
+// Manifest describes a transfer package
+type Manifest struct {
+	Format      int       `json:"format"`
+	Issuer      Issuer    `json:"issuer"`
+	TransferID  uint      `json:"transfer_id"`
+	Destination string    `json:"destination"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	// Files maps every other entry to its hex SHA-256 checksum
+	Files map[string]string `json:"files"`
+}
+
+// Issuer is the church that signed a package
+type Issuer struct {
+	Church    string `json:"church"`
+	PublicKey string `json:"public_key"`
+}
+
+// PackageDocument is a document along with every version, newest first
+type PackageDocument struct {
+	document.Document
+	Versions []PackageVersion `json:"versions"`
+}
+
+// PackageVersion is a document version along with the package entry holding
+// its file, the stored filename of a version is not part of its JSON
+type PackageVersion struct {
+	document.Version
+	Entry string `json:"entry"`
+}
+
+// Package is a verified transfer package
+type Package struct {
+	Manifest    Manifest
+	Profile     profile.Profile
+	Histories   []profile.History
+	Attendances []profile.Attendance
+	Documents   []PackageDocument
+
+	files map[string]*zip.File
+}
+
+// Packager writes signed packages of transfers to another church
+type Packager struct {
+	Repos *repository.Repositories
+	// Store keeps profile photos, Documents keeps document versions and packages
+	Store     storage.StorageInterface
+	Documents storage.StorageInterface
+	Key       ed25519.PrivateKey
+	Church    string
+}
+
+// Put writes the package of t into Documents under Prefix, returning its filename
+func (p Packager) Put(ctx context.Context, t Transfer) (string, error) {
+	var buf bytes.Buffer
+	if err := p.Write(ctx, t, &buf); err != nil {
+		return "", err
+	}
+
+	filename := fmt.Sprintf("transfer-%d.zip", t.ID)
+	if err := p.Documents.Put(Prefix(t.ID), filename, &buf); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// Write writes the package of t into w
+func (p Packager) Write(ctx context.Context, t Transfer, w io.Writer) error {
+	if len(p.Key) != ed25519.PrivateKeySize {
+		return ErrNoSigningKey
+	}
+
+	member, err := p.Repos.Profiles.Find(ctx, t.ProfileID)
+	if err != nil {
+		return err
+	}
+	histories, err := p.Repos.Profiles.Histories(ctx, t.ProfileID)
+	if err != nil {
+		return err
+	}
+	attendances, err := p.Repos.Profiles.Attendances(ctx, t.ProfileID)
+	if err != nil {
+		return err
+	}
+
+	docs, err := p.Repos.Documents.All(ctx, t.ProfileID)
+	if err != nil {
+		return err
+	}
+	packaged := make([]PackageDocument, 0, len(docs))
+	for _, d := range docs {
+		versions, err := p.Repos.Documents.Versions(ctx, d.ID)
+		if err != nil {
+			return err
+		}
+
+		pd := PackageDocument{Document: d, Versions: make([]PackageVersion, len(versions))}
+		for i, v := range versions {
+			pd.Versions[i] = PackageVersion{Version: v, Entry: path.Join("documents", fmt.Sprint(d.ID), v.Filename)}
+		}
+		packaged = append(packaged, pd)
+	}
+
+	pw := packageWriter{archive: zip.NewWriter(w), files: map[string]string{}}
+	entries := []struct {
+		name string
+		v    interface{}
+	}{
+		{"profile.json", member},
+		{"history.json", histories},
+		{"attendances.json", attendances},
+		{"documents.json", packaged},
+	}
+	for _, e := range entries {
+		b, err := json.MarshalIndent(e.v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := pw.add(e.name, bytes.NewReader(b)); err != nil {
+			return err
+		}
+	}
+
+	if member.Photo != "" {
+		if err := pw.copy(p.Store, profile.PhotoPrefix(member.ID), member.Photo, photoEntry(member.Photo)); err != nil {
+			return err
+		}
+	}
+	for _, d := range packaged {
+		for _, v := range d.Versions {
+			if err := pw.copy(p.Documents, document.Prefix(member.ID, d.ID), v.Filename, v.Entry); err != nil {
+				return err
+			}
+		}
+	}
+
+	var reason string
+	if t.Reason != nil {
+		reason = *t.Reason
+	}
+	manifest, err := json.MarshalIndent(Manifest{
+		Format:      PackageFormat,
+		Issuer:      Issuer{Church: p.Church, PublicKey: base64.StdEncoding.EncodeToString(p.Key.Public().(ed25519.PublicKey))},
+		TransferID:  t.ID,
+		Destination: t.DestinationChurch,
+		Reason:      reason,
+		CreatedAt:   time.Now().UTC(),
+		Files:       pw.files,
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	for name, content := range map[string][]byte{manifestEntry: manifest, signatureEntry: ed25519.Sign(p.Key, manifest)} {
+		f, err := pw.archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := f.Write(content); err != nil {
+			return err
+		}
+	}
+
+	return pw.archive.Close()
+}
+
+// packageWriter adds entries to a package, recording their checksums
+type packageWriter struct {
+	archive *zip.Writer
+	files   map[string]string
+}
+
+func (pw packageWriter) add(name string, src io.Reader) error {
+	f, err := pw.archive.Create(name)
+	if err != nil {
+		return err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(f, h), src); err != nil {
+		return err
+	}
+	pw.files[name] = hex.EncodeToString(h.Sum(nil))
+	return nil
+}
+
+func (pw packageWriter) copy(store storage.StorageInterface, filePrefix, filename, dest string) error {
+	src, err := store.Get(filePrefix, filename)
+	if err != nil {
+		return err
+	}
+	if c, ok := src.(io.Closer); ok {
+		defer c.Close()
+	}
+	return pw.add(dest, src)
+}
+
+// ReadPackage verifies a package signed by one of trusted keys and decodes it
+func ReadPackage(r io.ReaderAt, size int64, trusted []ed25519.PublicKey) (*Package, error) {
+	archive, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, ErrInvalidPackage
+	}
+
+	pkg := &Package{files: map[string]*zip.File{}}
+	for _, f := range archive.File {
+		pkg.files[f.Name] = f
+	}
+
+	manifest, err := pkg.read(manifestEntry)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := pkg.read(signatureEntry)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(manifest, &pkg.Manifest); err != nil || pkg.Manifest.Format != PackageFormat {
+		return nil, ErrInvalidPackage
+	}
+
+	key, err := base64.StdEncoding.DecodeString(pkg.Manifest.Issuer.PublicKey)
+	if err != nil || !isTrusted(key, trusted) {
+		return nil, ErrUntrustedPackage
+	}
+	if !ed25519.Verify(ed25519.PublicKey(key), manifest, signature) {
+		return nil, ErrInvalidPackage
+	}
+
+	// every entry must be listed in the signed manifest with a matching checksum
+	if len(pkg.files) != len(pkg.Manifest.Files)+2 {
+		return nil, ErrInvalidPackage
+	}
+	for name, checksum := range pkg.Manifest.Files {
+		if name == manifestEntry || name == signatureEntry {
+			return nil, ErrInvalidPackage
+		}
+		sum, err := pkg.checksum(name)
+		if err != nil {
+			return nil, err
+		}
+		if sum != checksum {
+			return nil, ErrInvalidPackage
+		}
+	}
+
+	entries := map[string]interface{}{
+		"profile.json":     &pkg.Profile,
+		"history.json":     &pkg.Histories,
+		"attendances.json": &pkg.Attendances,
+		"documents.json":   &pkg.Documents,
+	}
+	for name, v := range entries {
+		content, err := pkg.read(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(content, v); err != nil {
+			return nil, ErrInvalidPackage
+		}
+	}
+
+	// files are stored once the member is imported, a package missing one
+	// is rejected before anything is
+	if pkg.Profile.Photo != "" {
+		if _, ok := pkg.files[photoEntry(pkg.Profile.Photo)]; !ok {
+			return nil, ErrInvalidPackage
+		}
+	}
+	for _, d := range pkg.Documents {
+		for _, v := range d.Versions {
+			if _, ok := pkg.files[v.Entry]; !ok || path.Dir(v.Entry) != path.Join("documents", fmt.Sprint(d.ID)) {
+				return nil, ErrInvalidPackage
+			}
+		}
+	}
+
+	return pkg, nil
+}
+
+// photoEntry returns the package entry holding given profile photo
+func photoEntry(photo string) string {
+	return path.Join("files", path.Base(photo))
+}
+
+// Open returns content of a file entry of the package
+func (pkg *Package) Open(name string) (io.ReadCloser, error) {
+	f, ok := pkg.files[name]
+	if !ok {
+		return nil, ErrInvalidPackage
+	}
+	return f.Open()
+}
+
+func (pkg *Package) read(name string) ([]byte, error) {
+	rc, err := pkg.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+
+	content, err := ioutil.ReadAll(rc)
+	if err != nil {
+		return nil, ErrInvalidPackage
+	}
+	return content, nil
+}
+
+func (pkg *Package) checksum(name string) (string, error) {
+	rc, err := pkg.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", ErrInvalidPackage
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func isTrusted(key []byte, trusted []ed25519.PublicKey) bool {
+	for _, t := range trusted {
+		if bytes.Equal(key, t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,330 @@
+// Package transfer moves members to another branch of the church, or out to
+// another church as a signed transfer package. A transfer is requested by
+// the member or an admin, approved by admins of both branches, then
+// completed. Transfers out only need the approval of the source branch.
+package transfer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/audit"
+	"github.com/gkkkb/pokedex/pkg/log"
+	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/repository"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+var logger = log.Package("transfer")
+
+// Transfer statuses
+const (
+	StatusRequested = "requested"
+	StatusApproved  = "approved"
+	StatusRejected  = "rejected"
+	StatusCompleted = "completed"
+)
+
+var (
+	// ErrTransferNotFound is returned when a transfer does not exist
+	ErrTransferNotFound = errors.New("Transfer not found")
+	// ErrTransferNotPending is returned when reviewing a transfer already reviewed by the same side
+	ErrTransferNotPending = errors.New("Data not updatable")
+	// ErrTransferExists is returned when requesting a transfer of a member already being transferred
+	ErrTransferExists = errors.New("Transfer exists")
+	// ErrAlreadyImported is returned when importing a package of a transfer
+	// already imported from the church holding the same key
+	ErrAlreadyImported = errors.New("Transfer already imported")
+	// ErrInvalidDestination is returned unless exactly one of destination branch
+	// and church is given, or the branch is the member's own
+	ErrInvalidDestination = errors.New("Invalid transfer destination")
+)
+
+// Transfer moves a profile out of its branch
+type Transfer struct {
+	ID        uint `db:"id" json:"id"`
+	BranchID  uint `db:"branch_id" json:"branch_id"`
+	ProfileID uint `db:"profile_id" json:"profile_id"`
+	// ToBranchID is the destination branch, nil for transfers to another church
+	ToBranchID            *uint      `db:"to_branch_id" json:"to_branch_id,omitempty"`
+	DestinationChurch     string     `db:"destination_church" json:"destination_church,omitempty"`
+	Status                string     `db:"status" json:"status"`
+	Reason                *string    `db:"reason" json:"reason,omitempty"`
+	RequestedBy           uint       `db:"requested_by" json:"requested_by"`
+	SourceApprovedBy      *uint      `db:"source_approved_by" json:"source_approved_by,omitempty"`
+	DestinationApprovedBy *uint      `db:"destination_approved_by" json:"destination_approved_by,omitempty"`
+	RejectedBy            *uint      `db:"rejected_by" json:"rejected_by,omitempty"`
+	Package               string     `db:"package" json:"-"`
+	CompletedAt           *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+	CreatedAt             time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt             time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+const columns = "id, branch_id, profile_id, to_branch_id, destination_church, status, reason, requested_by, source_approved_by, destination_approved_by, rejected_by, package, completed_at, created_at, updated_at"
+
+// External reports whether t moves the member to another church
+func (t Transfer) External() bool {
+	return t.ToBranchID == nil
+}
+
+// HasPackage reports whether the signed package of t can be downloaded
+func (t Transfer) HasPackage() bool {
+	return t.External() && t.Status == StatusCompleted && t.Package != ""
+}
+
+// Prefix returns storage prefix of given transfer's package
+func Prefix(transferID uint) string {
+	return fmt.Sprintf("transfers/%d", transferID)
+}
+
+// Request records a pending transfer of given profile to another branch,
+// or to destinationChurch when toBranchID is 0
+func Request(ctx context.Context, db *sqlx.DB, profileID, toBranchID uint, destinationChurch string, requestedBy uint, reason string) (Transfer, error) {
+	if (toBranchID == 0) == (destinationChurch == "") {
+		return Transfer{}, ErrInvalidDestination
+	}
+
+	p, err := repository.NewProfileRepository(db).Find(ctx, profileID)
+	if err != nil {
+		return Transfer{}, err
+	}
+
+	var toBranch *uint
+	if toBranchID != 0 {
+		var n int
+		if err := db.GetContext(ctx, &n, "SELECT COUNT(*) FROM branches WHERE id = ?", toBranchID); err != nil {
+			return Transfer{}, err
+		}
+		if n == 0 || toBranchID == p.BranchID {
+			return Transfer{}, ErrInvalidDestination
+		}
+		toBranch = &toBranchID
+	}
+
+	var id int64
+	err = mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		// lock the profile so two requests can not both see no pending transfer
+		var locked uint
+		if err := tx.GetContext(ctx, &locked, "SELECT id FROM profiles WHERE id = ? FOR UPDATE", profileID); err != nil {
+			return err
+		}
+
+		var pending int
+		if err := tx.GetContext(ctx, &pending, "SELECT COUNT(*) FROM transfers WHERE profile_id = ? AND status IN (?, ?)", profileID, StatusRequested, StatusApproved); err != nil {
+			return err
+		}
+		if pending > 0 {
+			return ErrTransferExists
+		}
+
+		res, err := tx.ExecContext(ctx, "INSERT INTO transfers (branch_id, profile_id, to_branch_id, destination_church, status, reason, requested_by) VALUES (?, ?, ?, ?, ?, ?, ?)",
+			p.BranchID, profileID, toBranch, destinationChurch, StatusRequested, reason, requestedBy)
+		if err != nil {
+			return err
+		}
+		if id, err = res.LastInsertId(); err != nil {
+			return err
+		}
+
+		return audit.Record(ctx, tx, requestedBy, "transfer-requested", "profile", profileID, fmt.Sprintf("transfer %d", id))
+	})
+	if err != nil {
+		return Transfer{}, err
+	}
+
+	return Find(ctx, db, uint(id))
+}
+
+// Find returns transfer with given id, visible to both its source and
+// destination branch
+func Find(ctx context.Context, db sqlx.QueryerContext, id uint) (Transfer, error) {
+	var t Transfer
+	branch, args := filter(ctx)
+	err := sqlx.GetContext(ctx, db, &t, "SELECT "+columns+" FROM transfers WHERE id = ? AND "+branch, append([]interface{}{id}, args...)...)
+	if err == sql.ErrNoRows {
+		return t, ErrTransferNotFound
+	}
+	return t, err
+}
+
+// ForProfile returns transfers of given profile visible to the branch of
+// ctx, oldest first
+func ForProfile(ctx context.Context, db sqlx.QueryerContext, profileID uint) ([]Transfer, error) {
+	transfers := []Transfer{}
+	branch, args := filter(ctx)
+	err := sqlx.SelectContext(ctx, db, &transfers, "SELECT "+columns+" FROM transfers WHERE profile_id = ? AND "+branch+" ORDER BY id", append([]interface{}{profileID}, args...)...)
+	return transfers, err
+}
+
+// Reject marks a pending transfer as rejected by an admin of either side
+func Reject(ctx context.Context, db *sqlx.DB, id, adminID uint) error {
+	return mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		t, err := lock(ctx, tx, id)
+		if err != nil {
+			return err
+		}
+		if t.Status != StatusRequested {
+			return ErrTransferNotPending
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE transfers SET status = ?, rejected_by = ? WHERE id = ?", StatusRejected, adminID, id); err != nil {
+			return err
+		}
+
+		return audit.Record(ctx, tx, adminID, "transfer-rejected", "profile", t.ProfileID, fmt.Sprintf("transfer %d", id))
+	})
+}
+
+// Approve records the approval of the admin's side, the active branch of
+// ctx, and completes the transfer once every side approved. Super admins
+// approve every side at once.
+//
+// Transfers between branches move the profile within the approving
+// transaction. Transfers out are packaged by out afterwards; when that
+// fails the transfer stays approved and approving it again retries.
+func Approve(ctx context.Context, db *sqlx.DB, out Packager, id, adminID uint) error {
+	var t Transfer
+	err := mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		var err error
+		if t, err = lock(ctx, tx, id); err != nil {
+			return err
+		}
+		if t.Status == StatusApproved && t.External() {
+			return nil
+		}
+		if t.Status != StatusRequested {
+			return ErrTransferNotPending
+		}
+
+		active := tenant.FromContext(ctx)
+		approved := false
+		if t.SourceApprovedBy == nil && tenant.Allows(active, t.BranchID) {
+			t.SourceApprovedBy, approved = &adminID, true
+		}
+		if !t.External() && t.DestinationApprovedBy == nil && tenant.Allows(active, *t.ToBranchID) {
+			t.DestinationApprovedBy, approved = &adminID, true
+		}
+		if !approved {
+			return ErrTransferNotPending
+		}
+
+		if t.SourceApprovedBy != nil && (t.External() || t.DestinationApprovedBy != nil) {
+			t.Status = StatusApproved
+		}
+
+		if _, err := tx.ExecContext(ctx, "UPDATE transfers SET status = ?, source_approved_by = ?, destination_approved_by = ? WHERE id = ?",
+			t.Status, t.SourceApprovedBy, t.DestinationApprovedBy, id); err != nil {
+			return err
+		}
+		if err := audit.Record(ctx, tx, adminID, "transfer-approved", "profile", t.ProfileID, fmt.Sprintf("transfer %d", id)); err != nil {
+			return err
+		}
+
+		if t.Status != StatusApproved || t.External() {
+			return nil
+		}
+		if err := moveBranch(ctx, tx, t, adminID); err != nil {
+			return err
+		}
+		return complete(ctx, tx, t, "", adminID)
+	})
+	if err != nil || t.Status != StatusApproved || !t.External() {
+		return err
+	}
+
+	filename, err := out.Put(ctx, t)
+	if err != nil {
+		return err
+	}
+
+	return mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		if err := leaveChurch(ctx, tx, t, adminID); err != nil {
+			return err
+		}
+		return complete(ctx, tx, t, filename, adminID)
+	})
+}
+
+// moveBranch moves the profile of t and its documents to the destination
+// branch. Histories and attendances stay with the profile, while household
+// and group memberships are left behind as they belong to the source branch.
+func moveBranch(ctx context.Context, tx *sqlx.Tx, t Transfer, adminID uint) error {
+	var current struct {
+		BranchID    uint  `db:"branch_id"`
+		HouseholdID *uint `db:"household_id"`
+	}
+	if err := tx.GetContext(ctx, &current, "SELECT branch_id, household_id FROM profiles WHERE id = ? FOR UPDATE", t.ProfileID); err != nil {
+		return err
+	}
+
+	changes := [][]interface{}{{"branch_id", current.BranchID, *t.ToBranchID}}
+	if current.HouseholdID != nil {
+		changes = append(changes, []interface{}{"household_id", *current.HouseholdID, nil})
+	}
+	for _, c := range changes {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO profile_histories (profile_id, field, old_value, new_value, changed_by) VALUES (?, ?, ?, ?, ?)",
+			t.ProfileID, c[0], c[1], c[2], adminID); err != nil {
+			return err
+		}
+	}
+
+	statements := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"UPDATE profiles SET branch_id = ?, household_id = NULL, version = version + 1 WHERE id = ?", []interface{}{*t.ToBranchID, t.ProfileID}},
+		{"DELETE m FROM group_members m JOIN `groups` g ON g.id = m.group_id WHERE m.profile_id = ? AND g.branch_id != ?", []interface{}{t.ProfileID, *t.ToBranchID}},
+		{"UPDATE documents SET branch_id = ? WHERE profile_id = ?", []interface{}{*t.ToBranchID, t.ProfileID}},
+		{"UPDATE uploads SET branch_id = ? WHERE profile_id = ?", []interface{}{*t.ToBranchID, t.ProfileID}},
+	}
+	for _, s := range statements {
+		if _, err := tx.ExecContext(ctx, s.query, s.args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// leaveChurch removes the profile of t from member lists once it has been
+// packaged for the destination church. The row is kept so the transfer and
+// its audit logs still point to a profile.
+func leaveChurch(ctx context.Context, tx *sqlx.Tx, t Transfer, adminID uint) error {
+	if _, err := tx.ExecContext(ctx, "INSERT INTO profile_histories (profile_id, field, old_value, new_value, changed_by) VALUES (?, ?, ?, ?, ?)",
+		t.ProfileID, "church", nil, t.DestinationChurch, adminID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "UPDATE profiles SET deleted_at = NOW(), version = version + 1 WHERE id = ?", t.ProfileID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM profile_name_trigrams WHERE profile_id = ?", t.ProfileID)
+	return err
+}
+
+func complete(ctx context.Context, tx *sqlx.Tx, t Transfer, filename string, adminID uint) error {
+	if _, err := tx.ExecContext(ctx, "UPDATE transfers SET status = ?, package = ?, completed_at = UTC_TIMESTAMP() WHERE id = ?", StatusCompleted, filename, t.ID); err != nil {
+		return err
+	}
+	return audit.Record(ctx, tx, adminID, "transfer-completed", "profile", t.ProfileID, fmt.Sprintf("transfer %d", t.ID))
+}
+
+// lock returns transfer with given id locked for update
+func lock(ctx context.Context, tx *sqlx.Tx, id uint) (Transfer, error) {
+	var t Transfer
+	branch, args := filter(ctx)
+	err := tx.GetContext(ctx, &t, "SELECT "+columns+" FROM transfers WHERE id = ? AND "+branch+" FOR UPDATE", append([]interface{}{id}, args...)...)
+	if err == sql.ErrNoRows {
+		return t, ErrTransferNotFound
+	}
+	return t, err
+}
+
+// filter limits transfers to those leaving or entering the branch of ctx
+func filter(ctx context.Context) (string, []interface{}) {
+	branchID := tenant.FromContext(ctx)
+	return "(? = 0 OR branch_id = ? OR to_branch_id = ?)", []interface{}{branchID, branchID, branchID}
+}
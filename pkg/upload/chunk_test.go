@@ -0,0 +1,70 @@
+package upload
+
+import (
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/storage"
+)
+
+// countingStore counts chunks opened with Get
+type countingStore struct {
+	storage.StorageInterface
+	opened int
+}
+
+func (s *countingStore) Get(filePrefix string, filename string) (io.Reader, error) {
+	s.opened++
+	return s.StorageInterface.Get(filePrefix, filename)
+}
+
+func TestChunkReaderOpensChunksLazily(t *testing.T) {
+	mem, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	store := &countingStore{StorageInterface: mem}
+
+	names := []string{"a", "empty", "b", "c"}
+	for i, content := range []string{"first ", "", "second ", "third"} {
+		if err := store.Put("uploads/x", names[i], strings.NewReader(content)); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+	}
+
+	r := &chunkReader{store: store, prefix: "uploads/x", names: names}
+	defer r.Close()
+
+	buf := make([]byte, 3)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if store.opened != 1 {
+		t.Errorf("opened %d chunks after reading the first bytes, want 1", store.opened)
+	}
+
+	rest, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if got := string(buf) + string(rest); got != "first second third" {
+		t.Errorf("assembled %q, want %q", got, "first second third")
+	}
+	if store.opened != len(names) {
+		t.Errorf("opened %d chunks, want %d", store.opened, len(names))
+	}
+}
+
+func TestChunkReaderMissingChunk(t *testing.T) {
+	mem, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+
+	r := &chunkReader{store: mem, prefix: "uploads/x", names: []string{"missing"}}
+	if _, err := ioutil.ReadAll(r); err != storage.ErrFileNotFound {
+		t.Errorf("ReadAll error = %v, want %v", err, storage.ErrFileNotFound)
+	}
+}
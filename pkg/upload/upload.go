@@ -0,0 +1,463 @@
+// Package upload implements resumable uploads following the tus protocol
+// (https://tus.io/protocols/resumable-upload.html). Chunks are kept in
+// private storage until the upload completes, then assembled into the
+// destination of the upload purpose and attached to their record.
+package upload
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gkkkb/pokedex/pkg/api/request"
+	"github.com/gkkkb/pokedex/pkg/log"
+	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/profile"
+	"github.com/gkkkb/pokedex/pkg/registry"
+	"github.com/gkkkb/pokedex/pkg/repository"
+	"github.com/gkkkb/pokedex/pkg/resource"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Upload purposes
+const (
+	PurposePhoto    = "photo"
+	PurposeRegistry = "registry"
+)
+
+var logger = log.Package("upload")
+
+var (
+	// ErrUploadNotFound is returned when an upload does not exist or has expired
+	ErrUploadNotFound = errors.New("Upload not found")
+	// ErrOffsetMismatch is returned when a chunk does not start at the current offset
+	ErrOffsetMismatch = errors.New("Upload offset mismatch")
+	// ErrInvalidPurpose is returned for a purpose outside Purposes
+	ErrInvalidPurpose = errors.New("Invalid upload purpose")
+	// ErrUploadCompleted is returned when appending to a completed upload
+	ErrUploadCompleted = errors.New("Upload already completed")
+	// ErrInvalidLength is returned for an upload without positive length
+	ErrInvalidLength = errors.New("Invalid upload length")
+	// ErrUnsupportedType is returned for a file extension the purpose does not accept
+	ErrUnsupportedType = errors.New("File type not supported")
+)
+
+// Purpose describes where uploads of a kind end up and how large they may be
+type Purpose struct {
+	Name string
+	// MaxSize is the default limit, overridable with UPLOAD_MAX_SIZE_<NAME>
+	MaxSize int64
+	// Private uploads are assembled into private storage, unencrypted so
+	// files of a few GiB are streamed rather than held in memory
+	Private bool
+	// Extensions lists accepted file extensions, any when empty
+	Extensions []string
+	// Prefix returns storage prefix of the assembled file
+	Prefix func(u Upload) string
+	// Attach records the assembled file of u, in the transaction marking
+	// u completed
+	Attach func(ctx context.Context, tx *sqlx.Tx, u Upload) error
+}
+
+// Purposes lists every accepted upload purpose
+var Purposes = map[string]Purpose{
+	PurposePhoto: {
+		Name:       PurposePhoto,
+		MaxSize:    10 << 20,
+		Extensions: []string{".jpg", ".jpeg", ".png"},
+		Prefix:     func(u Upload) string { return profile.PhotoPrefix(u.ProfileID) },
+		Attach:     attachPhoto,
+	},
+	PurposeRegistry: {
+		Name:    PurposeRegistry,
+		MaxSize: 2 << 30,
+		Private: true,
+		Prefix:  func(u Upload) string { return registry.Prefix },
+		Attach:  attachRegistry,
+	},
+}
+
+// attachPhoto makes the upload the photo of its profile, the previous photo
+// is left to filegc
+func attachPhoto(ctx context.Context, tx *sqlx.Tx, u Upload) error {
+	return repository.NewProfileRepository(tx).UpdatePhoto(ctx, u.ProfileID, u.Filename)
+}
+
+// attachRegistry records the upload as a registry file of its branch, and of
+// its profile when uploaded for one
+func attachRegistry(ctx context.Context, tx *sqlx.Tx, u Upload) error {
+	_, err := repository.NewRegistryRepository(tx).Create(ctx, registry.File{
+		BranchID:     u.BranchID,
+		ProfileID:    u.ProfileID,
+		UploadID:     u.ID,
+		Filename:     u.Filename,
+		OriginalName: ParseMetadata(u.Metadata)["filename"],
+		Size:         u.Length,
+		CreatedBy:    u.CreatedBy,
+	})
+	return err
+}
+
+// Limit returns the maximum upload size of the purpose
+func (p Purpose) Limit() int64 {
+	v, err := strconv.ParseInt(os.Getenv("UPLOAD_MAX_SIZE_"+strings.ToUpper(p.Name)), 10, 64)
+	if err != nil || v <= 0 {
+		return p.MaxSize
+	}
+	return v
+}
+
+// Upload is a resumable upload in progress
+type Upload struct {
+	ID          string     `db:"id" json:"id"`
+	BranchID    uint       `db:"branch_id" json:"branch_id"`
+	Purpose     string     `db:"purpose" json:"purpose"`
+	ProfileID   uint       `db:"profile_id" json:"profile_id,omitempty"`
+	Filename    string     `db:"filename" json:"filename"`
+	Length      int64      `db:"length" json:"length"`
+	Offset      int64      `db:"upload_offset" json:"offset"`
+	Chunks      int        `db:"chunks" json:"-"`
+	Metadata    string     `db:"metadata" json:"-"`
+	CreatedBy   uint       `db:"created_by" json:"created_by"`
+	ExpiresAt   time.Time  `db:"expires_at" json:"expires_at"`
+	CompletedAt *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+}
+
+const columns = "id, branch_id, purpose, profile_id, filename, length, upload_offset, chunks, metadata, created_by, expires_at, completed_at"
+
+// Expiry returns how long an upload may stay incomplete, from UPLOAD_EXPIRY
+func Expiry() time.Duration {
+	d, err := time.ParseDuration(os.Getenv("UPLOAD_EXPIRY"))
+	if err != nil || d <= 0 {
+		return 24 * time.Hour
+	}
+	return d
+}
+
+// ParseMetadata decodes a tus Upload-Metadata header
+func ParseMetadata(header string) map[string]string {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), " ", 2)
+		if kv[0] == "" {
+			continue
+		}
+
+		var value string
+		if len(kv) == 2 {
+			b, err := base64.StdEncoding.DecodeString(kv[1])
+			if err != nil {
+				continue
+			}
+			value = string(b)
+		}
+		metadata[kv[0]] = value
+	}
+	return metadata
+}
+
+// Create records a new upload of given purpose and length in given branch
+func Create(ctx context.Context, db *sqlx.DB, purpose Purpose, branchID uint, profileID uint, length int64, metadataHeader string, createdBy uint) (Upload, error) {
+	if length <= 0 {
+		return Upload{}, ErrInvalidLength
+	}
+	if length > purpose.Limit() {
+		return Upload{}, storage.ErrFileTooLarge
+	}
+
+	ext := strings.ToLower(filepath.Ext(ParseMetadata(metadataHeader)["filename"]))
+	if len(purpose.Extensions) > 0 && !contains(purpose.Extensions, ext) {
+		return Upload{}, ErrUnsupportedType
+	}
+
+	id := request.CreateRequestID()
+	u := Upload{
+		ID:        id,
+		BranchID:  branchID,
+		Purpose:   purpose.Name,
+		ProfileID: profileID,
+		Filename:  id + ext,
+		Length:    length,
+		Metadata:  metadataHeader,
+		CreatedBy: createdBy,
+		ExpiresAt: time.Now().Add(Expiry()).UTC().Truncate(time.Second),
+	}
+
+	_, err := db.ExecContext(ctx, "INSERT INTO uploads (id, branch_id, purpose, profile_id, filename, length, metadata, created_by, expires_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		u.ID, u.BranchID, u.Purpose, u.ProfileID, u.Filename, u.Length, u.Metadata, u.CreatedBy, u.ExpiresAt)
+	return u, err
+}
+
+// Find returns an unexpired upload of the branch of ctx
+func Find(ctx context.Context, db *sqlx.DB, id string) (Upload, error) {
+	var u Upload
+	branch, args := tenant.Filter(ctx, "branch_id")
+	err := db.GetContext(ctx, &u, "SELECT "+columns+" FROM uploads WHERE id = ? AND (expires_at > UTC_TIMESTAMP() OR completed_at IS NOT NULL) AND "+branch, append([]interface{}{id}, args...)...)
+	if err == sql.ErrNoRows {
+		return u, ErrUploadNotFound
+	}
+	return u, err
+}
+
+// ChunkPrefix returns storage prefix of an upload's chunks
+func ChunkPrefix(id string) string {
+	return "uploads/" + id
+}
+
+// chunkName returns a name no other request uses for the chunk at offset,
+// so a PATCH losing a race never overwrites the chunk of the winner
+func chunkName(offset int64) string {
+	return fmt.Sprintf("%020d-%s", offset, request.CreateRequestID())
+}
+
+// Append stores body as the chunk starting at offset. Once the upload
+// reaches its length, chunks are assembled into dest and removed. An empty
+// chunk at the end of an upload whose assembly failed retries it.
+func Append(ctx context.Context, db *sqlx.DB, chunks storage.StorageInterface, dest storage.StorageInterface, u Upload, offset int64, body io.Reader) (Upload, error) {
+	if u.CompletedAt != nil {
+		return u, ErrUploadCompleted
+	}
+	if offset != u.Offset {
+		return u, ErrOffsetMismatch
+	}
+	if u.Offset >= u.Length {
+		return complete(ctx, db, chunks, dest, u)
+	}
+
+	name := chunkName(offset)
+	counter := &countingReader{r: io.LimitReader(body, u.Length-u.Offset)}
+	if err := chunks.Put(ChunkPrefix(u.ID), name, counter); err != nil {
+		chunks.Delete(ChunkPrefix(u.ID), name)
+		return u, err
+	}
+	if counter.n == 0 {
+		chunks.Delete(ChunkPrefix(u.ID), name)
+		return u, nil
+	}
+
+	// the chunk only counts once the offset condition wins, a concurrent
+	// PATCH of the same offset deletes its own chunk
+	err := mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE uploads SET upload_offset = upload_offset + ?, chunks = chunks + 1 WHERE id = ? AND upload_offset = ? AND completed_at IS NULL",
+			counter.n, u.ID, u.Offset)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return ErrOffsetMismatch
+		}
+
+		_, err = tx.ExecContext(ctx, "INSERT INTO upload_chunks (upload_id, upload_offset, filename, size) VALUES (?, ?, ?, ?)",
+			u.ID, u.Offset, name, counter.n)
+		return err
+	})
+	if err != nil {
+		chunks.Delete(ChunkPrefix(u.ID), name)
+		return u, err
+	}
+
+	u.Offset += counter.n
+	u.Chunks++
+
+	if u.Offset < u.Length {
+		return u, nil
+	}
+	return complete(ctx, db, chunks, dest, u)
+}
+
+// Resume completes u when every chunk was received but its assembly
+// failed, so a client checking the offset with HEAD retries it
+func Resume(ctx context.Context, db *sqlx.DB, chunks storage.StorageInterface, dest storage.StorageInterface, u Upload) (Upload, error) {
+	if u.CompletedAt != nil || u.Offset < u.Length {
+		return u, nil
+	}
+	return complete(ctx, db, chunks, dest, u)
+}
+
+// complete streams chunks of u into dest, then marks u completed and
+// attaches the file in one transaction. Concurrent completions put the same
+// content, only the first one attaches it.
+func complete(ctx context.Context, db *sqlx.DB, chunks storage.StorageInterface, dest storage.StorageInterface, u Upload) (Upload, error) {
+	names := []string{}
+	if err := db.SelectContext(ctx, &names, "SELECT filename FROM upload_chunks WHERE upload_id = ? ORDER BY upload_offset", u.ID); err != nil {
+		return u, err
+	}
+
+	r := &chunkReader{store: chunks, prefix: ChunkPrefix(u.ID), names: names}
+	defer r.Close()
+
+	purpose := Purposes[u.Purpose]
+	if err := dest.Put(purpose.Prefix(u), u.Filename, r); err != nil {
+		return u, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	err := mysql.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx, "UPDATE uploads SET completed_at = ? WHERE id = ? AND completed_at IS NULL", now, u.ID)
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			return ErrUploadCompleted
+		}
+		return purpose.Attach(ctx, tx, u)
+	})
+	if err != nil && err != ErrUploadCompleted {
+		return u, err
+	}
+	u.CompletedAt = &now
+
+	if err == nil {
+		deleteChunks(ctx, db, chunks, u)
+	}
+	return u, nil
+}
+
+// Terminate deletes an upload and its chunks
+func Terminate(ctx context.Context, db *sqlx.DB, chunks storage.StorageInterface, u Upload) error {
+	if _, err := db.ExecContext(ctx, "DELETE FROM uploads WHERE id = ?", u.ID); err != nil {
+		return err
+	}
+
+	deleteChunks(ctx, db, chunks, u)
+	return nil
+}
+
+// Cleanup terminates every incomplete upload past its expiry
+func Cleanup(ctx context.Context, db *sqlx.DB, chunks storage.StorageInterface) (int, error) {
+	expired := []Upload{}
+	if err := db.SelectContext(ctx, &expired, "SELECT "+columns+" FROM uploads WHERE expires_at <= UTC_TIMESTAMP() AND completed_at IS NULL"); err != nil {
+		return 0, err
+	}
+
+	for _, u := range expired {
+		if err := Terminate(ctx, db, chunks, u); err != nil {
+			return 0, err
+		}
+	}
+	return len(expired), nil
+}
+
+// RunCleanup removes expired uploads every interval until ctx is done
+func RunCleanup(ctx context.Context, db *sqlx.DB, chunks storage.StorageInterface, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			job := tenant.Unscoped(resource.NewJobContext(ctx, "upload-cleanup"))
+			if n, err := Cleanup(job, db, chunks); err != nil {
+				logger.Error(job, err, "cleanup failed", nil)
+			} else if n > 0 {
+				logger.Info(job, "removed expired uploads", log.Fields{"count": n})
+			}
+		}
+	}
+}
+
+// deleteChunks removes every chunk stored for u, including chunks of PATCH
+// requests that lost a race and could not remove their own
+func deleteChunks(ctx context.Context, db *sqlx.DB, chunks storage.StorageInterface, u Upload) {
+	prefix := ChunkPrefix(u.ID)
+	marker := ""
+	for {
+		infos, next, err := chunks.List(prefix, marker, 100)
+		if err != nil {
+			logger.Error(ctx, err, "list chunks failed", log.Fields{"upload_id": u.ID})
+			break
+		}
+		for _, info := range infos {
+			chunks.Delete(prefix, path.Base(info.Name))
+		}
+		if next == "" {
+			break
+		}
+		marker = next
+	}
+
+	if _, err := db.ExecContext(ctx, "DELETE FROM upload_chunks WHERE upload_id = ?", u.ID); err != nil {
+		logger.Error(ctx, err, "delete chunks failed", log.Fields{"upload_id": u.ID})
+	}
+}
+
+// chunkReader reads chunks one after another, opening each only once the
+// previous one is consumed so a single chunk is held at a time
+type chunkReader struct {
+	store  storage.StorageInterface
+	prefix string
+	names  []string
+	cur    io.Reader
+}
+
+func (c *chunkReader) Read(p []byte) (int, error) {
+	for {
+		if c.cur == nil {
+			if len(c.names) == 0 {
+				return 0, io.EOF
+			}
+			r, err := c.store.Get(c.prefix, c.names[0])
+			if err != nil {
+				return 0, err
+			}
+			c.cur, c.names = r, c.names[1:]
+		}
+
+		n, err := c.cur.Read(p)
+		if err == io.EOF {
+			c.Close()
+			if n == 0 {
+				continue
+			}
+			err = nil
+		}
+		return n, err
+	}
+}
+
+// Close closes the chunk being read
+func (c *chunkReader) Close() error {
+	if c.cur == nil {
+		return nil
+	}
+	var err error
+	if closer, ok := c.cur.(io.Closer); ok {
+		err = closer.Close()
+	}
+	c.cur = nil
+	return err
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func contains(slice []string, v string) bool {
+	for _, s := range slice {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
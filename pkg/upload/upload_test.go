@@ -0,0 +1,196 @@
+package upload_test
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/gkkkb/pokedex/pkg/pokedextest"
+	"github.com/gkkkb/pokedex/pkg/registry"
+	"github.com/gkkkb/pokedex/pkg/storage"
+	"github.com/gkkkb/pokedex/pkg/tenant"
+	"github.com/gkkkb/pokedex/pkg/upload"
+
+	"github.com/jmoiron/sqlx"
+)
+
+const profileID = 9001
+
+func setup(t *testing.T) (context.Context, *sqlx.DB, storage.StorageInterface, storage.StorageInterface) {
+	t.Helper()
+
+	db := pokedextest.DB(t)
+	pokedextest.LoadFixtures(t, db, "testdata/profiles.yml")
+
+	chunks, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	dest, err := storage.InitMemory()
+	if err != nil {
+		t.Fatalf("InitMemory: %v", err)
+	}
+	return tenant.NewContext(context.Background(), 1), db, chunks, dest
+}
+
+func create(t *testing.T, ctx context.Context, db *sqlx.DB, purpose string, filename string, length int64) upload.Upload {
+	t.Helper()
+
+	metadata := "filename " + base64.StdEncoding.EncodeToString([]byte(filename))
+	u, err := upload.Create(ctx, db, upload.Purposes[purpose], 1, profileID, length, metadata, 7)
+	if err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	return u
+}
+
+func read(t *testing.T, store storage.StorageInterface, prefix string, filename string) string {
+	t.Helper()
+
+	f, err := store.Get(prefix, filename)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	return string(b)
+}
+
+func countChunks(t *testing.T, store storage.StorageInterface, u upload.Upload) int {
+	t.Helper()
+
+	infos, _, err := store.List("uploads/"+u.ID, "", 0)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	return len(infos)
+}
+
+func TestAppendLosingRaceKeepsWinnerChunk(t *testing.T) {
+	ctx, db, chunks, dest := setup(t)
+	u := create(t, ctx, db, upload.PurposePhoto, "photo.jpg", 8)
+
+	won, err := upload.Append(ctx, db, chunks, dest, u, 0, strings.NewReader("aaaa"))
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	// a concurrent PATCH read the upload before the winner updated it
+	if _, err := upload.Append(ctx, db, chunks, dest, u, 0, strings.NewReader("bbbb")); err != upload.ErrOffsetMismatch {
+		t.Fatalf("losing Append error = %v, want %v", err, upload.ErrOffsetMismatch)
+	}
+	if n := countChunks(t, chunks, u); n != 1 {
+		t.Errorf("%d chunks stored after losing Append, want 1", n)
+	}
+
+	done, err := upload.Append(ctx, db, chunks, dest, won, 4, strings.NewReader("cccc"))
+	if err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+	if done.CompletedAt == nil {
+		t.Fatal("upload not completed")
+	}
+	if got := read(t, dest, upload.Purposes[upload.PurposePhoto].Prefix(u), u.Filename); got != "aaaacccc" {
+		t.Errorf("assembled %q, want %q", got, "aaaacccc")
+	}
+	if n := countChunks(t, chunks, u); n != 0 {
+		t.Errorf("%d chunks left after completion, want 0", n)
+	}
+}
+
+func TestCompleteAttachesPhoto(t *testing.T) {
+	ctx, db, chunks, dest := setup(t)
+	u := create(t, ctx, db, upload.PurposePhoto, "photo.jpg", 5)
+
+	if _, err := upload.Append(ctx, db, chunks, dest, u, 0, strings.NewReader("photo")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	var photo string
+	if err := db.Get(&photo, "SELECT photo FROM profiles WHERE id = ?", profileID); err != nil {
+		t.Fatalf("select photo: %v", err)
+	}
+	if photo != u.Filename {
+		t.Errorf("profile photo = %q, want %q", photo, u.Filename)
+	}
+}
+
+func TestCompleteRecordsRegistryFile(t *testing.T) {
+	ctx, db, chunks, dest := setup(t)
+	u := create(t, ctx, db, upload.PurposeRegistry, "baptism-1990.pdf", 6)
+
+	if _, err := upload.Append(ctx, db, chunks, dest, u, 0, strings.NewReader("scan-1")); err != nil {
+		t.Fatalf("Append: %v", err)
+	}
+
+	var f registry.File
+	if err := db.Get(&f, "SELECT id, branch_id, upload_id, filename, original_name, size, created_by, created_at FROM registry_files WHERE upload_id = ?", u.ID); err != nil {
+		t.Fatalf("select registry file: %v", err)
+	}
+	if f.Filename != u.Filename || f.OriginalName != "baptism-1990.pdf" || f.Size != 6 || f.BranchID != 1 || f.CreatedBy != 7 {
+		t.Errorf("registry file = %+v", f)
+	}
+	if got := read(t, dest, registry.Prefix, u.Filename); got != "scan-1" {
+		t.Errorf("assembled %q, want %q", got, "scan-1")
+	}
+}
+
+// failingStore fails the first Put
+type failingStore struct {
+	storage.StorageInterface
+	failed bool
+}
+
+func (s *failingStore) Put(filePrefix string, filename string, file io.Reader) error {
+	if !s.failed {
+		s.failed = true
+		return errors.New("storage unavailable")
+	}
+	return s.StorageInterface.Put(filePrefix, filename, file)
+}
+
+func TestRetryFailedAssembly(t *testing.T) {
+	retries := map[string]func(ctx context.Context, db *sqlx.DB, chunks, dest storage.StorageInterface, u upload.Upload) (upload.Upload, error){
+		"empty PATCH": func(ctx context.Context, db *sqlx.DB, chunks, dest storage.StorageInterface, u upload.Upload) (upload.Upload, error) {
+			return upload.Append(ctx, db, chunks, dest, u, u.Offset, strings.NewReader(""))
+		},
+		"HEAD": upload.Resume,
+	}
+
+	for name, retry := range retries {
+		t.Run(name, func(t *testing.T) {
+			ctx, db, chunks, mem := setup(t)
+			dest := &failingStore{StorageInterface: mem}
+			u := create(t, ctx, db, upload.PurposeRegistry, "scan.pdf", 4)
+
+			if _, err := upload.Append(ctx, db, chunks, dest, u, 0, strings.NewReader("scan")); err == nil {
+				t.Fatal("Append succeeded with failing storage")
+			}
+
+			u, err := upload.Find(ctx, db, u.ID)
+			if err != nil {
+				t.Fatalf("Find: %v", err)
+			}
+			if u.Offset != u.Length || u.CompletedAt != nil {
+				t.Fatalf("upload offset %d of %d, completed %v, want every byte received and not completed", u.Offset, u.Length, u.CompletedAt)
+			}
+
+			u, err = retry(ctx, db, chunks, dest, u)
+			if err != nil {
+				t.Fatalf("retry: %v", err)
+			}
+			if u.CompletedAt == nil {
+				t.Fatal("upload not completed by retry")
+			}
+			if got := read(t, mem, registry.Prefix, u.Filename); got != "scan" {
+				t.Errorf("assembled %q, want %q", got, "scan")
+			}
+		})
+	}
+}
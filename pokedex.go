@@ -1,62 +1,137 @@
 package pokedex
 
 import (
+	"context"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/gkkkb/pokedex/pkg/filegc"
+	"github.com/gkkkb/pokedex/pkg/log"
 	"github.com/gkkkb/pokedex/pkg/mysql"
+	"github.com/gkkkb/pokedex/pkg/repository"
 	"github.com/gkkkb/pokedex/pkg/storage"
 	"github.com/gkkkb/pokedex/pkg/telolet"
+	"github.com/gkkkb/pokedex/pkg/upload"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/sirupsen/logrus"
 	"github.com/subosito/gotenv"
 )
 
 type Pokedex struct {
 	DB      *sqlx.DB
 	Storage storage.StorageInterface
-	Logger  *logrus.Logger
+	// Private keeps large files, such as registry scans, without public URL.
+	// Unlike Documents they are not encrypted so they stream both ways.
+	Private storage.StorageInterface
+	// Documents keeps sensitive member documents encrypted and private
+	Documents storage.StorageInterface
+	Replicas  *mysql.Replicas
+	Repo      *repository.Repositories
+	Logger    *log.Logger
 }
 
 var pokedex *Pokedex
+var initErr error
 var once sync.Once
 
-func GetInstance() *Pokedex {
+// Init connects every dependency once, returning the first failure so
+// binaries can report it and exit
+func Init() (*Pokedex, error) {
 	once.Do(func() {
 		gotenv.Load(os.Getenv("GOPATH") + "/src/github.com/bukalapak/pokedex/.env")
 
-		environment := os.Getenv("ENV")
-		db := mysql.Init()
-
+		// configured first so connection retries are logged as configured
 		logger := initLogger()
 
-		var store storage.StorageInterface
-		var err error
-		if environment == "development" {
-			store, err = storage.InitLocal()
-		} else {
-			store, err = storage.InitAWS2()
+		db, err := mysql.Init()
+		if err != nil {
+			initErr = err
+			return
 		}
+		replicas := mysql.InitReplicas(db)
 
+		backend, err := storage.InitDriver(storageDriver())
 		if err != nil {
-			panic(err)
+			initErr = err
+			return
 		}
 
-		pokedex = &Pokedex{DB: db, Storage: store, Telolet: teloletClient, Logger: logger}
+		private := storage.NewPrivateStorage(backend)
+		documents, err := storage.NewEncryptedStorage(private, os.Getenv("DOCUMENT_MASTER_KEY"))
+		if err != nil {
+			initErr = err
+			return
+		}
+
+		pokedex = &Pokedex{DB: db, Storage: storage.NewImageStorage(backend), Private: private, Documents: documents, Replicas: replicas, Repo: repository.New(db, replicas), Telolet: teloletClient, Logger: logger}
 	})
 
-	return pokedex
+	return pokedex, initErr
+}
+
+// GetInstance returns the instance built by Init, panicking when Init failed
+func GetInstance() *Pokedex {
+	instance, err := Init()
+	if err != nil {
+		panic(err)
+	}
+	return instance
 }
 
-func initLogger() *logrus.Logger {
-	logger := logrus.New()
+// SetInstance replaces the instance returned by GetInstance without
+// connecting anything, so tests can run handlers against their own instance
+func SetInstance(p *Pokedex) {
+	once.Do(func() {})
+	pokedex, initErr = p, nil
+}
+
+// Loop runs background jobs, it blocks forever
+func (p *Pokedex) Loop() {
+	ctx := context.Background()
+
+	go upload.RunCleanup(ctx, p.DB, p.Documents, time.Hour)
 
-	level, err := logrus.ParseLevel(os.Getenv("LOGGING_LEVEL"))
+	probeInterval, err := time.ParseDuration(os.Getenv("DATABASE_REPLICA_PROBE_INTERVAL"))
 	if err != nil {
-		level = logrus.InfoLevel
+		probeInterval = 5 * time.Second
 	}
-	logger.Level = level
+	go p.Replicas.Run(ctx, probeInterval)
+
+	interval, err := time.ParseDuration(os.Getenv("FILE_GC_INTERVAL"))
+	if err != nil {
+		interval = 24 * time.Hour
+	}
+
+	filegc.Run(ctx, p.DB, p.FileStores(), interval)
+}
+
+// FileStores returns every storage swept by filegc
+func (p *Pokedex) FileStores() filegc.Stores {
+	return filegc.Stores{
+		filegc.StorePublic:    p.Storage,
+		filegc.StorePrivate:   p.Private,
+		filegc.StoreDocuments: p.Documents,
+	}
+}
+
+// storageDriver returns STORAGE_DRIVER, falling back to local on development
+// and s3 elsewhere when it is not set
+func storageDriver() string {
+	if driver := os.Getenv("STORAGE_DRIVER"); driver != "" {
+		return driver
+	}
+
+	if os.Getenv("ENV") == "development" {
+		return storage.DriverLocal
+	}
+	return storage.DriverS3
+}
 
+// initLogger builds the logger from environment variables and makes it
+// the default of pkg/log
+func initLogger() *log.Logger {
+	logger := log.New(log.ConfigFromEnv())
+	log.SetDefault(logger)
 	return logger
 }
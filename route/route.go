@@ -7,8 +7,40 @@ import (
 
 func Route() []api.API {
 	apis := []api.API{
-		//{Endpoint: "/profiles", Action: "call-profiles-all", Method: "GET", Authority: api.Admin, Handle: pokedex.AllProfilesAdvanced},
-		//{Endpoint: "/profiles/:profile_id", Action: "call-profile-detail", Method: "GET", Authority: api.User, Handle: pokedex.DetailProfile}
+		{Endpoint: "/profiles", Action: "call-profiles-all", Method: "GET", Authority: api.User, Handle: pokedex.AllProfiles},
+		{Endpoint: "/profiles/:profile_id", Action: "call-profile-detail", Method: "GET", Authority: api.User, Handle: pokedex.DetailProfile},
+		{Endpoint: "/profiles/:profile_id", Action: "update-profile", Method: "PATCH", Authority: api.User, Handle: pokedex.UpdateProfile},
+		{Endpoint: "/profiles/:profile_id/export", Action: "call-profile-export", Method: "GET", Authority: api.User, Handle: pokedex.ExportPersonalData},
+		{Endpoint: "/profiles/:profile_id/erasure-requests", Action: "create-erasure-request", Method: "POST", Authority: api.User, Handle: pokedex.RequestErasure},
+		{Endpoint: "/profiles/:profile_id/transfers", Action: "create-profile-transfer", Method: "POST", Authority: api.User, Handle: pokedex.RequestTransfer},
+		{Endpoint: "/profiles/:profile_id/photo/uploads", Action: "create-profile-photo-upload", Method: "POST", Authority: api.User, Handle: pokedex.CreatePhotoUpload},
+		{Endpoint: "/profiles/:profile_id/photo", Action: "confirm-profile-photo-upload", Method: "PUT", Authority: api.User, Handle: pokedex.ConfirmPhotoUpload},
+		{Endpoint: "/profiles/:profile_id/private-documents", Action: "call-profile-private-documents", Method: "GET", Authority: api.User, Handle: pokedex.AllPrivateDocuments},
+		{Endpoint: "/profiles/:profile_id/private-documents", Action: "create-private-document", Method: "POST", Authority: api.User, Handle: pokedex.UploadPrivateDocument},
+		{Endpoint: "/profiles/:profile_id/private-documents/:filename", Action: "call-private-document", Method: "GET", Authority: api.User, Handle: pokedex.DownloadPrivateDocument},
+		{Endpoint: "/profiles/:profile_id/documents", Action: "call-profile-documents", Method: "GET", Authority: api.User, Handle: pokedex.AllDocuments},
+		{Endpoint: "/profiles/:profile_id/documents", Action: "create-profile-document", Method: "POST", Authority: api.User, Handle: pokedex.CreateDocument},
+		{Endpoint: "/profiles/:profile_id/documents/:document_id/versions", Action: "call-profile-document-versions", Method: "GET", Authority: api.User, Handle: pokedex.AllDocumentVersions},
+		{Endpoint: "/profiles/:profile_id/documents/:document_id/versions", Action: "create-profile-document-version", Method: "POST", Authority: api.User, Handle: pokedex.CreateDocumentVersion},
+		{Endpoint: "/profiles/:profile_id/documents/:document_id/versions/:version/file", Action: "call-profile-document-file", Method: "GET", Authority: api.User, Handle: pokedex.DownloadDocumentVersion},
+		{Endpoint: "/households/:household_id", Action: "update-household", Method: "PATCH", Authority: api.Admin, Handle: pokedex.UpdateHousehold},
+		{Endpoint: "/search/profiles", Action: "call-profile-search", Method: "GET", Authority: api.User, Handle: pokedex.SearchProfiles},
+		{Endpoint: "/uploads", Action: "call-upload-options", Method: "OPTIONS", Authority: api.Anonymous, Handle: pokedex.UploadOptions},
+		{Endpoint: "/uploads", Action: "create-upload", Method: "POST", Authority: api.User, Handle: pokedex.CreateUpload},
+		{Endpoint: "/uploads/:upload_id", Action: "call-upload-offset", Method: "HEAD", Authority: api.User, Handle: pokedex.UploadOffset},
+		{Endpoint: "/uploads/:upload_id", Action: "append-upload", Method: "PATCH", Authority: api.User, Handle: pokedex.AppendUpload},
+		{Endpoint: "/uploads/:upload_id", Action: "terminate-upload", Method: "DELETE", Authority: api.User, Handle: pokedex.TerminateUpload},
+		{Endpoint: "/registry-files", Action: "call-registry-files", Method: "GET", Authority: api.Admin, Handle: pokedex.AllRegistryFiles},
+		{Endpoint: "/registry-files/:registry_file_id", Action: "call-registry-file", Method: "GET", Authority: api.Admin, Handle: pokedex.DownloadRegistryFile},
+		{Endpoint: "/erasure-requests/:erasure_request_id/approve", Action: "approve-erasure-request", Method: "PATCH", Authority: api.Admin, Handle: pokedex.ApproveErasure},
+		{Endpoint: "/erasure-requests/:erasure_request_id/reject", Action: "reject-erasure-request", Method: "PATCH", Authority: api.Admin, Handle: pokedex.RejectErasure},
+		{Endpoint: "/transfers/import", Action: "import-transfer-package", Method: "POST", Authority: api.Admin, Handle: pokedex.ImportTransferPackage},
+		{Endpoint: "/transfers/:transfer_id", Action: "call-transfer-detail", Method: "GET", Authority: api.Admin, Handle: pokedex.DetailTransfer},
+		{Endpoint: "/transfers/:transfer_id/approve", Action: "approve-transfer", Method: "PATCH", Authority: api.Admin, Handle: pokedex.ApproveTransfer},
+		{Endpoint: "/transfers/:transfer_id/reject", Action: "reject-transfer", Method: "PATCH", Authority: api.Admin, Handle: pokedex.RejectTransfer},
+		{Endpoint: "/transfers/:transfer_id/package", Action: "call-transfer-package", Method: "GET", Authority: api.Admin, Handle: pokedex.DownloadTransferPackage},
+		{Endpoint: "/_internal/search/reindex", Action: "reindex-profile-names", Method: "POST", Authority: api.Anonymous, Handle: pokedex.ReindexProfileNames},
+		{Endpoint: "/_internal/storage/orphans", Action: "call-orphaned-files", Method: "GET", Authority: api.Anonymous, Handle: pokedex.OrphanedFiles},
 		//{Endpoint: "/_internal/autos/users/:username/status", Action: "call-user-status-by-username", Method: "GET", Authority: api.Anonymous, Handle: decepticon.UserStatus},
 		//{Endpoint: "/_internal/autos/users/:username/proposals/:proposal_vehicle_type/status", Action: "call-user-capability-to-create-proposal", Method: "GET", Authority: api.Anonymous, Handle: decepticon.UserPermissionToCreateProposal},
 	}